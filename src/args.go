@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ayase-mstk/go32as/src/assembler"
+)
+
+// コマンドラインで指定されたこと
+type options struct {
+	cfg           assembler.Config
+	output        string
+	inputs        []string // "-"は標準入力
+	includeDirs   []string // -I。.includeを実装していないので、受け付けるだけで使わない
+	listing       assembler.ListingOptions
+	listingFile   string // 空なら標準出力
+	noWarn        bool   // -W
+	fatalWarnings bool   // --fatal-warnings
+	help          bool
+	version       bool
+}
+
+// 標準入力から読んだソースの名前
+const stdinName = "{standard input}"
+
+// -aに続けられる文字。l, s以外は受け付けるだけ
+const listingFlags = "cdghlmns"
+
+/*
+gasと同じ形のオプションを解釈する。オプションと入力ファイルはどの順に並べてもよい
+-g, -I, -misa-spec=, -mlittle-endianは、gccから渡されても困らないように受け付けるだけ
+*/
+func parseArgs(args []string) (options, error) {
+	opts := options{output: assembler.DefaultOutput}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		// -o file と -ofile、--defsym SYM=VAL と --defsym=SYM=VAL のように、
+		// 値を次の引数にも同じ引数にも書けるオプションの値。sepは同じ引数に書くときの区切り
+		value := func(name, sep string) (string, error) {
+			if arg != name {
+				return strings.TrimPrefix(arg, name+sep), nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("option '%s' requires an argument", name)
+			}
+			i++
+			return args[i], nil
+		}
+
+		var err error
+		switch {
+		case arg == "--":
+			opts.inputs = append(opts.inputs, args[i+1:]...)
+			i = len(args)
+		case arg == "-" || !strings.HasPrefix(arg, "-"):
+			opts.inputs = append(opts.inputs, arg)
+		case arg == "--help":
+			opts.help = true
+		case arg == "--version":
+			opts.version = true
+		case strings.HasPrefix(arg, "-o"):
+			// -oの後ろはそのままファイル名になる
+			opts.output, err = value("-o", "")
+		case strings.HasPrefix(arg, "-I"):
+			var dir string
+			dir, err = value("-I", "")
+			opts.includeDirs = append(opts.includeDirs, dir)
+		case arg == "--defsym", strings.HasPrefix(arg, "--defsym="):
+			var def string
+			def, err = value("--defsym", "=")
+			opts.cfg.Defsyms = append(opts.cfg.Defsyms, def)
+		case strings.HasPrefix(arg, "-march="):
+			opts.cfg.March = strings.TrimPrefix(arg, "-march=")
+		case strings.HasPrefix(arg, "-mabi="):
+			opts.cfg.Mabi = strings.TrimPrefix(arg, "-mabi=")
+		case strings.HasPrefix(arg, "-misa-spec="), arg == "-mlittle-endian", arg == "-g":
+		case arg == "-mrelax":
+			opts.cfg.NoRelax = false
+		case arg == "-mno-relax":
+			opts.cfg.NoRelax = true
+		case arg == "-fpic", arg == "-fPIC":
+			opts.cfg.PIC = true
+		case arg == "-fno-pic":
+			opts.cfg.PIC = false
+		case strings.HasPrefix(arg, "-fmax-errors="):
+			opts.cfg.ErrorLimit, err = strconv.Atoi(strings.TrimPrefix(arg, "-fmax-errors="))
+			if err != nil || opts.cfg.ErrorLimit < 0 {
+				err = fmt.Errorf("invalid error limit `%s'", strings.TrimPrefix(arg, "-fmax-errors="))
+			}
+		case arg == "-W", arg == "--no-warn":
+			opts.noWarn = true
+		case arg == "--warn":
+			opts.noWarn = false
+		case arg == "--fatal-warnings":
+			opts.fatalWarnings = true
+		case strings.HasPrefix(arg, "-a"):
+			err = opts.parseListing(arg)
+		default:
+			err = fmt.Errorf("unrecognized option '%s'", arg)
+		}
+		if err != nil {
+			return opts, err
+		}
+	}
+	// gasと同じく、入力ファイルがなければ標準入力から読む
+	if len(opts.inputs) == 0 {
+		opts.inputs = []string{"-"}
+	}
+	return opts, nil
+}
+
+// -a[cdghlmns][=file]。文字がなければ-ahlsと同じ
+func (opts *options) parseListing(arg string) error {
+	flags, file, _ := strings.Cut(strings.TrimPrefix(arg, "-a"), "=")
+	if flags == "" {
+		flags = "hls"
+	}
+	for _, c := range flags {
+		if !strings.ContainsRune(listingFlags, c) {
+			return fmt.Errorf("invalid listing option `%c'", c)
+		}
+	}
+	opts.listing.Assembly = opts.listing.Assembly || strings.ContainsRune(flags, 'l')
+	opts.listing.Symbols = opts.listing.Symbols || strings.ContainsRune(flags, 's')
+	opts.listingFile = file
+	return nil
+}
+
+const usage = `Usage: %s [option...] [asmfile...]
+Options:
+  -a[lhs][=FILE]          generate a listing: l = assembly, s = symbols,
+                          h = accepted for compatibility (default -ahls)
+  --defsym SYM=VAL        define symbol SYM with integer value VAL
+  --fatal-warnings        treat warnings as errors
+  -fpic, -fPIC            generate position-independent code
+  -fno-pic                do not generate position-independent code (default)
+  -fmax-errors=N          stop reporting after N errors (0 = no limit)
+  -g                      accepted for compatibility; no debug info is generated
+  --help                  show this message and exit
+  -I DIR                  accepted for compatibility; .include is not supported
+  -mabi=ABI               select the ABI (ilp32, ilp32e, ilp32f, ilp32d)
+  -march=ISA              select the instruction set (e.g. rv32imac)
+  -mrelax                 allow the linker to relax instructions (default)
+  -mno-relax              do not allow the linker to relax instructions
+  -o OBJFILE              name the object file (default %s)
+  --version               print the version and exit
+  -W, --no-warn           suppress warnings
+  -                       read the source from standard input
+`
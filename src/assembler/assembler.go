@@ -0,0 +1,244 @@
+/*
+ファイルシステムを使わずにアセンブラを呼び出すためのパッケージ
+ソースをio.Readerか[]byteで受け取り、オブジェクトファイルをio.Writerに書くか[]byteで返す
+*/
+package assembler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ayase-mstk/go32as/src/diag"
+	"github.com/ayase-mstk/go32as/src/elf32"
+	"github.com/ayase-mstk/go32as/src/isa"
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+// アセンブルの設定。ゼロ値はコマンドラインで何も指定しなかったときと同じ
+type Config struct {
+	March    string   // -march。空なら既定の命令セット
+	Mabi     string   // -mabi。空なら命令セットから決める
+	NoRelax  bool     // -mno-relax
+	PIC      bool     // -fpic
+	Filename string   // エラーメッセージに出すソースの名前
+	Defsyms  []string // --defsym sym=val。ソースの前に.equ sym, valを置いたのと同じ
+	// 報告するエラーの上限。0なら全て報告する
+	ErrorLimit int
+}
+
+// 既定の出力ファイル名
+const DefaultOutput = "output.o"
+
+// --versionで表示する版
+const Version = "0.1.0"
+
+// アセンブルするソースの名前と中身
+type Source struct {
+	Name string
+	Data []byte
+}
+
+// アセンブルしたオブジェクト
+type Object struct {
+	elf     elf32.Elf32
+	sources []Source
+	diags   diag.List
+}
+
+// ソースの名前が付いた警告を返す
+func (o *Object) Warnings() []string {
+	var warnings []string
+	for i := range o.diags {
+		if o.diags[i].Severity == diag.Warning {
+			warnings = append(warnings, o.diags[i].Error())
+		}
+	}
+	return warnings
+}
+
+// 見つけたエラーと警告を、ソースと行の順に返す。エラーはConfig.ErrorLimitまでに打ち切る
+func (o *Object) Diagnostics() diag.List {
+	return o.diags
+}
+
+// diag.Renderに渡す、ソースのrow行目の内容
+func (o *Object) SourceLine(file string, row int) (string, bool) {
+	for _, src := range o.sources {
+		if src.Name != file {
+			continue
+		}
+		lines := strings.Split(string(src.Data), "\n")
+		if row < 1 || row > len(lines) {
+			return "", false
+		}
+		return strings.TrimSuffix(lines[row-1], "\r"), true
+	}
+	return "", false
+}
+
+// オブジェクトファイルをwに書き出す
+func (o *Object) Write(w io.Writer) error {
+	return o.elf.Write(w)
+}
+
+// オブジェクトファイルをpathに書き出す。失敗したときはpathを作らない
+func (o *Object) WriteFile(path string) error {
+	return o.elf.WriteToFile(path)
+}
+
+// ソースを読む前に分かる設定の誤りを調べる
+func (cfg Config) Check() error {
+	if _, _, err := ResolveTarget(cfg.March, cfg.Mabi); err != nil {
+		return err
+	}
+	_, err := defsymSource(cfg.Defsyms)
+	return err
+}
+
+/*
+srcsを順につなげて1つのオブジェクトにアセンブルする
+ソースの誤りは全て集めてdiag.Listのエラーで返す。パースでエラーがあっても、正しく読めた文で
+レイアウトとエンコードに進み、そこで見つけた診断とまとめる
+エラーになっても、見つけた診断を持つObjectを返す
+*/
+func Build(srcs []Source, cfg Config) (*Object, error) {
+	obj := &Object{sources: srcs}
+	arch, abi, err := ResolveTarget(cfg.March, cfg.Mabi)
+	if err != nil {
+		return obj, err
+	}
+	defsyms, err := defsymSource(cfg.Defsyms)
+	if err != nil {
+		return obj, err
+	}
+
+	opts := parse.NewOptions(arch)
+	opts.SetRelax(!cfg.NoRelax)
+	opts.SetPIC(cfg.PIC)
+	// 打ち切ったと分かるように上限より1つ多くまで集め、余りは並べ替えたあとでTruncateが捨てる
+	maxErrors := 0
+	if cfg.ErrorLimit > 0 {
+		maxErrors = cfg.ErrorLimit + 1
+	}
+	opts.SetMaxErrors(maxErrors)
+	readers := []parse.Source{defsyms}
+	for _, src := range srcs {
+		readers = append(readers, parse.Source{Name: src.Name, Reader: bytes.NewReader(src.Data)})
+	}
+	stmts, err := parse.ParseSources(readers, opts)
+	var parseDiags diag.List
+	if err != nil && !errors.As(err, &parseDiags) {
+		return obj, err
+	}
+
+	obj.diags = parseDiags
+	// パースで上限まで集めたら、レイアウトには進まない
+	if !parseDiags.Reached(maxErrors) {
+		if maxErrors > 0 {
+			maxErrors -= parseDiags.Errors()
+		}
+		// elf32のエラーは全てDiagnosticsに入っていて、そちらにはソースの名前も付いている
+		obj.elf, _ = elf32.PrepareElf32Tables(stmts, arch, abi, maxErrors)
+		obj.diags = append(obj.diags, obj.elf.Diagnostics()...)
+	}
+	obj.sortDiagnostics()
+	obj.diags = obj.diags.Truncate(cfg.ErrorLimit)
+	return obj, obj.diags.Err()
+}
+
+// 診断をソースの順、行の順に並べる。同じ行の診断は見つけた順のまま
+func (o *Object) sortDiagnostics() {
+	order := map[string]int{}
+	for i, src := range o.sources {
+		if _, ok := order[src.Name]; !ok {
+			order[src.Name] = i + 1
+		}
+	}
+	sort.SliceStable(o.diags, func(i, j int) bool {
+		a, b := o.diags[i], o.diags[j]
+		if order[a.File] != order[b.File] {
+			return order[a.File] < order[b.File]
+		}
+		return a.Line < b.Line
+	})
+}
+
+// --defsymの名前
+const defsymName = "--defsym"
+
+// --defsymの定義を.equの行にする。valは整数でなければならない
+func defsymSource(defsyms []string) (parse.Source, error) {
+	var lines strings.Builder
+	for _, def := range defsyms {
+		sym, val, ok := strings.Cut(def, "=")
+		if !ok || sym == "" || val == "" {
+			return parse.Source{}, fmt.Errorf("bad defsym; format is --defsym name=value")
+		}
+		line := fmt.Sprintf(".equ %s, %s", sym, val)
+		if _, err := parse.ParseLine([]rune(line), 0); err != nil {
+			return parse.Source{}, fmt.Errorf("bad defsym `%s': %s", def, err.Error())
+		}
+		lines.WriteString(line + "\n")
+	}
+	return parse.Source{Name: defsymName, Reader: strings.NewReader(lines.String())}, nil
+}
+
+// rのソースをアセンブルしてwに書き出す。戻り値は警告
+func Assemble(r io.Reader, w io.Writer, cfg Config) ([]string, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := Build([]Source{{Name: cfg.Filename, Data: src}}, cfg)
+	if err != nil {
+		return obj.Warnings(), err
+	}
+	return obj.Warnings(), obj.Write(w)
+}
+
+// srcをアセンブルしてオブジェクトファイルのバイト列を返す
+func AssembleBytes(src []byte, cfg Config) ([]byte, []string, error) {
+	var buf bytes.Buffer
+	warnings, err := Assemble(bytes.NewReader(src), &buf, cfg)
+	if err != nil {
+		return nil, warnings, err
+	}
+	return buf.Bytes(), warnings, nil
+}
+
+// inputをアセンブルしてoutputに書き出す。失敗したときはoutputを作らない
+func AssembleFile(input, output string, cfg Config) ([]string, error) {
+	src, err := os.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Filename == "" {
+		cfg.Filename = input
+	}
+	obj, err := Build([]Source{{Name: cfg.Filename, Data: src}}, cfg)
+	if err != nil {
+		return obj.Warnings(), err
+	}
+	return obj.Warnings(), obj.WriteFile(output)
+}
+
+// -march, -mabiから命令セットとABIを決める。省略されていればデフォルトを使う
+func ResolveTarget(march, mabi string) (isa.ISA, isa.ABI, error) {
+	arch := isa.Default()
+	if march != "" {
+		var err error
+		if arch, err = isa.Parse(march); err != nil {
+			return arch, isa.ABI{}, err
+		}
+	}
+	if mabi == "" {
+		return arch, isa.DefaultABI(arch), nil
+	}
+	abi, err := isa.ParseABI(mabi, arch)
+	return arch, abi, err
+}
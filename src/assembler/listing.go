@@ -0,0 +1,119 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ayase-mstk/go32as/src/diag"
+	"github.com/ayase-mstk/go32as/src/elf32"
+)
+
+// リスティングに含めるもの。-aに続く文字に対応する
+type ListingOptions struct {
+	Assembly bool // l: ソースの各行と、その行が出力したアドレスとバイト列
+	Symbols  bool // s: 定義されたシンボルと未定義のシンボルの一覧
+}
+
+// リスティングの1行に出すバイト数
+const listingBytesPerLine = 4
+
+/*
+gasの-aと同じ形のリスティングをwに書く
+バイト列は1行に4バイトずつ出し、残りは行番号だけの続きの行に出す
+警告と分岐の緩和の注記は、その行の後ろに****で始まる行として出す
+*/
+func (o *Object) WriteListing(w io.Writer, opts ListingOptions) error {
+	bw := bufio.NewWriter(w)
+	if opts.Assembly {
+		for page, src := range o.sources {
+			o.writeSourceListing(bw, page+1, src)
+		}
+	}
+	if opts.Symbols {
+		o.writeSymbolListing(bw)
+	}
+	return bw.Flush()
+}
+
+func (o *Object) writeSourceListing(w io.Writer, page int, src Source) {
+	fmt.Fprintf(w, "RISC-V GAS  %s \t\t\tpage %d\n\n\n", src.Name, page)
+
+	lines := map[int][]elf32.ListingLine{}
+	for _, l := range o.elf.Listing() {
+		if l.File == src.Name {
+			lines[l.Row] = append(lines[l.Row], l)
+		}
+	}
+	notes := map[int][]string{}
+	for _, n := range o.elf.ListingNotes() {
+		if n.File == src.Name {
+			notes[n.Row] = append(notes[n.Row], "Note: "+n.Text)
+		}
+	}
+	for _, d := range o.diags {
+		if d.File == src.Name && d.Severity == diag.Warning {
+			notes[d.Line] = append(notes[d.Line], fmt.Sprintf("%s: %s", d.Severity, d.Message))
+		}
+	}
+
+	text := strings.TrimSuffix(string(src.Data), "\n")
+	for i, line := range strings.Split(text, "\n") {
+		row := i + 1
+		writeListingLine(w, row, line, lines[row])
+		for _, note := range notes[row] {
+			fmt.Fprintf(w, "****  %s\n", note)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// ソースの1行と、その行の文が置かれたアドレスとバイト列
+func writeListingLine(w io.Writer, row int, line string, stmts []elf32.ListingLine) {
+	if len(stmts) == 0 {
+		fmt.Fprintf(w, "%4d              \t%s\n", row, line)
+		return
+	}
+	var data []byte
+	for _, s := range stmts {
+		data = append(data, s.Bytes...)
+	}
+	fmt.Fprintf(w, "%4d %04x %-8s \t%s\n", row, stmts[0].Addr, hexBytes(data, 0), line)
+	for off := listingBytesPerLine; off < len(data); off += listingBytesPerLine {
+		fmt.Fprintf(w, "%4d      %-8s\n", row, hexBytes(data, off))
+	}
+}
+
+// data[off:]の先頭から1行分のバイト列を16進数で表す
+func hexBytes(data []byte, off int) string {
+	end := off + listingBytesPerLine
+	if end > len(data) {
+		end = len(data)
+	}
+	if off >= end {
+		return ""
+	}
+	return fmt.Sprintf("%X", data[off:end])
+}
+
+func (o *Object) writeSymbolListing(w io.Writer) {
+	defined, undefined := o.elf.ListingSymbols()
+	fmt.Fprintln(w, "DEFINED SYMBOLS")
+	for _, sym := range defined {
+		where := ""
+		if sym.File != "" {
+			where = fmt.Sprintf("%s:%d", sym.File, sym.Row)
+		}
+		section := sym.Section
+		if section == "" {
+			section = "*ABS*"
+		}
+		fmt.Fprintf(w, "%24s %6s:%08x %s\n", where, section, sym.Value, sym.Name)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "UNDEFINED SYMBOLS")
+	for _, sym := range undefined {
+		fmt.Fprintln(w, sym.Name)
+	}
+}
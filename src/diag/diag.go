@@ -0,0 +1,165 @@
+/*
+アセンブル中に見つかったエラーや警告を、ソースの位置と一緒に扱うパッケージ
+パース、レイアウト、エンコードのどの段階の診断も同じDiagnosticで表す
+*/
+package diag
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+var severityNames = map[Severity]string{
+	Error:   "Error",
+	Warning: "Warning",
+	Note:    "Note",
+}
+
+func (s Severity) String() string { return severityNames[s] }
+
+// ソースの1か所についての診断
+type Diagnostic struct {
+	File     string
+	Line     int // 1始まり。0ならソースの行に結びつかない
+	Column   int // 1始まり。0なら列は分からない
+	Severity Severity
+	Message  string
+	Notes    []string // 診断に添える補足
+}
+
+// gasと同じ "file:line: Error: message" の形。列と補足は出さず、改行も付けない
+func (d *Diagnostic) Error() string {
+	return d.location(false) + fmt.Sprintf("%s: %s", d.Severity, d.Message)
+}
+
+// "file:line[:column]: " の形の位置。分からない部分は省く
+func (d *Diagnostic) location(column bool) string {
+	loc := d.File
+	if d.Line != 0 {
+		loc += fmt.Sprintf(":%d", d.Line)
+		if column && d.Column != 0 {
+			loc += fmt.Sprintf(":%d", d.Column)
+		}
+	}
+	loc = strings.TrimPrefix(loc, ":")
+	if loc == "" {
+		return ""
+	}
+	return loc + ": "
+}
+
+/*
+診断の並び。エラーとして返すときに使う
+errors.Asで*Diagnosticを取り出すと先頭の診断が、Listを取り出すと全ての診断が得られる
+*/
+type List []Diagnostic
+
+// 診断を1行ずつ改行でつなげる
+func (l List) Error() string {
+	lines := make([]string, len(l))
+	for i := range l {
+		lines[i] = l[i].Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l List) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i := range l {
+		errs[i] = &l[i]
+	}
+	return errs
+}
+
+// エラーの診断の数
+func (l List) Errors() int {
+	n := 0
+	for _, d := range l {
+		if d.Severity == Error {
+			n++
+		}
+	}
+	return n
+}
+
+// エラーをmax個集めたか。maxが0なら上限はない
+func (l List) Reached(max int) bool {
+	return max > 0 && l.Errors() >= max
+}
+
+// エラーがあれば自身を、なければnilを返す
+func (l List) Err() error {
+	if l.Errors() == 0 {
+		return nil
+	}
+	return l
+}
+
+/*
+エラーがlimit個になったところで打ち切る。limitが0なら打ち切らない
+打ち切ったときは、それ以降を捨てたことを知らせる診断を最後に付ける
+並べ替えたあとで切るので、全ての診断を集め終えてから呼ぶ
+*/
+func (l List) Truncate(limit int) List {
+	if limit <= 0 {
+		return l
+	}
+	errs := 0
+	for i, d := range l {
+		if d.Severity != Error {
+			continue
+		}
+		if errs++; errs > limit {
+			truncated := append(List{}, l[:i]...)
+			return append(truncated, Diagnostic{Severity: Error, Message: fmt.Sprintf("too many errors (%d), stopping", limit)})
+		}
+	}
+	return l
+}
+
+/*
+診断をwに書く。lineがソースの行を返せれば、その行と列の位置に^を付けた行も書く
+タブは幅を変えないようにそのまま残す
+
+	a.s:3:10: Error: illegal operands `a0'
+	    addi a0, a0
+	             ^
+*/
+func Render(w io.Writer, d Diagnostic, line func(file string, row int) (string, bool)) {
+	fmt.Fprintf(w, "%s%s: %s\n", d.location(true), d.Severity, d.Message)
+	if src, ok := line(d.File, d.Line); ok && d.Line != 0 {
+		fmt.Fprintln(w, src)
+		if d.Column != 0 {
+			fmt.Fprintln(w, caret(src, d.Column))
+		}
+	}
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "%s%s: %s\n", d.location(false), Note, note)
+	}
+}
+
+// srcのcolumn列目の下に^を置いた行。タブはタブのまま、それ以外は空白にする
+func caret(src string, column int) string {
+	var b strings.Builder
+	for i, r := range []rune(src) {
+		if i >= column-1 {
+			break
+		}
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	b.WriteRune('^')
+	return b.String()
+}
@@ -1,65 +1,53 @@
 package elf32
 
-func calcOffset(off Elf32Off, size Elf32Word) Elf32Off {
-	return Elf32Off(int(off) + int(size))
+import "encoding/binary"
+
+// offをalignの倍数に揃える
+func alignOffset(off Elf32Off, align Elf32Word) Elf32Off {
+	return off + Elf32Off(alignPadding(Elf32Addr(off), align))
 }
 
+/*
+セクションヘッダーの並び順に、各セクションの中身をファイルに配置する
+セクションの先頭はsh_addralignに揃え、SHT_NOBITSのセクションはファイル上に場所をとらない
+セクションヘッダーテーブルは最後に4byte境界に揃えて置く
+*/
 func (e *Elf32) ResolveSectionRayout() {
-	var lastOffset Elf32Off = 0x34
-
-	// .text section
-	e.shdr.setSize(".text", Elf32Word(e.sections.entry[".text"].off))
-	lastOffset += Elf32Off(e.shdr.getSize(".text"))
-
-	// .data section
-	e.shdr.setOffset(".data", lastOffset)
-	e.shdr.setSize(".data", Elf32Word(e.sections.entry[".data"].off))
-	lastOffset += Elf32Off(e.shdr.getSize(".data"))
-
-	// .bss section
-	e.shdr.setOffset(".bss", lastOffset)
-	e.shdr.setSize(".bss", Elf32Word(e.sections.entry[".bss"].off))
-	lastOffset += Elf32Off(e.shdr.getSize(".bss"))
-
-	// .rodata section
-	if _, exist := e.shdr.shndx[".rodata"]; exist {
-		e.shdr.setOffset(".rodata", lastOffset)
-		e.shdr.setSize(".rodata", Elf32Word(e.sections.entry[".rodata"].off))
-		lastOffset += Elf32Off(e.shdr.getSize(".rodata"))
+	e.resolveSectionLinks()
+
+	names := e.shdr.names()
+	e.payloads = make([][]byte, len(e.shdr.shdrs))
+	lastOffset := Elf32Off(binary.Size(e.ehdr))
+	for idx := 1; idx < len(e.shdr.shdrs); idx++ {
+		shdr := &e.shdr.shdrs[idx]
+		lastOffset = alignOffset(lastOffset, shdr.ShAddralign)
+		shdr.ShOffset = lastOffset
+		if shdr.ShType == SHTNobits {
+			shdr.ShSize = Elf32Word(e.sections.resolveOffset(names[idx]))
+			continue
+		}
+		e.payloads[idx] = e.encodeSection(idx)
+		shdr.ShSize = Elf32Word(len(e.payloads[idx]))
+		lastOffset += Elf32Off(shdr.ShSize)
 	}
 
-	// .riscv.attributes section
-	e.shdr.setOffset(".riscv.attributes", lastOffset)
-	lastOffset += Elf32Off(e.shdr.getSize(".riscv.attributes"))
+	// ELF header section header table offset
+	e.ehdr.EShoff = alignOffset(lastOffset, 4)
+}
 
-	// .symtab section
+// セクション同士のつながり (sh_link, sh_info) とエントリの大きさを決める
+func (e *Elf32) resolveSectionLinks() {
 	e.shdr.setEntsize(".symtab", 0x10)
-	e.shdr.setOffset(".symtab", lastOffset)
-	e.shdr.setSize(".symtab", Elf32Word(len(e.symtbl.symtbls))*e.shdr.getEntsize(".symtab"))
 	e.shdr.setLink(".symtab", Elf32Word(e.shdr.shndx[".strtab"]))
 	e.shdr.setInfo(".symtab", Elf32Word(e.symtbl.calcLastLocalSymIdx()+1))
-	lastOffset += Elf32Off(e.shdr.getSize(".symtab"))
-
-	// .strtab section
-	e.shdr.setOffset(".strtab", lastOffset)
-	e.shdr.setOffset(".strtab", calcOffset(e.shdr.getOffset(".symtab"), e.shdr.getSize(".symtab")))
-	e.shdr.setSize(".strtab", Elf32Word(len(e.strtbl.data)))
-	lastOffset += Elf32Off(e.shdr.getSize(".strtab"))
-
-	// .strtab section
-	e.shdr.setOffset(".shstrtab", lastOffset)
-	e.shdr.setSize(".shstrtab", Elf32Word(len(e.shstrtbl.data)))
-	lastOffset += Elf32Off(e.shdr.getSize(".shstrtab"))
 
-	// .rela.text section
-	if _, exist := e.shdr.shndx[".rela.text"]; exist {
-		e.shdr.setOffset(".rela.text", lastOffset)
-		e.shdr.setSize(".rela.text", Elf32Word(len(e.rela.entry))*e.shdr.getEntsize(".rela.text"))
-		e.shdr.setLink(".rela.text", Elf32Word(e.shdr.shndx[".symtab"]))
-		e.shdr.setInfo(".rela.text", Elf32Word(e.shdr.shndx[".text"]))
-		lastOffset += Elf32Off(e.shdr.getSize(".rela.text"))
+	// .rela.text, .rela.data などのセクション
+	for _, name := range e.shdr.names() {
+		target, ok := relaTarget(name)
+		if !ok {
+			continue
+		}
+		e.shdr.setLink(name, Elf32Word(e.shdr.shndx[".symtab"]))
+		e.shdr.setInfo(name, Elf32Word(e.shdr.shndx[target]))
 	}
-
-	// ELF header section header table offset
-	e.ehdr.EShoff = lastOffset
 }
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/ayase-mstk/go32as/src/diag"
+	"github.com/ayase-mstk/go32as/src/isa"
 	"github.com/ayase-mstk/go32as/src/parse"
 )
 
@@ -14,8 +16,35 @@ type Elf32 struct {
 	symtbl   Symtbl
 	strtbl   Elf32Strtbl
 	shstrtbl Elf32Shstrtbl
-	rela     Rela
+	rela     map[string]Rela // 再配置を適用するセクションごとの再配置
 	shdr     Shdr
+	rvc      bool    // .option rvcでRVCが有効になったかどうか
+	arch     isa.ISA // -marchで指定された命令セット
+	abi      isa.ABI // -mabiで指定された呼び出し規約
+
+	attrOverrides []Attribute // .attributeで指定された属性
+	diags         diag.List   // 見つけたエラーと警告
+	maxErrors     int         // 集めるエラーの数の上限。0なら制限しない
+	listingNotes  []ListingNote
+	labelStmts    map[string]parse.Stmt // ラベルを定義した文。リスティングに使う
+	payloads      [][]byte              // セクションヘッダーと同じ並びの、各セクションの中身
+}
+
+// アセンブル中に見つかった警告を返す
+// 行番号から始まる形で返す
+func (e *Elf32) Warnings() []string {
+	var warnings []string
+	for _, d := range e.diags {
+		if d.Severity == diag.Warning {
+			warnings = append(warnings, fmt.Sprintf("%d: %s: %s\n", d.Line, d.Severity, d.Message))
+		}
+	}
+	return warnings
+}
+
+// 見つけたエラーと警告を、見つけた順に返す
+func (e *Elf32) Diagnostics() diag.List {
+	return e.diags
 }
 
 func (e *Elf32) PrintAll() {
@@ -37,9 +66,14 @@ func (e *Elf32) PrintAll() {
 
 /*
 セクションヘッダーテーブルの初期化と、シンボルテーブルへのラベルとセクションの追加を行い、データ行とコード行を各セクションに分ける
+エラーをmaxErrors個見つけたら、それ以降のエラーは集めない。0なら全て集める
 */
-func PrepareElf32Tables(stmts []parse.Stmt) (Elf32, error) {
+func PrepareElf32Tables(stmts []parse.Stmt, arch isa.ISA, abi isa.ABI, maxErrors int) (Elf32, error) {
 	var elf Elf32
+	elf.maxErrors = maxErrors
+	elf.arch = arch
+	elf.abi = abi
+	elf.labelStmts = map[string]parse.Stmt{}
 
 	elf.initHeader()
 	elf.initAttributes()
@@ -48,6 +82,9 @@ func PrepareElf32Tables(stmts []parse.Stmt) (Elf32, error) {
 	// symbol table のindex0にからシンボルを追加
 	elf.initSymbolTables()
 
+	// 範囲外の分岐を置き換えてから、アドレスを決める
+	stmts = elf.relaxBranches(stmts)
+
 	// 1周目
 	for _, stmt := range stmts {
 		var off Elf32Addr
@@ -58,45 +95,71 @@ func PrepareElf32Tables(stmts []parse.Stmt) (Elf32, error) {
 				labelName := stmt.LSymbol()
 				newSym := newSymbol(elf.strtbl.resolveIndex(labelName), elf.sections.resolveOffset(stmt.Section()), 0, createSymInfo(STB_LOCAL, STT_NOTYPE), elf.shdr.resolveShndx(stmt.Section()), stmt.Section())
 				elf.symtbl.addSymbol(newSym, labelName)
+				elf.labelStmts[labelName] = stmt
 			} else {
 				// 既にシンボルテーブルに存在するラベル名だった場合
-				// 他のセクションに同名のシンボルがあったらエラー
-				if elf.symtbl.duplicateLabel(stmt.LSymbol(), stmt.Section(), elf.strtbl) {
-					return elf, fmt.Errorf("%d: Error: symbol `%q' is already defined\n", stmt.Row(), stmt.LSymbol())
+				// ラベルで定義済みか、他のセクションに同名のシンボルがあったらエラー。後の定義は無視して続ける
+				// 複数のソースは1つのアセンブル単位なので、別のソースでの定義とも重複する
+				_, defined := elf.labelStmts[stmt.LSymbol()]
+				if defined || elf.symtbl.duplicateLabel(stmt.LSymbol(), stmt.Section(), elf.strtbl) {
+					elf.duplicateLabel(stmt)
+				} else {
+					// 重複していなければ、まだセクションに属していない可能性があるので、設定する
+					elf.symtbl.setSection(stmt.LSymbol(), stmt.Section())
+					elf.labelStmts[stmt.LSymbol()] = stmt
 				}
-				// 重複していなければ、まだセクションに属していない可能性があるので、設定する
-				elf.symtbl.setSection(stmt.LSymbol(), stmt.Section())
 			}
 		}
 
+		if stmt.Opts().RVC() {
+			elf.rvc = true
+		}
+
 		if stmt.Dir() != nil {
 			elf.handleDirective(stmt)
-			off = calcSize(stmt)
+			off = calcSize(stmt, elf.sections.resolveOffset(stmt.Section()))
 		} else if stmt.Op() != nil {
-			// codeがtextセクション以外にあったらエラー
+			// codeがtextセクション以外にあったらエラー。その命令は置かずに続ける
 			if stmt.Section() != parse.Text {
-				return elf, fmt.Errorf("%d: Error: unknown pseudo-op:%s\n", stmt.Row(), stmt.Op().Opecode())
+				elf.errorAt(stmt, "unknown pseudo-op:%s", stmt.Op().Opecode())
+				continue
 			}
-			off = 4
-			section := elf.sections.entry[".text"]
-			section.stmts = append(section.stmts, stmt)
-			elf.sections.entry[".text"] = section
+			off = Elf32Addr(stmt.Op().Size())
+			elf.sections.appendStmt(".text", stmt)
 		}
 		elf.sections.advanceOffset(stmt.Section(), off)
 	}
 
+	elf.resolveInstructionAlign()
+	elf.resolveAttributes()
+	elf.resolveELFFlags()
+
 	// 2周目
 	// 外部シンボル解決
 	elf.resolveOperationSymbol()
+	if err := elf.err(); err != nil {
+		return elf, err
+	}
 	elf.resolveSymbolShndx()
+	// sh_infoより前のシンボルはすべてローカルでなければならない
+	elf.renumberRelaSymbols(elf.symtbl.sortLocalsFirst())
 	elf.ResolveSectionRayout() // section header table 作成
 	elf.resolveELFHeader()
 	return elf, nil
 }
 
+// 同じ名前のラベルを定義し直した。最初の定義の位置を補足に付ける
+func (e *Elf32) duplicateLabel(s parse.Stmt) {
+	d := e.report(s, s.LabelColumn(), diag.Error, "symbol `%q' is already defined", s.LSymbol())
+	if first, ok := e.labelStmts[s.LSymbol()]; ok {
+		d.Notes = append(d.Notes, fmt.Sprintf("`%s' was first defined at %s:%d", s.LSymbol(), first.File(), first.Row()))
+	}
+}
+
 func (e *Elf32) handleDirective(s parse.Stmt) {
 	switch s.Dir().Name() {
 	case ".section", ".text", ".data", ".rodata", ".bss":
+		e.addOptionalSection(s.Section())
 		// section symbolはnameを持たない
 		newSym := newSymbol(0, 0, 0, createSymInfo(STB_LOCAL, STT_SECTION), e.shdr.resolveShndx(s.Section()), s.Section())
 		// もしすでに存在していれば追加されない
@@ -106,6 +169,9 @@ func (e *Elf32) handleDirective(s parse.Stmt) {
 
 	case ".align":
 		e.shdr.setAddrAlign(s.Section(), s.Dir().Args()[0])
+		e.sections.setAlign(s.Section(), alignOf(s))
+		// パディングを出力するためにセクションに追加する
+		e.sections.appendStmt(s.Section(), s)
 		break
 
 	case ".file":
@@ -142,22 +208,17 @@ func (e *Elf32) handleDirective(s parse.Stmt) {
 		break
 
 	case ".string", ".asciz": // alias for string
-		section := s.Section()
-		if section == ".data" {
-			section := e.sections.entry[".data"]
-			section.stmts = append(section.stmts, s)
-			e.sections.entry[".data"] = section
-		} else if section == ".rodata" {
-			section := e.sections.entry[".rodata"]
-			section.stmts = append(section.stmts, s)
-			e.sections.entry[".rodata"] = section
+		if s.Section() == ".data" || s.Section() == ".rodata" {
+			e.sections.appendStmt(s.Section(), s)
 		}
 		break
 
 	case ".equ":
-		val, _ := strconv.Atoi(s.Dir().Args()[1])
+		val := parse.ImmValue(s.Dir().Args()[1])
 		if e.symtbl.exist(s.Dir().Args()[0]) {
+			// .globlなどで先に登録されたシンボルも、値を決めたら絶対シンボル
 			e.symtbl.setValue(s.Dir().Args()[0], Elf32Addr(val))
+			e.symtbl.setShndx(s.Dir().Args()[0], SHN_ABS)
 		} else {
 			newSym := newSymbol(e.strtbl.resolveIndex(s.Dir().Args()[0]), Elf32Addr(val), 0, createSymInfo(STB_LOCAL, STT_NOTYPE), SHN_ABS, "")
 			e.symtbl.addSymbol(newSym, s.Dir().Args()[0])
@@ -175,28 +236,71 @@ func (e *Elf32) handleDirective(s parse.Stmt) {
 		}
 		break
 
-	case ".byte", ".2byte", ".half", ".short", ".4byte", ".word":
-		if s.Section() == ".data" {
-			section := e.sections.entry[".data"]
-			section.stmts = append(section.stmts, s)
-			e.sections.entry[".data"] = section
-		} else if s.Section() == ".bss" {
-			section := e.sections.entry[".bss"]
-			section.stmts = append(section.stmts, s)
-			e.sections.entry[".bss"] = section
-		} else if s.Section() == ".rodata" {
-			section := e.sections.entry[".rodata"]
-			section.stmts = append(section.stmts, s)
-			e.sections.entry[".rodata"] = section
+	case ".attribute":
+		// タグと値の形式はパーサーで検証済み
+		tag, _ := strconv.Atoi(s.Dir().Args()[0])
+		val := s.Dir().Args()[1]
+		if parse.IsStringAttribute(tag) {
+			str, _ := strconv.Unquote(val)
+			e.attrOverrides = append(e.attrOverrides, NewAttribute(ULEB128(tag), str))
+		} else {
+			e.attrOverrides = append(e.attrOverrides, NewAttribute(ULEB128(tag), ULEB128(parse.ImmValue(val))))
 		}
 		break
+
+	case ".byte", ".2byte", ".half", ".short", ".4byte", ".word", ".zero":
+		// .textのジャンプテーブルなどのために、どのセクションにも置ける
+		e.sections.appendStmt(s.Section(), s)
+		break
+
+	case ".reloc":
+		// "."の位置を覚えておくためにセクションに追加する
+		e.sections.appendStmt(s.Section(), s)
+		break
+	}
+}
+
+// .alignで指定されたアラインメントのバイト数
+func alignOf(s parse.Stmt) Elf32Word {
+	n, _ := strconv.Atoi(s.Dir().Args()[0])
+	return Elf32Word(1) << n
+}
+
+/*
+緩和を許す.textの.alignは、リンカが命令を縮めても揃えられるよう、最大のパディングを置いてR_RISCV_ALIGNを付ける
+パディングはアラインメントから命令の最小の大きさを引いた分で、リンカが余りを取り除く
+アラインメントが命令の最小の大きさ以下なら緩和で崩れないので、普通に揃える
+*/
+func relaxedAlignPadding(s parse.Stmt) (Elf32Addr, bool) {
+	if s.Section() != parse.Text || !s.Opts().Relax() {
+		return 0, false
+	}
+	minInsn := Elf32Word(4)
+	if s.Opts().RVC() {
+		minInsn = 2
 	}
+	if alignOf(s) <= minInsn {
+		return 0, false
+	}
+	return Elf32Addr(alignOf(s) - minInsn), true
+}
+
+// .alignが置くパディングのバイト数。curはその文の直前のセクション内オフセット
+func alignSize(s parse.Stmt, cur Elf32Addr) Elf32Addr {
+	if pad, ok := relaxedAlignPadding(s); ok {
+		return pad
+	}
+	return alignPadding(cur, alignOf(s))
 }
 
-func calcSize(s parse.Stmt) Elf32Addr {
+// curはその文の直前のセクション内オフセット
+func calcSize(s parse.Stmt, cur Elf32Addr) Elf32Addr {
 	var off Elf32Addr = 0
 
 	switch s.Dir().Name() {
+	case ".align":
+		off = alignSize(s, cur)
+		break
 	case ".string", ".asciz": // alias for string
 		off = Elf32Addr(len(s.Dir().Args()[0]) - 2) // double quotationの分減らす
 		break
@@ -209,6 +313,10 @@ func calcSize(s parse.Stmt) Elf32Addr {
 	case ".4byte", ".word":
 		off = 4
 		break
+	case ".zero":
+		n, _ := strconv.Atoi(s.Dir().Args()[0])
+		off = Elf32Addr(n)
+		break
 	default:
 		break
 	}
@@ -216,45 +324,224 @@ func calcSize(s parse.Stmt) Elf32Addr {
 }
 
 // テーブル処理一週目の後に実行
-// 命令文中に出てくるシンボルを解決
+// 命令文中に出てくるシンボルを解決し、セクションごとに再配置を作る
 func (e *Elf32) resolveOperationSymbol() {
-	// .textセクションだけ見る
-	entry, exists := e.sections.entry[".text"]
-	if !exists {
+	for _, name := range e.shdr.names() {
+		entry, exists := e.sections.entry[name]
+		if !exists {
+			continue
+		}
+		for i, stmt := range entry.stmts {
+			if stmt.Dir() != nil {
+				e.resolveDirectiveReloc(name, stmt, entry.addrs[i])
+			} else {
+				e.resolveOperationReloc(name, stmt, entry.addrs[i])
+			}
+		}
+	}
+	e.createRelaSections()
+}
+
+// .reloc、緩和する.alignとラベルの差の再配置を作る
+func (e *Elf32) resolveDirectiveReloc(section string, stmt parse.Stmt, off Elf32Addr) {
+	if stmt.Dir().Name() == ".reloc" {
+		e.addRelocDirective(stmt, off)
 		return
 	}
-	var off Elf32Addr = 0
-	for _, stmt := range entry.stmts {
-		// 命令文中にシンボル名が使用されて場合、それがローカルのシンボルテーブル中に存在するか確認
-		symName := stmt.Op().RetIfSymbol()
-		if len(symName) > 0 {
-			// 存在しなければ外部シンボルなので外部シンボルとしてシンボルテーブルに追加する
-			if !e.symtbl.exist(symName) {
-				newSym := newSymbol(e.strtbl.resolveIndex(symName), 0, 0, createSymInfo(STB_GLOBAL, STT_NOTYPE), SHN_UNDEF, "")
-				e.symtbl.addSymbol(newSym, symName)
+	if stmt.Dir().Name() == ".align" {
+		// 加数はパディングのバイト数。シンボルは使わない
+		if pad, ok := relaxedAlignPadding(stmt); ok {
+			e.addRela(section, off, 0, ALIGN, Elf32Sword(pad))
+		}
+		return
+	}
+	if !e.checkLabelDiff(stmt) || !e.relocatesLabelDiff(stmt) {
+		return
+	}
+	end, start, _ := labelDiff(stmt)
+	// SHT_NOBITSのセクションには中身がないので再配置を適用できない
+	if e.shdr.shdrs[e.shdr.shndx[section]].ShType == SHTNobits {
+		e.errorAt(stmt, "can't resolve `%s' - `%s' in section `%s' with relaxation enabled", end, start, section)
+		return
+	}
+	typ := labelDiffRelocTypes[calcSize(stmt, off)]
+	e.addRela(section, off, e.symtbl.idx[end], typ[0], 0)
+	e.addRela(section, off, e.symtbl.idx[start], typ[1], 0)
+}
+
+// 命令文中にシンボル名が使用されていれば、その再配置を作る
+func (e *Elf32) resolveOperationReloc(section string, stmt parse.Stmt, off Elf32Addr) {
+	symName := stmt.Op().RetIfSymbol()
+	if len(symName) == 0 {
+		return
+	}
+	typ := resolveRelocType(*stmt.Op())
+	// .equの値は命令に畳み込むので再配置はいらない。%hi, %loを付けなければ値がそのまま入るか確かめる
+	if e.foldsAbsolute(*stmt.Op()) {
+		if stmt.Op().RelFunc() == "" {
+			if err := stmt.Op().ValidateSymbolValue(symName, int64(e.resolveImm(symName))); err != nil {
+				e.errorAt(stmt, "%s", err)
 			}
-			// 命令文中にシンボルが使用されていれば、リロケーションエントリを作成する
-			typ := resolveRelocType(*stmt.Op())
-			e.rela.addRelaEntry(off, e.symtbl.idx[symName], typ, 0)
-			e.rela.addRelaEntry(off, 0, RELAX, 0)
 		}
-		off += 4
-	}
-	if len(e.rela.entry) > 0 {
-		relaTextSection := Elf32Shdr{
-			ShName:      e.shstrtbl.resolveIndex(".rela.text"),
-			ShType:      SHTRela,
-			ShFlags:     SHFAlloc | SHFExecinstr,
-			ShAddr:      0,
-			ShOffset:    0,
-			ShSize:      0,
-			ShLink:      0,
-			ShInfo:      0,
-			ShAddralign: 4,
-			ShEntsize:   12,
+		return
+	}
+	// 存在しなければ外部シンボルなので外部シンボルとしてシンボルテーブルに追加する
+	// TLSの再配置で参照されるシンボルはスレッドローカルな変数
+	if !e.symtbl.exist(symName) {
+		symType := byte(STT_NOTYPE)
+		if tlsRelocs[typ] {
+			symType = STT_TLS
 		}
-		e.shdr.AddSection(relaTextSection, ".rela.text")
+		newSym := newSymbol(e.strtbl.resolveIndex(symName), 0, 0, createSymInfo(STB_GLOBAL, symType), SHN_UNDEF, "")
+		e.symtbl.addSymbol(newSym, symName)
 	}
+	// 位置独立なコードで置き換えられうるシンボルの絶対アドレスを使うと、共有ライブラリにリンクできない
+	if stmt.Opts().PIC() && absoluteRelocs[typ] && e.symtbl.preemptible(symName) {
+		e.warnAt(stmt, "absolute address of preemptible symbol `%s' used in position-independent code", symName)
+	}
+	e.addRela(section, off, e.symtbl.idx[symName], typ, 0)
+	// .option norelaxの範囲ではリンカに緩和させない
+	if e.relaxes(stmt, typ) || pcrelLoRelocs[typ] && e.relaxes(e.pcrelHiStmt(section, symName)) {
+		e.addRela(section, off, 0, RELAX, 0)
+	}
+}
+
+// %pcrel_loの再配置
+var pcrelLoRelocs = map[RelocType]bool{
+	PCREL_LO12_I: true,
+	PCREL_LO12_S: true,
+}
+
+// 命令の再配置にR_RISCV_RELAXを付けるか
+// %pcrel_loは参照するauipcの再配置に付けたときだけ付ける
+func (e *Elf32) relaxes(stmt parse.Stmt, typ RelocType) bool {
+	return stmt.Op() != nil && stmt.Opts().Relax() && relaxable[typ] && !pcrelLoRelocs[typ]
+}
+
+// %pcrel_loが参照するラベルの位置にあるauipcと、その再配置の種類を返す
+func (e *Elf32) pcrelHiStmt(section, label string) (parse.Stmt, RelocType) {
+	if e.symbolSection(label) != section {
+		return parse.Stmt{}, 0
+	}
+	addr := Elf32Addr(e.symtbl.symtbls[e.symtbl.idx[label]].value)
+	entry := e.sections.entry[section]
+	for i, stmt := range entry.stmts {
+		if entry.addrs[i] == addr && stmt.Op() != nil && stmt.Op().RetIfSymbol() != "" {
+			return stmt, resolveRelocType(*stmt.Op())
+		}
+	}
+	return parse.Stmt{}, 0
+}
+
+// データディレクティブの引数がラベルの差なら、その2つのラベルを返す
+func labelDiff(s parse.Stmt) (string, string, bool) {
+	if s.Dir() == nil || len(s.Dir().Args()) == 0 {
+		return "", "", false
+	}
+	switch s.Dir().Name() {
+	case ".byte", ".2byte", ".half", ".short", ".4byte", ".word":
+		return parse.LabelDiff(s.Dir().Args()[0])
+	}
+	return "", "", false
+}
+
+// ラベルの差は同じセクションで定義された2つのラベルの間でしか求められない
+func (e *Elf32) checkLabelDiff(s parse.Stmt) bool {
+	end, start, ok := labelDiff(s)
+	if !ok {
+		return true
+	}
+	endSec, startSec := e.symbolSection(end), e.symbolSection(start)
+	if endSec == "" || endSec != startSec {
+		e.errorAt(s, "can't resolve `%s' {%s section} - `%s' {%s section}", end, sectionName(endSec), start, sectionName(startSec))
+		return false
+	}
+	return true
+}
+
+// シンボルが定義されたセクション。未定義なら空文字列
+func (e *Elf32) symbolSection(name string) string {
+	if !e.symtbl.exist(name) {
+		return ""
+	}
+	return e.symtbl.symtbls[e.symtbl.idx[name]].section
+}
+
+func sectionName(section string) string {
+	if section == "" {
+		return "*UND*"
+	}
+	return section
+}
+
+/*
+ラベルの差を再配置の組 (R_RISCV_ADD*, R_RISCV_SUB*) で残すかどうか
+緩和が有効なら、.textの中の距離はリンカが命令を縮めると変わるので畳み込めない
+差を置くのが.data などでも、再配置はそのセクションの.rela<name>に入る
+*/
+func (e *Elf32) relocatesLabelDiff(s parse.Stmt) bool {
+	end, _, ok := labelDiff(s)
+	return ok && s.Opts().Relax() && e.symbolSection(end) == parse.Text
+}
+
+// データのバイト数ごとの、ラベルの差を表す再配置
+var labelDiffRelocTypes = map[Elf32Addr][2]RelocType{
+	1: {ADD8, SUB8},
+	2: {ADD16, SUB16},
+	4: {ADD32, SUB32},
+}
+
+// シンボルの絶対アドレスを命令に埋め込む再配置 (%hi, %lo)
+var absoluteRelocs = map[RelocType]bool{
+	HI20:   true,
+	LO12_I: true,
+	LO12_S: true,
+}
+
+// .equで定義した、どのセクションにも属さないシンボル
+func (e *Elf32) absoluteSymbol(name string) bool {
+	return e.symtbl.exist(name) && e.symtbl.symtbls[e.symtbl.idx[name]].shndx == SHN_ABS
+}
+
+// 命令が参照する絶対シンボルの値を、再配置を残さずエンコードに畳み込むか
+// 命令の位置によらない再配置だけで、分岐や%pcrel_hiなどはリンカに任せる
+func (e *Elf32) foldsAbsolute(op parse.Operation) bool {
+	return foldableRelocs[resolveRelocType(op)] && e.absoluteSymbol(op.RetIfSymbol())
+}
+
+var foldableRelocs = map[RelocType]bool{
+	NONE:   true,
+	HI20:   true,
+	LO12_I: true,
+	LO12_S: true,
+}
+
+// スレッドローカルな変数を参照する再配置
+var tlsRelocs = map[RelocType]bool{
+	TLS_GOT_HI20: true,
+	TLS_GD_HI20:  true,
+	TPREL_HI20:   true,
+	TPREL_LO12_I: true,
+	TPREL_LO12_S: true,
+	TPREL_ADD:    true,
+}
+
+// R_RISCV_RELAXを付けてよい再配置
+// 分岐やジャンプ、TLSのIE/GDモデルの再配置はpsABIで緩和の対象になっていない
+var relaxable = map[RelocType]bool{
+	CALL:         true,
+	CALL_PLT:     true,
+	GOT_HI20:     true,
+	PCREL_HI20:   true,
+	PCREL_LO12_I: true, // 参照するauipcが緩和されるときだけ
+	PCREL_LO12_S: true,
+	HI20:         true,
+	LO12_I:       true,
+	LO12_S:       true,
+	TPREL_HI20:   true,
+	TPREL_LO12_I: true,
+	TPREL_LO12_S: true,
+	TPREL_ADD:    true,
 }
 
 func (e *Elf32) resolveSymbolShndx() {
@@ -265,10 +552,50 @@ func (e *Elf32) resolveSymbolShndx() {
 		}
 		// shndxの値を設定し、テーブルに再代入する
 		sym.shndx = e.shdr.resolveShndx(sym.section)
+		// .tdata, .tbssのラベルはスレッドローカルな変数
+		if e.shdr.isTLS(sym.section) && sym.info&0x0F == STT_NOTYPE {
+			sym.info = createSymInfo(sym.info>>4, STT_TLS)
+		}
 		e.symtbl.symtbls[i] = sym
 	}
 }
 
+// RVCが有効な場合、命令は2byte境界に置かれるので.textのアラインメントを2にする
+// .alignで明示的に指定されていればそちらを優先する
+// また、使用した命令セットを.riscv.attributesのarch文字列に反映する
+func (e *Elf32) resolveInstructionAlign() {
+	if e.rvc {
+		if e.sections.entry[".text"].align == 0 {
+			e.shdr.shdrs[e.shdr.shndx[".text"]].ShAddralign = 2
+		}
+		e.arch = e.arch.With("c")
+	}
+	e.setArchAttribute(e.arch.String())
+}
+
+// 命令セットとABIからELFヘッダーのフラグを決める
+func (e *Elf32) resolveELFFlags() {
+	var flags Elf32Word
+	if e.arch.Has("c") {
+		flags |= EFRiscvRVC
+	}
+	switch e.abi.FloatLen() {
+	case 32:
+		flags |= EFRiscvFloatABISingle
+	case 64:
+		flags |= EFRiscvFloatABIDouble
+	default:
+		flags |= EFRiscvFloatABISoft
+	}
+	if e.abi.IsRVE() {
+		flags |= EFRiscvRVE
+	}
+	if e.arch.Has("ztso") {
+		flags |= EFRiscvTSO
+	}
+	e.ehdr.EFlags = flags
+}
+
 // ELFヘッダーの残りの変数を埋める
 func (e *Elf32) resolveELFHeader() {
 	e.ehdr.EShnum = Elf32Half(len(e.shdr.shdrs))            // sectionの数
@@ -23,6 +23,14 @@ const (
 	// ELFバージョン
 	EVNone    = 0 // 無効
 	EVCurrent = 1 // 現行バージョン
+
+	// プロセッサ特有のフラグ (RISC-V)
+	EFRiscvRVC            = 0x0001 // RVC命令を含む
+	EFRiscvFloatABISoft   = 0x0000 // 浮動小数点引数を整数レジスタで渡す
+	EFRiscvFloatABISingle = 0x0002 // 単精度の浮動小数点引数を浮動小数点レジスタで渡す
+	EFRiscvFloatABIDouble = 0x0004 // 倍精度までの浮動小数点引数を浮動小数点レジスタで渡す
+	EFRiscvRVE            = 0x0008 // RV32EのABI
+	EFRiscvTSO            = 0x0010 // RVTSOメモリモデル
 )
 
 // ELF32ヘッダー構造体
@@ -78,7 +86,7 @@ func (e *Elf32) initHeader() {
 		EEntry:     0, // always zero in EVRel
 		EPhoff:     0, // always zero in EVRel
 		EShoff:     0, // entrypoint of section header
-		EFlags:     0, // always zero in RV32I
+		EFlags:     0, // RV32Iでは0、拡張に応じて後で設定する
 		EEhsize:    Elf32Half(unsafe.Sizeof(Elf32Ehdr{})),
 		EPhentsize: 0,
 		EPhnum:     0,
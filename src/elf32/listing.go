@@ -0,0 +1,95 @@
+package elf32
+
+import "sort"
+
+// リスティングで命令の行に添える注記
+type ListingNote struct {
+	File string
+	Row  int
+	Text string
+}
+
+// アセンブル中に付けたリスティング用の注記を返す
+func (e *Elf32) ListingNotes() []ListingNote {
+	return e.listingNotes
+}
+
+// セクションに置いた1つの文の、リスティングに出す位置と中身
+type ListingLine struct {
+	File    string
+	Row     int
+	Section string
+	Addr    Elf32Addr
+	Bytes   []byte // 文が出力したバイト列。SHT_NOBITSのセクションでは空
+}
+
+/*
+セクションに置いた文ごとの位置と中身を、行番号の順に返す
+複数のソースの文は行番号で混ざるので、ソースごとに見るときはFileで分ける
+疑似命令を展開した命令列は、同じ行の文として続けて並ぶ
+ResolveSectionRayoutの後でなければ中身は分からない
+*/
+func (e *Elf32) Listing() []ListingLine {
+	var lines []ListingLine
+	for idx, name := range e.shdr.names() {
+		section, ok := e.sections.entry[name]
+		if !ok {
+			continue
+		}
+		payload := e.payloads[idx]
+		for i, stmt := range section.stmts {
+			line := ListingLine{File: stmt.File(), Row: stmt.Row(), Section: name, Addr: section.addrs[i]}
+			end := section.off
+			if i+1 < len(section.addrs) {
+				end = section.addrs[i+1]
+			}
+			if int(end) <= len(payload) {
+				line.Bytes = payload[line.Addr:end]
+			}
+			lines = append(lines, line)
+		}
+	}
+	// 同じ行の文は元の並びのままにする
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Row < lines[j].Row
+	})
+	return lines
+}
+
+// リスティングのシンボル一覧の1つ
+type ListingSymbol struct {
+	Name    string
+	Section string // 未定義のシンボルでは空
+	Value   Elf32Addr
+	File    string // ラベルを定義した位置。ラベルでなければ空
+	Row     int
+}
+
+// シンボルテーブルの名前のあるシンボルを、定義されたものと未定義のものに分けて返す
+func (e *Elf32) ListingSymbols() (defined, undefined []ListingSymbol) {
+	names := make([]string, 0, len(e.symtbl.idx))
+	for name, idx := range e.symtbl.idx {
+		// セクションと.fileのシンボルは一覧に出さない
+		typ := e.symtbl.symtbls[idx].info & 0x0F
+		if name != "" && typ != STT_SECTION && typ != STT_FILE {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return e.symtbl.idx[names[i]] < e.symtbl.idx[names[j]]
+	})
+
+	for _, name := range names {
+		sym := e.symtbl.symtbls[e.symtbl.idx[name]]
+		ls := ListingSymbol{Name: name, Section: sym.section, Value: sym.value}
+		if stmt, ok := e.labelStmts[name]; ok {
+			ls.File, ls.Row = stmt.File(), stmt.Row()
+		}
+		if sym.shndx == SHN_UNDEF {
+			undefined = append(undefined, ls)
+		} else {
+			defined = append(defined, ls)
+		}
+	}
+	return defined, undefined
+}
@@ -0,0 +1,65 @@
+package elf32
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ayase-mstk/go32as/src/diag"
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+/*
+PrepareElf32Tablesが返すエラー。見つけた全てのエラーを持つ
+メッセージはソースの名前を付けず行番号から始める。名前は呼び出し側が付ける
+errors.Asでdiag.Listや*diag.Diagnosticとしても取り出せる
+*/
+type Error struct {
+	Diagnostics diag.List
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	for _, d := range e.Diagnostics {
+		fmt.Fprintf(&b, "%d: %s: %s\n", d.Line, d.Severity, d.Message)
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error { return e.Diagnostics }
+
+// 文について見つけた診断を記録する。エラーが上限に達していれば、それ以上のエラーは捨てる
+func (e *Elf32) report(s parse.Stmt, column int, severity diag.Severity, format string, args ...interface{}) *diag.Diagnostic {
+	if severity == diag.Error && e.diags.Reached(e.maxErrors) {
+		return &diag.Diagnostic{}
+	}
+	e.diags = append(e.diags, diag.Diagnostic{
+		File:     s.File(),
+		Line:     s.Row(),
+		Column:   column,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+	return &e.diags[len(e.diags)-1]
+}
+
+func (e *Elf32) errorAt(s parse.Stmt, format string, args ...interface{}) {
+	e.report(s, s.Column(), diag.Error, format, args...)
+}
+
+func (e *Elf32) warnAt(s parse.Stmt, format string, args ...interface{}) {
+	e.report(s, s.Column(), diag.Warning, format, args...)
+}
+
+// 見つけたエラーがあればErrorにして返す
+func (e *Elf32) err() error {
+	var errs diag.List
+	for _, d := range e.diags {
+		if d.Severity == diag.Error {
+			errs = append(errs, d)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &Error{Diagnostics: errs}
+}
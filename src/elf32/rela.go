@@ -2,6 +2,8 @@ package elf32
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/ayase-mstk/go32as/src/parse"
 )
@@ -19,10 +21,10 @@ type Elf32Rela struct {
 
 func (r *Rela) printRela() {
 	for _, rela := range r.entry {
-		fmt.Printf("off=%q\n", rela.Off)
-		fmt.Printf("info.sym=%q\n", RelaSym(rela.Info))
-		fmt.Printf("info.typ=%q\n", RelaType(rela.Info))
-		fmt.Printf("addend=%q\n", rela.Addend)
+		fmt.Printf("off=%d\n", rela.Off)
+		fmt.Printf("info.sym=%d\n", RelaSym(rela.Info))
+		fmt.Printf("info.typ=%d\n", RelaType(rela.Info))
+		fmt.Printf("addend=%d\n", rela.Addend)
 	}
 }
 
@@ -49,7 +51,84 @@ func (r *Rela) addRelaEntry(offset Elf32Addr, symbolIdx int, relocType RelocType
 	r.entry = append(r.entry, entry)
 }
 
+// sectionに適用する再配置を追加する
+func (e *Elf32) addRela(section string, offset Elf32Addr, symbolIdx int, relocType RelocType, addend Elf32Sword) {
+	if e.rela == nil {
+		e.rela = make(map[string]Rela)
+	}
+	r := e.rela[section]
+	r.addRelaEntry(offset, symbolIdx, relocType, addend)
+	e.rela[section] = r
+}
+
+/*
+再配置のあるセクションごとに.rela<name>セクションを作る
+エントリはオフセット順に並べる。同じオフセットの再配置 (R_RISCV_RELAXやADD/SUBの組) は追加した順のまま
+*/
+func (e *Elf32) createRelaSections() {
+	for _, name := range e.shdr.names() {
+		r, exists := e.rela[name]
+		if !exists || len(r.entry) == 0 {
+			continue
+		}
+		sort.SliceStable(r.entry, func(i, j int) bool { return r.entry[i].Off < r.entry[j].Off })
+		relaSection := Elf32Shdr{
+			ShName:      e.shstrtbl.resolveIndex(".rela" + name),
+			ShType:      SHTRela,
+			ShFlags:     SHFInfoLink,
+			ShAddr:      0,
+			ShOffset:    0,
+			ShSize:      0,
+			ShLink:      0,
+			ShInfo:      0,
+			ShAddralign: 4,
+			ShEntsize:   12,
+		}
+		e.shdr.AddSection(relaSection, ".rela"+name)
+	}
+}
+
+// シンボルテーブルを並べ替えた後に、再配置が参照するシンボルのインデックスを付け直す
+func (e *Elf32) renumberRelaSymbols(moved map[int]int) {
+	for _, r := range e.rela {
+		for i, entry := range r.entry {
+			r.entry[i].Info = createRelaInfo(moved[int(RelaSym(entry.Info))], RelaType(entry.Info&0xff))
+		}
+	}
+}
+
+// .rela<name>セクションなら再配置を適用するセクションの名前を返す
+func relaTarget(name string) (string, bool) {
+	if !strings.HasPrefix(name, ".rela.") {
+		return "", false
+	}
+	return strings.TrimPrefix(name, ".rela"), true
+}
+
+// リロケーションファンクションと命令形式ごとの再配置の種類
+var relocFuncTypes = map[string]map[parse.OpecodeType]RelocType{
+	"%hi":              {parse.UType: HI20},
+	"%lo":              {parse.IType: LO12_I, parse.SType: LO12_S},
+	"%pcrel_hi":        {parse.UType: PCREL_HI20},
+	"%pcrel_lo":        {parse.IType: PCREL_LO12_I, parse.SType: PCREL_LO12_S},
+	"%got_pcrel_hi":    {parse.UType: GOT_HI20},
+	"%tprel_hi":        {parse.UType: TPREL_HI20},
+	"%tprel_lo":        {parse.IType: TPREL_LO12_I, parse.SType: TPREL_LO12_S},
+	"%tprel_add":       {parse.RType: TPREL_ADD},
+	"%tls_ie_pcrel_hi": {parse.UType: TLS_GOT_HI20},
+	"%tls_gd_pcrel_hi": {parse.UType: TLS_GD_HI20},
+	parse.CallRelFunc:  {parse.UType: CALL_PLT},
+}
+
 func resolveRelocType(op parse.Operation) RelocType {
+	if op.RelFunc() != "" {
+		// 命令形式との組み合わせはパーサーで検証済み
+		return relocFuncTypes[op.RelFunc()][op.OpcType()]
+	}
+	// 命令の定義でリロケーションファンクションが指定されていればそれを使う
+	if spec, exists := parse.LookupInstruction(op.Opecode()); exists && spec.Reloc != "" {
+		return relocFuncTypes[spec.Reloc][op.OpcType()]
+	}
 	switch op.OpcType() {
 	case parse.JType:
 		return JAL
@@ -57,29 +136,12 @@ func resolveRelocType(op parse.Operation) RelocType {
 	case parse.BType:
 		return BRANCH
 
-	case parse.UType:
-		if op.RelFunc() == "%hi" {
-			return HI20
-		} else if op.RelFunc() == "%pcrel_hi" {
-			return PCREL_HI20
-		}
-		break
+	case parse.CJType:
+		return RVC_JUMP
 
-	case parse.IType:
-		if op.RelFunc() == "%lo" {
-			return LO12_I
-		} else if op.RelFunc() == "%pcrel_lo" {
-			return PCREL_LO12_I
-		}
-		break
+	case parse.CBType:
+		return RVC_BRANCH
 
-	case parse.SType:
-		if op.RelFunc() == "%lo" {
-			return LO12_S
-		} else if op.RelFunc() == "%pcrel_lo" {
-			return PCREL_LO12_S
-		}
-		break
 	default:
 		break
 	}
@@ -153,6 +215,118 @@ const (
 	SET8        // 54: 8-bit local label assignment
 	SET16       // 55: 16-bit local label assignment
 	SET32       // 56: 32-bit local label assignment
+	R32_PCREL   // 57: 32-bit PC relative
 	IRELATIVE   // 58: Relocation against non-preemptible ifunc symbol
 	PLT32       // 59: 32-bit relative offset to a function or its PLT entry
 )
+
+// .relocで名前で指定できる再配置
+var relocTypeNames = map[string]RelocType{
+	"R_RISCV_NONE":         NONE,
+	"R_RISCV_32":           R32,
+	"R_RISCV_64":           R64,
+	"R_RISCV_RELATIVE":     RELATIVE,
+	"R_RISCV_COPY":         COPY,
+	"R_RISCV_JUMP_SLOT":    JUMP_SLOT,
+	"R_RISCV_TLS_DTPMOD32": TLS_DTPMOD32,
+	"R_RISCV_TLS_DTPMOD64": TLS_DTPMOD64,
+	"R_RISCV_TLS_DTPREL32": TLS_DTPREL32,
+	"R_RISCV_TLS_DTPREL64": TLS_DTPREL64,
+	"R_RISCV_TLS_TPREL32":  TLS_TPREL32,
+	"R_RISCV_TLS_TPREL64":  TLS_TPREL64,
+	"R_RISCV_TLSDESC":      TLSDESC,
+	"R_RISCV_BRANCH":       BRANCH,
+	"R_RISCV_JAL":          JAL,
+	"R_RISCV_CALL":         CALL,
+	"R_RISCV_CALL_PLT":     CALL_PLT,
+	"R_RISCV_GOT_HI20":     GOT_HI20,
+	"R_RISCV_TLS_GOT_HI20": TLS_GOT_HI20,
+	"R_RISCV_TLS_GD_HI20":  TLS_GD_HI20,
+	"R_RISCV_PCREL_HI20":   PCREL_HI20,
+	"R_RISCV_PCREL_LO12_I": PCREL_LO12_I,
+	"R_RISCV_PCREL_LO12_S": PCREL_LO12_S,
+	"R_RISCV_HI20":         HI20,
+	"R_RISCV_LO12_I":       LO12_I,
+	"R_RISCV_LO12_S":       LO12_S,
+	"R_RISCV_TPREL_HI20":   TPREL_HI20,
+	"R_RISCV_TPREL_LO12_I": TPREL_LO12_I,
+	"R_RISCV_TPREL_LO12_S": TPREL_LO12_S,
+	"R_RISCV_TPREL_ADD":    TPREL_ADD,
+	"R_RISCV_ADD8":         ADD8,
+	"R_RISCV_ADD16":        ADD16,
+	"R_RISCV_ADD32":        ADD32,
+	"R_RISCV_ADD64":        ADD64,
+	"R_RISCV_SUB8":         SUB8,
+	"R_RISCV_SUB16":        SUB16,
+	"R_RISCV_SUB32":        SUB32,
+	"R_RISCV_SUB64":        SUB64,
+	"R_RISCV_GOT32_PCREL":  GOT32_PCREL,
+	"R_RISCV_ALIGN":        ALIGN,
+	"R_RISCV_RVC_BRANCH":   RVC_BRANCH,
+	"R_RISCV_RVC_JUMP":     RVC_JUMP,
+	"R_RISCV_RELAX":        RELAX,
+	"R_RISCV_SUB6":         SUB6,
+	"R_RISCV_SET6":         SET6,
+	"R_RISCV_SET8":         SET8,
+	"R_RISCV_SET16":        SET16,
+	"R_RISCV_SET32":        SET32,
+	"R_RISCV_32_PCREL":     R32_PCREL,
+	"R_RISCV_IRELATIVE":    IRELATIVE,
+	"R_RISCV_PLT32":        PLT32,
+}
+
+// .relocの再配置の種類を名前か番号から決める
+func lookupRelocType(val string) (RelocType, bool) {
+	if parse.IsImmediate(val) {
+		n := parse.ImmValue(val)
+		return RelocType(n), 0 <= n && n <= 0xff
+	}
+	typ, ok := relocTypeNames[val]
+	return typ, ok
+}
+
+/*
+.reloc offset, type[, symbol+addend] の再配置を追加する
+addrはその行の位置で、offsetの"."はこの値になる。offsetはセクションの中を指していなければならない
+*/
+func (e *Elf32) addRelocDirective(stmt parse.Stmt, addr Elf32Addr) {
+	args := stmt.Dir().Args()
+	section := stmt.Section()
+
+	base, off, _ := parse.SymbolAddend(args[0])
+	switch {
+	case base == ".":
+		off += int64(addr)
+	case base != "":
+		idx, exists := e.symtbl.idx[base]
+		if !exists || e.symtbl.symtbls[idx].section != section {
+			e.errorAt(stmt, ".reloc offset `%s' is not in section `%s'", args[0], section)
+			return
+		}
+		off += int64(e.symtbl.symtbls[idx].value)
+	}
+	if off < 0 || off > int64(e.sections.resolveOffset(section)) {
+		e.errorAt(stmt, ".reloc offset %d is outside section `%s'", off, section)
+		return
+	}
+
+	typ, ok := lookupRelocType(args[1])
+	if !ok {
+		e.errorAt(stmt, "unknown relocation type `%s'", args[1])
+		return
+	}
+
+	symIdx, addend := 0, int64(0)
+	if len(args) == 3 {
+		var sym string
+		sym, addend, _ = parse.SymbolAddend(args[2])
+		if sym != "" {
+			if !e.symtbl.exist(sym) {
+				newSym := newSymbol(e.strtbl.resolveIndex(sym), 0, 0, createSymInfo(STB_GLOBAL, STT_NOTYPE), SHN_UNDEF, "")
+				e.symtbl.addSymbol(newSym, sym)
+			}
+			symIdx = e.symtbl.idx[sym]
+		}
+	}
+	e.addRela(section, Elf32Addr(off), symIdx, typ, Elf32Sword(addend))
+}
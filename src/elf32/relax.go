@@ -0,0 +1,73 @@
+package elf32
+
+import (
+	"fmt"
+
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+// B形式の分岐で届くオフセットの範囲
+const (
+	branchMin = -4096
+	branchMax = 4094
+)
+
+/*
+.textの条件分岐のうち、飛び先が.textのラベルで範囲に収まらないものを、反転した分岐とjalの組に置き換える
+置き換えると後ろのアドレスがずれて別の分岐が範囲外になりうるので、置き換えがなくなるまでレイアウトをやり直す
+命令列は伸びるだけなので、各分岐は高々1回しか置き換わらず必ず収束する
+*/
+func (e *Elf32) relaxBranches(stmts []parse.Stmt) []parse.Stmt {
+	for {
+		labels, addrs := layoutText(stmts)
+		relaxed := make([]parse.Stmt, 0, len(stmts))
+		changed := false
+		for i, stmt := range stmts {
+			target, ok := stmt.BranchTarget()
+			if !ok {
+				relaxed = append(relaxed, stmt)
+				continue
+			}
+			to, defined := labels[target]
+			offset := int64(to) - int64(addrs[i])
+			if !defined || (branchMin <= offset && offset <= branchMax) {
+				relaxed = append(relaxed, stmt)
+				continue
+			}
+			relaxed = append(relaxed, stmt.RelaxBranch()...)
+			e.listingNotes = append(e.listingNotes, ListingNote{
+				File: stmt.File(),
+				Row:  stmt.Row(),
+				Text: fmt.Sprintf("branch to `%s' out of range, relaxed to inverted branch and jal", target),
+			})
+			changed = true
+		}
+		stmts = relaxed
+		if !changed {
+			return stmts
+		}
+	}
+}
+
+// .textの各文のアドレスと、.textに定義されたラベルのアドレスを求める
+// 1周目と同じ規則で、他のセクションの文は飛ばす
+func layoutText(stmts []parse.Stmt) (map[string]Elf32Addr, []Elf32Addr) {
+	labels := map[string]Elf32Addr{}
+	addrs := make([]Elf32Addr, len(stmts))
+	var off Elf32Addr
+	for i, stmt := range stmts {
+		if stmt.Section() != parse.Text {
+			continue
+		}
+		addrs[i] = off
+		if stmt.LSymbol() != "" {
+			labels[stmt.LSymbol()] = off
+		}
+		if stmt.Dir() != nil {
+			off += calcSize(stmt, off)
+		} else if stmt.Op() != nil {
+			off += Elf32Addr(stmt.Op().Size())
+		}
+	}
+	return labels, addrs
+}
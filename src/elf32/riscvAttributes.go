@@ -1,22 +1,12 @@
 package elf32
 
 import (
-	"unsafe"
+	"encoding/binary"
 )
 
 // uleb128 (Unsigned LEB128) は可変長エンコーディングをサポートするため、カスタムの型や関数で表現します。
 type ULEB128 uint64
 
-// ULEB128 のサイズを計算するためのヘルパー関数
-func uleb128Size(value ULEB128) Elf32Word {
-	size := 0
-	for value >= 0x80 {
-		size++
-		value >>= 7
-	}
-	return Elf32Word(size + 1) // 最後の1バイトを加算
-}
-
 // .riscv.attributes section.
 type Elf32Attributes struct {
 	FormatVersion  byte            // The format version (e.g., 'A')
@@ -52,59 +42,55 @@ type RISCVAttributes struct {
 	X3RegUsage      ULEB128 // Tag 16, uleb128, usage of x3/gp register
 }
 
+// Tag_RISCV_* の値
+const (
+	TagFile                  ULEB128 = 1
+	TagRiscvStackAlign       ULEB128 = 4
+	TagRiscvArch             ULEB128 = 5
+	TagRiscvUnalignedAccess  ULEB128 = 6
+	TagRiscvPrivSpec         ULEB128 = 8
+	TagRiscvPrivSpecMinor    ULEB128 = 10
+	TagRiscvPrivSpecRevision ULEB128 = 12
+	TagRiscvAtomicABI        ULEB128 = 14
+	TagRiscvX3RegUsage       ULEB128 = 16
+)
+
 // Helper function to create a new attribute (for example, for stack alignment).
 func NewAttribute(tag ULEB128, value interface{}) Attribute {
 	return Attribute{Tag: tag, Value: value}
 }
 
-// CalculateLength はサブサブセクションの正確な Length を計算します
-func (s *SubSubSection) CalculateLength() Elf32Word {
-	length := Elf32Word(0)
-
-	// タグのサイズ (ULEB128) を計算
-	length += uleb128Size(s.Tag)
-
-	// 各属性のサイズを計算
-	for _, attr := range s.Attributes {
-		// タグのサイズ (ULEB128)
-		length += uleb128Size(attr.Tag)
-
-		// 値のサイズ (ULEB128 または NTBS)
-		switch v := attr.Value.(type) {
-		case ULEB128:
-			length += uleb128Size(v)
-		case string:
-			length += Elf32Word(len(v)) + 1 // NTBS の長さ + 終端の null バイト
-		}
-	}
-
-	return length
-}
-
 // Helper function to create a new vendor section.
+// Lengthは実際に出力するバイト列から計算する
 func NewVendorSection(name string, attributes []Attribute) VendorSection {
 	subSection := SubSubSection{
-		Tag: 1, // Tag_file, relating to the whole file
-		//Length:     uint32(len(attributes) * 8), // Placeholder for sub-sub-section length
+		Tag:        TagFile, // Tag_file, relating to the whole file
 		Attributes: attributes,
 	}
-	subSection.Length = subSection.CalculateLength()
-	return VendorSection{
-		Length:         Elf32Word(len(attributes)*8 + len(name) + 1),
+	subSection.Length = subSection.CalculateSize()
+	vendor := VendorSection{
 		VendorName:     name,
 		SubSubSections: []SubSubSection{subSection},
 	}
+	vendor.Length = vendor.CalculateSize()
+	return vendor
 }
 
 // Example usage
 func (e *Elf32) initAttributes() {
+	// ilp32eではスタックは4byte境界に揃える
+	stackAlign := ULEB128(16)
+	if e.abi.IsRVE() {
+		stackAlign = 4
+	}
+
 	// Define some example attributes
 	attrs := []Attribute{
-		NewAttribute(4, ULEB128(16)), // Stack alignment: 16 bytes
-		NewAttribute(5, "rv32i2p1"),  // Architecture: RV32I
-		NewAttribute(6, ULEB128(0)),  // Unaligned access: not allowed
-		NewAttribute(14, ULEB128(0)), // Atomic ABI: no
-		NewAttribute(16, ULEB128(0)), // x3 register usage: default usage
+		NewAttribute(TagRiscvStackAlign, stackAlign),      // Stack alignment: 16 bytes (ilp32eは4 bytes)
+		NewAttribute(TagRiscvArch, e.arch.String()),       // Architecture: -marchで指定された命令セット
+		NewAttribute(TagRiscvUnalignedAccess, ULEB128(0)), // Unaligned access: not allowed
+		NewAttribute(TagRiscvAtomicABI, ULEB128(0)),       // Atomic ABI: no
+		NewAttribute(TagRiscvX3RegUsage, ULEB128(0)),      // x3 register usage: default usage
 	}
 
 	// Create a vendor section for "riscv"
@@ -117,44 +103,99 @@ func (e *Elf32) initAttributes() {
 	}
 }
 
-// CalculateSize calculates the size of an Attribute in bytes.
-func (attr *Attribute) CalculateSize() Elf32Word {
-	size := Elf32Word(unsafe.Sizeof(attr.Tag)) // タグのサイズ
+// Tag_RISCV_arch の値を置き換え、長さを計算し直す
+func (e *Elf32) setArchAttribute(arch string) {
+	e.setAttribute(NewAttribute(TagRiscvArch, arch))
+}
+
+// 属性の値を置き換える。まだなければタグの順になるように追加する
+// 長さとセクションサイズも計算し直す
+func (e *Elf32) setAttribute(attr Attribute) {
+	riscvVendor := e.attr.VendorSections[0]
+	attrs := riscvVendor.SubSubSections[0].Attributes
+	i := 0
+	for i < len(attrs) && attrs[i].Tag < attr.Tag {
+		i++
+	}
+	if i < len(attrs) && attrs[i].Tag == attr.Tag {
+		attrs[i] = attr
+	} else {
+		attrs = append(attrs[:i], append([]Attribute{attr}, attrs[i:]...)...)
+	}
+	e.attr.VendorSections[0] = NewVendorSection(riscvVendor.VendorName, attrs)
+	e.shdr.setSize(".riscv.attributes", e.attr.CalculateSize())
+}
+
+// .attributeで指定された属性で既定値を上書きする
+// Tag_RISCV_archは-marchから決まる値より優先する
+func (e *Elf32) resolveAttributes() {
+	for _, attr := range e.attrOverrides {
+		e.setAttribute(attr)
+	}
+}
+
+// タグと値をULEB128、またはNTBSでエンコードする
+func (attr *Attribute) encode() []byte {
+	b := encodeULEB128(attr.Tag)
 	switch v := attr.Value.(type) {
 	case ULEB128:
-		size += uleb128Size(v) // ULEB128 の値サイズ
+		b = append(b, encodeULEB128(v)...)
 	case string:
-		size += Elf32Word(len(v)) + 1 // 文字列の長さ + 終端の null バイト
+		b = append(b, v...)
+		b = append(b, 0) // 終端の null バイト
 	}
-	return size
+	return b
 }
 
-// CalculateSize calculates the size of a SubSubSection in bytes.
-func (sss *SubSubSection) CalculateSize() Elf32Word {
-	size := Elf32Word(unsafe.Sizeof(sss.Tag))    // サブサブセクションタグのサイズ
-	size += Elf32Word(unsafe.Sizeof(sss.Length)) // Length フィールドのサイズ (4 bytes)
+// タグ、長さ(4byte)、属性の並びの順にエンコードする
+// 長さはタグと長さ自身を含む
+func (sss *SubSubSection) encode() []byte {
+	var body []byte
 	for _, attr := range sss.Attributes {
-		size += attr.CalculateSize() // 各属性のサイズ
+		body = append(body, attr.encode()...)
 	}
-	return size
+	b := encodeULEB128(sss.Tag)
+	length := Elf32Word(len(b) + 4 + len(body))
+	b = binary.LittleEndian.AppendUint32(b, uint32(length))
+	return append(b, body...)
 }
 
-// CalculateSize calculates the size of a VendorSection in bytes.
-func (vs *VendorSection) CalculateSize() Elf32Word {
-	size := Elf32Word(unsafe.Sizeof(vs.Length)) // Length フィールドのサイズ (4 bytes)
-	size += Elf32Word(len(vs.VendorName)) + 1   // Vendor name のサイズ (NTBS)
-
+// 長さ(4byte)、ベンダー名(NTBS)、サブサブセクションの並びの順にエンコードする
+// 長さは長さ自身を含む
+func (vs *VendorSection) encode() []byte {
+	body := append([]byte(vs.VendorName), 0)
 	for _, sub := range vs.SubSubSections {
-		size += sub.CalculateSize() // 各サブサブセクションのサイズ
+		body = append(body, sub.encode()...)
 	}
-	return size
+	b := binary.LittleEndian.AppendUint32(nil, uint32(4+len(body)))
+	return append(b, body...)
 }
 
-// CalculateSize calculates the total size of the Elf32Attributes section in bytes.
-func (as *Elf32Attributes) CalculateSize() Elf32Word {
-	size := Elf32Word(unsafe.Sizeof(as.FormatVersion)) // フォーマットバージョン (1 byte)
+// .riscv.attributes セクション全体をエンコードする
+func (as *Elf32Attributes) encode() []byte {
+	b := []byte{as.FormatVersion}
 	for _, vendor := range as.VendorSections {
-		size += vendor.CalculateSize() // 各ベンダーセクションのサイズ
+		b = append(b, vendor.encode()...)
 	}
-	return size
+	return b
+}
+
+// CalculateSize calculates the size of an Attribute in bytes.
+func (attr *Attribute) CalculateSize() Elf32Word {
+	return Elf32Word(len(attr.encode()))
+}
+
+// CalculateSize calculates the size of a SubSubSection in bytes.
+func (sss *SubSubSection) CalculateSize() Elf32Word {
+	return Elf32Word(len(sss.encode()))
+}
+
+// CalculateSize calculates the size of a VendorSection in bytes.
+func (vs *VendorSection) CalculateSize() Elf32Word {
+	return Elf32Word(len(vs.encode()))
+}
+
+// CalculateSize calculates the total size of the Elf32Attributes section in bytes.
+func (as *Elf32Attributes) CalculateSize() Elf32Word {
+	return Elf32Word(len(as.encode()))
 }
@@ -9,7 +9,39 @@ type Elf32Sections struct {
 
 type Section struct {
 	stmts []parse.Stmt
-	off   Elf32Addr // section 内のオフセット
+	addrs []Elf32Addr // stmtsと同じ並びで、各文のsection 内のオフセット
+	off   Elf32Addr   // section 内のオフセット
+	align Elf32Word   // .alignで指定された最大のアラインメント
+}
+
+// 現在のオフセットと一緒に文をセクションに追加する
+func (s *Elf32Sections) appendStmt(name string, stmt parse.Stmt) {
+	if s.entry == nil {
+		s.entry = make(map[string]Section)
+	}
+	section := s.entry[name]
+	section.stmts = append(section.stmts, stmt)
+	section.addrs = append(section.addrs, section.off)
+	s.entry[name] = section
+}
+
+func (s *Elf32Sections) setAlign(name string, align Elf32Word) {
+	if s.entry == nil {
+		s.entry = make(map[string]Section)
+	}
+	section := s.entry[name]
+	if align > section.align {
+		section.align = align
+	}
+	s.entry[name] = section
+}
+
+// offをalignの倍数に揃えるのに必要なパディングのバイト数
+func alignPadding(off Elf32Addr, align Elf32Word) Elf32Addr {
+	if align == 0 {
+		return 0
+	}
+	return Elf32Addr((Elf32Word(off)+align-1)/align*align) - off
 }
 
 func (s *Elf32Sections) resolveOffset(name string) Elf32Addr {
@@ -25,11 +25,25 @@ const (
 
 // セクションフラグ
 const (
-	SHFWrite     = 0x1 // セクションが書き込み可能
-	SHFAlloc     = 0x2 // セクションがメモリにロードされる
-	SHFExecinstr = 0x4 // セクションが実行可能な命令を含む
+	SHFWrite     = 0x1   // セクションが書き込み可能
+	SHFAlloc     = 0x2   // セクションがメモリにロードされる
+	SHFExecinstr = 0x4   // セクションが実行可能な命令を含む
+	SHFInfoLink  = 0x40  // sh_infoがセクションヘッダーのインデックスを持つ
+	SHFTLS       = 0x400 // セクションがスレッドローカルなデータを持つ
 )
 
+// .sectionで使われたときに作るセクション。この順に配置する
+// .text, .data, .bssは最初から作っておく
+var optionalSections = []struct {
+	name  string
+	typ   Elf32Word
+	flags Elf32Word
+}{
+	{".rodata", SHTProgbits, SHFAlloc},
+	{".tdata", SHTProgbits, SHFWrite | SHFAlloc | SHFTLS},
+	{".tbss", SHTNobits, SHFWrite | SHFAlloc | SHFTLS},
+}
+
 // ELF32セクションヘッダー構造体
 type Elf32Shdr struct {
 	ShName      Elf32Word // セクション名（文字列テーブルインデックス）
@@ -104,7 +118,7 @@ func (e *Elf32) initSectionHeader() {
 		ShType:      SHTProgbits,
 		ShFlags:     SHFAlloc | SHFExecinstr,
 		ShAddr:      0,
-		ShOffset:    0x34,
+		ShOffset:    0,
 		ShSize:      0,
 		ShLink:      0,
 		ShInfo:      0,
@@ -198,6 +212,46 @@ func (e *Elf32) initSectionHeader() {
 	e.shdr.AddSection(shstrSection, ".shstrtab")
 }
 
+// .sectionで使われたセクションのヘッダーを追加する
+func (e *Elf32) addOptionalSection(name string) {
+	if _, exists := e.shdr.shndx[name]; exists {
+		return
+	}
+	for _, sec := range optionalSections {
+		if sec.name != name {
+			continue
+		}
+		shdr := Elf32Shdr{
+			ShName:      e.shstrtbl.resolveIndex(name),
+			ShType:      sec.typ,
+			ShFlags:     sec.flags,
+			ShAddr:      0,
+			ShOffset:    0,
+			ShSize:      0,
+			ShLink:      0,
+			ShInfo:      0,
+			ShAddralign: 4,
+			ShEntsize:   0,
+		}
+		e.shdr.AddSection(shdr, name)
+	}
+}
+
+// セクションヘッダーの並び順のセクション名
+func (s *Shdr) names() []string {
+	names := make([]string, len(s.shdrs))
+	for name, idx := range s.shndx {
+		names[idx] = name
+	}
+	return names
+}
+
+// スレッドローカルなデータのセクションかどうか
+func (s *Shdr) isTLS(name string) bool {
+	idx, exists := s.shndx[name]
+	return exists && s.shdrs[idx].ShFlags&SHFTLS != 0
+}
+
 func (s *Shdr) setAddrAlign(name, alignStr string) {
 	idx := s.shndx[name]
 	align, _ := strconv.Atoi(alignStr)
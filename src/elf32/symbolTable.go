@@ -161,6 +161,13 @@ func (s *Symtbl) setSection(name, section string) {
 	s.symtbls[id].section = section
 }
 
+// リンク時に他のモジュールの定義で置き換えられうるシンボルかどうか
+// ローカルでないシンボル(未定義の外部シンボルを含む)が該当する
+func (s *Symtbl) preemptible(name string) bool {
+	id, exists := s.idx[name]
+	return exists && s.symtbls[id].info>>4 != STB_LOCAL
+}
+
 func (s *Symtbl) printSymbolTable(strtbl Elf32Strtbl) {
 	for _, sym := range s.symtbls {
 		end := int(sym.name)
@@ -178,6 +185,33 @@ func (s *Symtbl) printSymbolTable(strtbl Elf32Strtbl) {
 	}
 }
 
+/*
+ローカルシンボルをグローバルシンボルより前に並べ替える
+それぞれの中では追加した順のまま。並べ替える前と後のインデックスの対応を返す
+*/
+func (s *Symtbl) sortLocalsFirst() map[int]int {
+	order := make([]int, 0, len(s.symtbls))
+	for _, local := range []bool{true, false} {
+		for i, sym := range s.symtbls {
+			if (sym.info>>4 == STB_LOCAL) == local {
+				order = append(order, i)
+			}
+		}
+	}
+
+	moved := make(map[int]int, len(order))
+	symtbls := make([]Elf32SymtblEntry, len(order))
+	for newIdx, oldIdx := range order {
+		symtbls[newIdx] = s.symtbls[oldIdx]
+		moved[oldIdx] = newIdx
+	}
+	s.symtbls = symtbls
+	for name, idx := range s.idx {
+		s.idx[name] = moved[idx]
+	}
+	return moved
+}
+
 func (s *Symtbl) calcLastLocalSymIdx() Elf32Word {
 	last := 0
 	for i, sym := range s.symtbls {
@@ -0,0 +1,52 @@
+package isa
+
+import "fmt"
+
+// -mabi で指定された呼び出し規約
+type ABI struct {
+	name string
+	flen int  // 浮動小数点引数を渡すレジスタの幅。0ならsoft-float
+	rve  bool // ilp32e
+}
+
+var abis = map[string]ABI{
+	"ilp32":  {name: "ilp32"},
+	"ilp32f": {name: "ilp32f", flen: 32},
+	"ilp32d": {name: "ilp32d", flen: 64},
+	"ilp32e": {name: "ilp32e", rve: true},
+}
+
+func (a ABI) Name() string   { return a.name }
+func (a ABI) FloatLen() int  { return a.flen }
+func (a ABI) IsRVE() bool    { return a.rve }
+func (a ABI) String() string { return a.name }
+
+// -mabi が指定されなかった場合は、命令セットから決める
+func DefaultABI(arch ISA) ABI {
+	switch {
+	case arch.Has("e"):
+		return abis["ilp32e"]
+	case arch.Has("d"):
+		return abis["ilp32d"]
+	case arch.Has("f"):
+		return abis["ilp32f"]
+	}
+	return abis["ilp32"]
+}
+
+// -mabi の文字列を解釈し、命令セットと矛盾しないか見る
+func ParseABI(mabi string, arch ISA) (ABI, error) {
+	abi, exists := abis[mabi]
+	if !exists {
+		return ABI{}, fmt.Errorf("-mabi=%s: unknown ABI", mabi)
+	}
+	switch {
+	case abi.flen == 64 && !arch.Has("d"):
+		return ABI{}, fmt.Errorf("-mabi=%s: ABI requires the `d' extension", mabi)
+	case abi.flen == 32 && !arch.Has("f"):
+		return ABI{}, fmt.Errorf("-mabi=%s: ABI requires the `f' extension", mabi)
+	case arch.Has("e") && !abi.rve:
+		return ABI{}, fmt.Errorf("-mabi=%s: rv32e requires the ilp32e ABI", mabi)
+	}
+	return abi, nil
+}
@@ -0,0 +1,351 @@
+package isa
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 拡張のバージョン
+type Version struct {
+	Major int
+	Minor int
+}
+
+// 対応している拡張と、バージョンが省略されたときに使うバージョン
+var extensionVersions = map[string]Version{
+	"i": {2, 1},
+	"e": {2, 0},
+	"m": {2, 0},
+	"a": {2, 1},
+	"f": {2, 2},
+	"d": {2, 2},
+	"c": {2, 0},
+
+	"v": {1, 0},
+
+	"zicsr":       {2, 0},
+	"zifencei":    {2, 0},
+	"zihintpause": {2, 0},
+	"zmmul":       {1, 0},
+	"ztso":        {1, 0},
+
+	// Bit-manipulation
+	"zba": {1, 0},
+	"zbb": {1, 0},
+	"zbc": {1, 0},
+	"zbs": {1, 0},
+
+	// Scalar cryptography
+	"zbkb":  {1, 0},
+	"zbkc":  {1, 0},
+	"zbkx":  {1, 0},
+	"zk":    {1, 0},
+	"zkn":   {1, 0},
+	"zknd":  {1, 0},
+	"zkne":  {1, 0},
+	"zknh":  {1, 0},
+	"zkr":   {1, 0},
+	"zks":   {1, 0},
+	"zksed": {1, 0},
+	"zksh":  {1, 0},
+	"zkt":   {1, 0},
+
+	// Vector
+	"zve32x":  {1, 0},
+	"zve32f":  {1, 0},
+	"zve64x":  {1, 0},
+	"zve64f":  {1, 0},
+	"zve64d":  {1, 0},
+	"zvl32b":  {1, 0},
+	"zvl64b":  {1, 0},
+	"zvl128b": {1, 0},
+}
+
+// 拡張を指定したときに一緒に有効になる拡張
+var impliedExtensions = map[string][]string{
+	"m":       {"zmmul"},
+	"d":       {"f"},
+	"f":       {"zicsr"},
+	"v":       {"d", "zve64d", "zvl128b"},
+	"zk":      {"zkn", "zkr", "zkt"},
+	"zkn":     {"zbkb", "zbkc", "zbkx", "zkne", "zknd", "zknh"},
+	"zks":     {"zbkb", "zbkc", "zbkx", "zksed", "zksh"},
+	"zve64d":  {"d", "zve64f"},
+	"zve64f":  {"zve32f", "zve64x"},
+	"zve64x":  {"zve32x", "zvl64b"},
+	"zve32f":  {"f", "zve32x"},
+	"zve32x":  {"zicsr", "zvl32b"},
+	"zvl128b": {"zvl64b"},
+	"zvl64b":  {"zvl32b"},
+}
+
+// gはimafd_zicsr_zifenceiの省略形
+var generalExtensions = []string{"i", "m", "a", "f", "d", "zicsr", "zifencei"}
+
+// 1文字の拡張の正規の並び順
+const canonicalOrder = "imafdqlcbkjtpvnh"
+
+// -march で指定された命令セット
+type ISA struct {
+	xlen     int
+	exts     []string           // 正規の順に並んだ拡張名。基本ISAの"i"か"e"も含む
+	versions map[string]Version // 拡張ごとのバージョン
+}
+
+// 何も指定されなかった場合の命令セット
+func Default() ISA {
+	i := ISA{xlen: 32}
+	i.add("i", Version{})
+	return i
+}
+
+// 1文字の拡張とそのバージョン (例: "i2p1", "m", "c2")
+var singleLetterPattern = regexp.MustCompile(`^([a-z])(\d+(?:p\d+)?)?`)
+
+// 複数文字の拡張とそのバージョン (例: "zicsr2p0", "zve32x")
+var multiLetterPattern = regexp.MustCompile(`^([a-z][a-z0-9]*?[a-z])(\d+(?:p\d+)?)?$`)
+
+/*
+"rv32imac_zicsr_zifencei" のような -march の文字列を解釈する
+拡張名の後ろには "2p1" 形式でバージョンを書くことができる
+*/
+func Parse(march string) (ISA, error) {
+	errorf := func(format string, args ...interface{}) (ISA, error) {
+		return ISA{}, fmt.Errorf("-march=%s: %s", march, fmt.Sprintf(format, args...))
+	}
+
+	s := strings.ToLower(march)
+	if !strings.HasPrefix(s, "rv32") {
+		return errorf("ISA string must begin with rv32")
+	}
+	s = s[len("rv32"):]
+	if s == "" || !strings.ContainsRune("ieg", rune(s[0])) {
+		return errorf("first ISA subset must be `e', `i' or `g'")
+	}
+
+	isa := ISA{xlen: 32}
+	parts := strings.Split(s, "_")
+
+	// 先頭は1文字の拡張の並び
+	single := parts[0]
+	order := -1
+	for single != "" {
+		m := singleLetterPattern.FindStringSubmatch(single)
+		if m == nil {
+			return errorf("invalid ISA subset `%s'", single)
+		}
+		single = single[len(m[0]):]
+		ext := m[1]
+		version, err := parseVersion(m[2])
+		if err != nil {
+			return errorf("%s", err.Error())
+		}
+
+		if ext == "g" {
+			if order >= 0 {
+				return errorf("`g' must be the first ISA subset")
+			}
+			for _, e := range generalExtensions {
+				isa.add(e, Version{})
+			}
+			order = 0
+			continue
+		}
+		if isa.Has(ext) && !isImplied(ext) {
+			return errorf("duplicated standard ISA extension `%s'", ext)
+		}
+		if ext != "i" && ext != "e" {
+			idx := strings.Index(canonicalOrder, ext)
+			if idx < 0 {
+				return errorf("unknown standard ISA extension `%s'", ext)
+			} else if idx <= order {
+				return errorf("standard ISA extension `%s' is not in canonical order", ext)
+			}
+			order = idx
+		} else if order >= 0 {
+			return errorf("`%s' must be the first ISA subset", ext)
+		} else {
+			order = 0
+		}
+		if err := isa.add(ext, version); err != nil {
+			return errorf("%s", err.Error())
+		}
+	}
+
+	// 以降は"_"区切りの複数文字の拡張
+	for _, part := range parts[1:] {
+		m := multiLetterPattern.FindStringSubmatch(part)
+		if m == nil || len(m[1]) < 2 {
+			return errorf("invalid ISA subset `%s'", part)
+		}
+		version, err := parseVersion(m[2])
+		if err != nil {
+			return errorf("%s", err.Error())
+		}
+		if err := isa.add(m[1], version); err != nil {
+			return errorf("%s", err.Error())
+		}
+	}
+
+	if isa.Has("e") && isa.Has("i") {
+		return errorf("`e' and `i' cannot be used together")
+	}
+	return isa, nil
+}
+
+// "2p1" 形式のバージョンを解釈する。省略されていればゼロ値を返す
+func parseVersion(s string) (Version, error) {
+	if s == "" {
+		return Version{}, nil
+	}
+	var v Version
+	major, minor, hasMinor := strings.Cut(s, "p")
+	var err error
+	if v.Major, err = strconv.Atoi(major); err != nil {
+		return v, fmt.Errorf("invalid version `%s'", s)
+	}
+	if hasMinor {
+		if v.Minor, err = strconv.Atoi(minor); err != nil {
+			return v, fmt.Errorf("invalid version `%s'", s)
+		}
+	}
+	return v, nil
+}
+
+// 他の拡張から暗黙に有効になりうる拡張かどうか
+func isImplied(ext string) bool {
+	for _, implied := range impliedExtensions {
+		for _, e := range implied {
+			if e == ext {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 拡張を追加する。バージョンがゼロ値ならデフォルトのバージョンを使う
+// 拡張が含む拡張も一緒に追加する
+func (i *ISA) add(ext string, version Version) error {
+	defaultVersion, exists := extensionVersions[ext]
+	if !exists {
+		return fmt.Errorf("unknown ISA extension `%s'", ext)
+	}
+	if version == (Version{}) {
+		version = defaultVersion
+	}
+	if i.versions == nil {
+		i.versions = map[string]Version{}
+	}
+	if i.Has(ext) {
+		// 明示的に指定されたバージョンを優先する
+		if version != defaultVersion {
+			i.versions[ext] = version
+		}
+		return nil
+	}
+	i.exts = append(i.exts, ext)
+	i.versions[ext] = version
+	sort.SliceStable(i.exts, func(a, b int) bool {
+		return extensionLess(i.exts[a], i.exts[b])
+	})
+	for _, implied := range impliedExtensions[ext] {
+		i.add(implied, Version{})
+	}
+	return nil
+}
+
+// 正規の並び順で a が b より前なら true
+// 1文字の拡張、z拡張、x拡張(ベンダー拡張)の順に並び、z拡張は2文字目のカテゴリ順、同じカテゴリ内ではアルファベット順
+func extensionLess(a, b string) bool {
+	rank := func(ext string) int {
+		if len(ext) == 1 {
+			return strings.Index(canonicalOrder, ext)
+		} else if ext[0] == 'x' {
+			return 2 * len(canonicalOrder)
+		}
+		return len(canonicalOrder) + strings.Index(canonicalOrder, ext[1:2])
+	}
+	if rank(a) != rank(b) {
+		return rank(a) < rank(b)
+	}
+	return a < b
+}
+
+// 拡張が有効かどうか
+func (i ISA) Has(ext string) bool {
+	for _, e := range i.exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// 拡張を追加した命令セットを返す
+func (i ISA) With(ext string) ISA {
+	added := ISA{xlen: i.xlen, exts: append([]string{}, i.exts...), versions: map[string]Version{}}
+	for e, v := range i.versions {
+		added.versions[e] = v
+	}
+	added.add(ext, Version{})
+	return added
+}
+
+// 拡張を取り除いた命令セットを返す
+// その拡張が含む拡張はそのまま残す
+func (i ISA) Without(ext string) ISA {
+	removed := ISA{xlen: i.xlen, versions: map[string]Version{}}
+	for _, e := range i.exts {
+		if e != ext {
+			removed.exts = append(removed.exts, e)
+			removed.versions[e] = i.versions[e]
+		}
+	}
+	return removed
+}
+
+/*
+拡張を追加で登録し、-march で指定できるようにする
+name は "xfoo" のような複数文字の拡張名で、implies はその拡張と一緒に有効になる拡張
+*/
+func RegisterExtension(name string, version Version, implies []string) error {
+	if _, exists := extensionVersions[name]; exists {
+		return fmt.Errorf("ISA extension `%s' is already registered", name)
+	}
+	if m := multiLetterPattern.FindStringSubmatch(name); m == nil || m[2] != "" || !strings.ContainsRune("zsx", rune(name[0])) {
+		return fmt.Errorf("invalid ISA extension name `%s'", name)
+	}
+	for _, ext := range implies {
+		if _, exists := extensionVersions[ext]; !exists {
+			return fmt.Errorf("unknown ISA extension `%s'", ext)
+		}
+	}
+	if version == (Version{}) {
+		version = Version{1, 0}
+	}
+	extensionVersions[name] = version
+	if len(implies) > 0 {
+		impliedExtensions[name] = append([]string{}, implies...)
+	}
+	return nil
+}
+
+// 対応している拡張の名前かどうか
+func IsExtension(ext string) bool {
+	_, exists := extensionVersions[ext]
+	return exists
+}
+
+// Tag_RISCV_arch に書き出す "rv32i2p1_c2p0_zba1p0" 形式の文字列
+func (i ISA) String() string {
+	var parts []string
+	for _, ext := range i.exts {
+		v := i.versions[ext]
+		parts = append(parts, fmt.Sprintf("%s%dp%d", ext, v.Major, v.Minor))
+	}
+	return fmt.Sprintf("rv%d%s", i.xlen, strings.Join(parts, "_"))
+}
@@ -1,32 +1,125 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 
-	"github.com/ayase-mstk/go32as/src/elf32"
-	"github.com/ayase-mstk/go32as/src/parse"
+	"github.com/ayase-mstk/go32as/src/assembler"
+	"github.com/ayase-mstk/go32as/src/diag"
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Fprintln(os.Stderr, "invalid num of arguments.")
-		os.Exit(0)
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// アセンブルして終了コードを返す。メッセージは全てstderrに出す
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, err := parseArgs(args)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", os.Args[0], err.Error())
+		return 1
+	}
+	if opts.help {
+		fmt.Fprintf(stdout, usage, os.Args[0], assembler.DefaultOutput)
+		return 0
+	}
+	if opts.version {
+		fmt.Fprintf(stdout, "go32as %s\nA RISC-V RV32 assembler with a GNU as compatible command line.\n", assembler.Version)
+		return 0
 	}
 
-	stmts, err := parse.ParseFile(os.Args[1])
+	if err := opts.cfg.Check(); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", os.Args[0], err.Error())
+		return 1
+	}
+
+	srcs := make([]assembler.Source, len(opts.inputs))
+	for i, input := range opts.inputs {
+		srcs[i], err = readSource(input, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", os.Args[0], err.Error())
+			return 1
+		}
+	}
+
+	obj, err := assembler.Build(srcs, opts.cfg)
+	// -Wで出さない警告は--fatal-warningsでも数えない
+	var diags diag.List
+	warnings := 0
+	for _, d := range obj.Diagnostics() {
+		if d.Severity == diag.Warning {
+			if opts.noWarn {
+				continue
+			}
+			warnings++
+		}
+		diags = append(diags, d)
+	}
+	// gasと同じく、ソースごとに見出しを付ける。診断はソースの順に並んでいる
+	// ソースに結びつかない診断は直前のソースの見出しの下に出す
+	header := ""
+	for _, d := range diags {
+		if name := d.File; header == "" || name != "" && name != header {
+			if name == "" {
+				name = srcs[0].Name
+			}
+			fmt.Fprintf(stderr, "%s: Assembler messages:\n", name)
+			header = name
+		}
+		// 診断にはソースの行と、誤りのある列を指す^を付ける
+		diag.Render(stderr, d, obj.SourceLine)
+	}
+	var srcErr diag.List
+	if header == "" && err != nil && !errors.As(err, &srcErr) {
+		fmt.Fprintf(stderr, "%s: Assembler messages:\n", srcs[0].Name)
+	}
 	if err != nil {
-		fmt.Printf("%s: Assembler messages:\n", os.Args[1])
-		fmt.Println(err.Error())
-		os.Exit(0)
+		if !errors.As(err, &srcErr) {
+			fmt.Fprintln(stderr, err.Error())
+		}
+		return 1
+	}
+	if opts.fatalWarnings && warnings > 0 {
+		return 1
+	}
+
+	if err := obj.WriteFile(opts.output); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", os.Args[0], err.Error())
+		return 1
+	}
+	if opts.listing != (assembler.ListingOptions{}) {
+		if err := writeListing(obj, opts, stdout); err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", os.Args[0], err.Error())
+			return 1
+		}
 	}
+	return 0
+}
 
-	e, err := elf32.PrepareElf32Tables(stmts)
+// inputが"-"なら標準入力から読む
+func readSource(input string, stdin io.Reader) (assembler.Source, error) {
+	if input == "-" {
+		data, err := io.ReadAll(stdin)
+		return assembler.Source{Name: stdinName, Data: data}, err
+	}
+	data, err := os.ReadFile(input)
+	return assembler.Source{Name: input, Data: data}, err
+}
+
+// -aのリスティングを、=fileの指定があればそのファイルに、なければstdoutに書く
+func writeListing(obj *assembler.Object, opts options, stdout io.Writer) error {
+	if opts.listingFile == "" {
+		return obj.WriteListing(stdout, opts.listing)
+	}
+	file, err := os.Create(opts.listingFile)
 	if err != nil {
-		fmt.Printf("%s: Assembler messages:\n", os.Args[1])
-		fmt.Println(os.Args[1], ":", err.Error())
-		os.Exit(0)
+		return err
+	}
+	if err := obj.WriteListing(file, opts.listing); err != nil {
+		file.Close()
+		return err
 	}
-	//e.PrintAll()
-	e.WriteToFile()
+	return file.Close()
 }
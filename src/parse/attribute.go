@@ -0,0 +1,74 @@
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ayase-mstk/go32as/src/isa"
+)
+
+// .attributeで名前で指定できる属性と、そのタグ
+// "Tag_RISCV_arch" のように接頭辞を付けた名前も使える
+var attributeTags = map[string]int{
+	"stack_align":        4,
+	"arch":               5,
+	"unaligned_access":   6,
+	"priv_spec":          8,
+	"priv_spec_minor":    10,
+	"priv_spec_revision": 12,
+	"atomic_abi":         14,
+	"x3_reg_usage":       16,
+}
+
+const attributeTagArch = 5
+
+// タグが奇数の属性はNTBS、偶数の属性はULEB128の値をとる
+func IsStringAttribute(tag int) bool {
+	return tag%2 == 1
+}
+
+// 名前か数値で書かれたタグを数値にする
+func attributeTag(val string) (int, error) {
+	if IsImmediate(val) {
+		tag := ImmValue(val)
+		if tag < 0 {
+			return 0, fmt.Errorf("attribute name not recognized: %s", val)
+		}
+		return int(tag), nil
+	}
+	tag, exists := attributeTags[strings.TrimPrefix(val, "Tag_RISCV_")]
+	if !exists {
+		return 0, fmt.Errorf("attribute name not recognized: %s", val)
+	}
+	return tag, nil
+}
+
+/*
+.attribute の引数を検証し、タグを10進数の文字列に揃える
+Tag_RISCV_archの値は -march と同じ規則で解釈し、正規の形式に置き換える
+*/
+func (d *Directive) normalizeAttribute() error {
+	tag, err := attributeTag(d.args[0])
+	if err != nil {
+		return err
+	}
+	d.args[0] = strconv.Itoa(tag)
+
+	val := d.args[1]
+	isString := len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"'
+	if IsStringAttribute(tag) && !isString {
+		return fmt.Errorf("bad string constant")
+	} else if !IsStringAttribute(tag) && !IsImmediate(val) {
+		return fmt.Errorf("expected numeric constant")
+	}
+
+	if tag == attributeTagArch {
+		arch, err := isa.Parse(val[1 : len(val)-1])
+		if err != nil {
+			return err
+		}
+		d.args[1] = strconv.Quote(arch.String())
+	}
+	return nil
+}
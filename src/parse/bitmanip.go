@@ -0,0 +1,95 @@
+package parse
+
+// Bit-manipulation (Zba, Zbb, Zbc, Zbs)
+const (
+	// Zba
+	SH1ADD = "sh1add"
+	SH2ADD = "sh2add"
+	SH3ADD = "sh3add"
+
+	// Zbb
+	ANDN  = "andn"
+	ORN   = "orn"
+	XNOR  = "xnor"
+	CLZ   = "clz"
+	CTZ   = "ctz"
+	CPOP  = "cpop"
+	MAX   = "max"
+	MAXU  = "maxu"
+	MIN   = "min"
+	MINU  = "minu"
+	SEXTB = "sext.b"
+	SEXTH = "sext.h"
+	ZEXTH = "zext.h"
+	ROL   = "rol"
+	ROR   = "ror"
+	RORI  = "rori"
+	ORCB  = "orc.b"
+	REV8  = "rev8"
+
+	// Zbc
+	CLMUL  = "clmul"
+	CLMULH = "clmulh"
+	CLMULR = "clmulr"
+
+	// Zbs
+	BCLR  = "bclr"
+	BCLRI = "bclri"
+	BEXT  = "bext"
+	BEXTI = "bexti"
+	BINV  = "binv"
+	BINVI = "binvi"
+	BSET  = "bset"
+	BSETI = "bseti"
+)
+
+var zbaInstructions = map[string]InstructionSpec{
+	SH1ADD: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b010, Funct7: 0b0010000}},
+	SH2ADD: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b100, Funct7: 0b0010000}},
+	SH3ADD: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b110, Funct7: 0b0010000}},
+}
+
+var zbbInstructions = map[string]InstructionSpec{
+	ANDN:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b111, Funct7: 0b0100000}},
+	ORN:   {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b110, Funct7: 0b0100000}},
+	XNOR:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b100, Funct7: 0b0100000}},
+	CLZ:   {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0110000, Rs2: 0b00000}},
+	CTZ:   {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0110000, Rs2: 0b00001}},
+	CPOP:  {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0110000, Rs2: 0b00010}},
+	MAX:   {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b110, Funct7: 0b0000101}},
+	MAXU:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b111, Funct7: 0b0000101}},
+	MIN:   {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b100, Funct7: 0b0000101}},
+	MINU:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b101, Funct7: 0b0000101}},
+	SEXTB: {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0110000, Rs2: 0b00100}},
+	SEXTH: {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0110000, Rs2: 0b00101}},
+	ZEXTH: {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0110011, Funct3: 0b100, Funct7: 0b0000100, Rs2: 0b00000}},
+	ROL:   {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b001, Funct7: 0b0110000}},
+	ROR:   {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b101, Funct7: 0b0110000}},
+	RORI:  {Format: IType, Syntax: "rd, rs1, shamt", Fields: Fields{Opcode: 0b0010011, Funct3: 0b101, Funct7: 0b0110000}},
+	ORCB:  {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b101, Funct7: 0b0010100, Rs2: 0b00111}},
+	REV8:  {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b101, Funct7: 0b0110100, Rs2: 0b11000}},
+}
+
+var zbcInstructions = map[string]InstructionSpec{
+	CLMUL:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b001, Funct7: 0b0000101}},
+	CLMULH: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b011, Funct7: 0b0000101}},
+	CLMULR: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b010, Funct7: 0b0000101}},
+}
+
+var zbsInstructions = map[string]InstructionSpec{
+	BCLR:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b001, Funct7: 0b0100100}},
+	BCLRI: {Format: IType, Syntax: "rd, rs1, shamt", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0100100}},
+	BEXT:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b101, Funct7: 0b0100100}},
+	BEXTI: {Format: IType, Syntax: "rd, rs1, shamt", Fields: Fields{Opcode: 0b0010011, Funct3: 0b101, Funct7: 0b0100100}},
+	BINV:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b001, Funct7: 0b0110100}},
+	BINVI: {Format: IType, Syntax: "rd, rs1, shamt", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0110100}},
+	BSET:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b001, Funct7: 0b0010100}},
+	BSETI: {Format: IType, Syntax: "rd, rs1, shamt", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0010100}},
+}
+
+func init() {
+	MustRegisterExtension(Extension{Name: "zba", Instructions: zbaInstructions})
+	MustRegisterExtension(Extension{Name: "zbb", Instructions: zbbInstructions})
+	MustRegisterExtension(Extension{Name: "zbc", Instructions: zbcInstructions})
+	MustRegisterExtension(Extension{Name: "zbs", Instructions: zbsInstructions})
+}
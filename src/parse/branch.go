@@ -0,0 +1,52 @@
+package parse
+
+// 条件分岐と、条件を反転した分岐
+var invertedBranches = map[string]string{
+	BEQ:  BNE,
+	BNE:  BEQ,
+	BLT:  BGE,
+	BGE:  BLT,
+	BLTU: BGEU,
+	BGEU: BLTU,
+}
+
+// 範囲外の分岐を置き換えた命令列で、反転した分岐が飛び越すバイト数 (自身とjalの分)
+const relaxedBranchSkip = "8"
+
+// ラベルに飛ぶ条件分岐ならその飛び先を返す
+func (s *Stmt) BranchTarget() (string, bool) {
+	if s.op == nil || s.op.relFunc != "" {
+		return "", false
+	}
+	if _, ok := invertedBranches[s.op.opcode]; !ok {
+		return "", false
+	}
+	target := s.op.RetIfSymbol()
+	return target, target != ""
+}
+
+/*
+飛び先が±4KiBに収まらない条件分岐を、条件を反転した分岐でjalを飛び越す形に置き換える
+
+	beq a0, a1, far  ->  bne a0, a1, 8
+	                     jal zero, far
+
+ラベルは先頭の命令に付ける
+*/
+func (s Stmt) RelaxBranch() []Stmt {
+	oprs := s.op.operands
+	ops := []Operation{
+		s.op.sequence(invertedBranches[s.op.opcode], "", oprs[0], oprs[1], relaxedBranchSkip),
+		s.op.sequence(JAL, "", "zero", oprs[2]),
+	}
+
+	stmts := make([]Stmt, len(ops))
+	for i := range ops {
+		stmts[i] = s
+		stmts[i].op = &ops[i]
+		if i != 0 {
+			stmts[i].labelSymbol = ""
+		}
+	}
+	return stmts
+}
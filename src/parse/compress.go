@@ -0,0 +1,186 @@
+package parse
+
+// RVC (C extension)
+const (
+	CADDI4SPN = "c.addi4spn"
+	CLW       = "c.lw"
+	CSW       = "c.sw"
+	CNOP      = "c.nop"
+	CADDI     = "c.addi"
+	CJAL      = "c.jal"
+	CLI       = "c.li"
+	CADDI16SP = "c.addi16sp"
+	CLUI      = "c.lui"
+	CSRLI     = "c.srli"
+	CSRAI     = "c.srai"
+	CANDI     = "c.andi"
+	CSUB      = "c.sub"
+	CXOR      = "c.xor"
+	COR       = "c.or"
+	CAND      = "c.and"
+	CJ        = "c.j"
+	CBEQZ     = "c.beqz"
+	CBNEZ     = "c.bnez"
+	CSLLI     = "c.slli"
+	CLWSP     = "c.lwsp"
+	CJR       = "c.jr"
+	CMV       = "c.mv"
+	CEBREAK   = "c.ebreak"
+	CJALR     = "c.jalr"
+	CADD      = "c.add"
+	CSWSP     = "c.swsp"
+)
+
+var compressedInstructions = map[string]InstructionSpec{
+	CADDI4SPN: {Format: CIWType, Syntax: "rd_p, sp, c_nzuimm10", Fields: Fields{Opcode: 0b00, Funct3: 0b000}},
+	CLW:       {Format: CLType, Syntax: "rd_p, c_uimm7(rs1_p)", Fields: Fields{Opcode: 0b00, Funct3: 0b010}},
+	CSW:       {Format: CSType, Syntax: "rs2_p, c_uimm7(rs1_p)", Fields: Fields{Opcode: 0b00, Funct3: 0b110}},
+
+	CNOP:      {Format: CIType, Syntax: "", Fields: Fields{Opcode: 0b01, Funct3: 0b000}},
+	CADDI:     {Format: CIType, Syntax: "rd_rs1_n0, c_nzimm6", Fields: Fields{Opcode: 0b01, Funct3: 0b000}},
+	CJAL:      {Format: CJType, Syntax: "c_imm12", Fields: Fields{Opcode: 0b01, Funct3: 0b001}},
+	CLI:       {Format: CIType, Syntax: "rd_n0, c_imm6", Fields: Fields{Opcode: 0b01, Funct3: 0b010}},
+	CADDI16SP: {Format: CIType, Syntax: "sp, c_nzimm10", Fields: Fields{Opcode: 0b01, Funct3: 0b011, Rd: 2}},
+	CLUI:      {Format: CIType, Syntax: "rd_n2, c_nzimm18", Fields: Fields{Opcode: 0b01, Funct3: 0b011}},
+	CSRLI:     {Format: CBType, Syntax: "rd_rs1_p, c_nzuimm6", Fields: Fields{Opcode: 0b01, Funct6: 0b100000}},
+	CSRAI:     {Format: CBType, Syntax: "rd_rs1_p, c_nzuimm6", Fields: Fields{Opcode: 0b01, Funct6: 0b100001}},
+	CANDI:     {Format: CBType, Syntax: "rd_rs1_p, c_imm6", Fields: Fields{Opcode: 0b01, Funct6: 0b100010}},
+	CSUB:      {Format: CAType, Syntax: "rd_rs1_p, rs2_p", Fields: Fields{Opcode: 0b01, Funct6: 0b100011, Funct2: 0b00}},
+	CXOR:      {Format: CAType, Syntax: "rd_rs1_p, rs2_p", Fields: Fields{Opcode: 0b01, Funct6: 0b100011, Funct2: 0b01}},
+	COR:       {Format: CAType, Syntax: "rd_rs1_p, rs2_p", Fields: Fields{Opcode: 0b01, Funct6: 0b100011, Funct2: 0b10}},
+	CAND:      {Format: CAType, Syntax: "rd_rs1_p, rs2_p", Fields: Fields{Opcode: 0b01, Funct6: 0b100011, Funct2: 0b11}},
+	CJ:        {Format: CJType, Syntax: "c_imm12", Fields: Fields{Opcode: 0b01, Funct3: 0b101}},
+	CBEQZ:     {Format: CBType, Syntax: "rs1_p, c_bimm9", Fields: Fields{Opcode: 0b01, Funct3: 0b110}},
+	CBNEZ:     {Format: CBType, Syntax: "rs1_p, c_bimm9", Fields: Fields{Opcode: 0b01, Funct3: 0b111}},
+
+	CSLLI:   {Format: CIType, Syntax: "rd_rs1_n0, c_nzuimm6", Fields: Fields{Opcode: 0b10, Funct3: 0b000}},
+	CLWSP:   {Format: CIType, Syntax: "rd_n0, c_uimm8sp(sp)", Fields: Fields{Opcode: 0b10, Funct3: 0b010}},
+	CJR:     {Format: CRType, Syntax: "rs1_n0", Fields: Fields{Opcode: 0b10, Funct4: 0b1000}},
+	CMV:     {Format: CRType, Syntax: "rd_n0, c_rs2_n0", Fields: Fields{Opcode: 0b10, Funct4: 0b1000}},
+	CEBREAK: {Format: CRType, Syntax: "", Fields: Fields{Opcode: 0b10, Funct4: 0b1001}},
+	CJALR:   {Format: CRType, Syntax: "rs1_n0", Fields: Fields{Opcode: 0b10, Funct4: 0b1001}},
+	CADD:    {Format: CRType, Syntax: "rd_rs1_n0, c_rs2_n0", Fields: Fields{Opcode: 0b10, Funct4: 0b1001}},
+	CSWSP:   {Format: CSSType, Syntax: "c_rs2, c_uimm8sp_s(sp)", Fields: Fields{Opcode: 0b10, Funct3: 0b110}},
+}
+
+func init() {
+	MustRegisterExtension(Extension{Name: "c", Instructions: compressedInstructions})
+}
+
+// RVCの3bitレジスタフィールドで表せるx8-x15かどうか
+func isCompressedReg(val string) bool {
+	n, exists := RegisterSet[val]
+	return exists && 8 <= n && n <= 15
+}
+
+func regNum(val string) int {
+	return RegisterSet[val]
+}
+
+func inRange(n, min, max int64) bool {
+	return min <= n && n <= max
+}
+
+/*
+RVCが有効な場合に、対応するRVC命令へ置き換えられる基本命令を置き換える
+シンボルやリロケーションファンクションを含む命令は置き換えない
+*/
+func (o *Operation) compress() {
+	if o.Size() == 2 || o.relFunc != "" || o.RetIfSymbol() != "" {
+		return
+	}
+
+	ops := o.operands
+	reg := func(i int) int { return regNum(ops[i]) }
+	imm := func(i int) int64 { return ImmValue(ops[i]) }
+
+	switch o.opcode {
+	case ADDI:
+		switch {
+		case reg(0) == 0 && reg(1) == 0 && imm(2) == 0:
+			o.replace(CNOP)
+		case reg(0) != 0 && reg(1) == 0 && inRange(imm(2), -32, 31):
+			o.replace(CLI, ops[0], ops[2])
+		case reg(0) == 2 && reg(1) == 2 && imm(2) != 0 && imm(2)%16 == 0 && inRange(imm(2), -512, 496):
+			o.replace(CADDI16SP, ops[0], ops[2])
+		case reg(0) != 0 && reg(0) == reg(1) && imm(2) != 0 && inRange(imm(2), -32, 31):
+			o.replace(CADDI, ops[0], ops[2])
+		case isCompressedReg(ops[0]) && reg(1) == 2 && imm(2)%4 == 0 && inRange(imm(2), 4, 1020):
+			o.replace(CADDI4SPN, ops[0], ops[1], ops[2])
+		case reg(0) != 0 && reg(1) != 0 && imm(2) == 0:
+			o.replace(CMV, ops[0], ops[1])
+		}
+
+	case LUI:
+		if reg(0) != 0 && reg(0) != 2 && (inRange(imm(1), 1, 31) || inRange(imm(1), 0xfffe0, 0xfffff)) {
+			o.replace(CLUI, ops[0], ops[1])
+		}
+
+	case SLLI:
+		if reg(0) != 0 && reg(0) == reg(1) && inRange(imm(2), 1, 31) {
+			o.replace(CSLLI, ops[0], ops[2])
+		}
+
+	case SRLI, SRAI, ANDI:
+		if !isCompressedReg(ops[0]) || reg(0) != reg(1) {
+			return
+		}
+		if o.opcode == ANDI && inRange(imm(2), -32, 31) {
+			o.replace(CANDI, ops[0], ops[2])
+		} else if o.opcode == SRLI && inRange(imm(2), 1, 31) {
+			o.replace(CSRLI, ops[0], ops[2])
+		} else if o.opcode == SRAI && inRange(imm(2), 1, 31) {
+			o.replace(CSRAI, ops[0], ops[2])
+		}
+
+	case ADD:
+		switch {
+		case reg(0) != 0 && reg(1) == 0 && reg(2) != 0:
+			o.replace(CMV, ops[0], ops[2])
+		case reg(0) != 0 && reg(0) == reg(1) && reg(2) != 0:
+			o.replace(CADD, ops[0], ops[2])
+		case reg(0) != 0 && reg(0) == reg(2) && reg(1) != 0:
+			o.replace(CADD, ops[0], ops[1])
+		}
+
+	case SUB, XOR, OR, AND:
+		if !isCompressedReg(ops[0]) || !isCompressedReg(ops[1]) || !isCompressedReg(ops[2]) {
+			return
+		}
+		cop := map[string]string{SUB: CSUB, XOR: CXOR, OR: COR, AND: CAND}[o.opcode]
+		if reg(0) == reg(1) {
+			o.replace(cop, ops[0], ops[2])
+		} else if reg(0) == reg(2) && o.opcode != SUB {
+			// 可換な演算はオペランドを入れ替えられる
+			o.replace(cop, ops[0], ops[1])
+		}
+
+	case LW:
+		switch {
+		case isCompressedReg(ops[0]) && isCompressedReg(ops[2]) && imm(1)%4 == 0 && inRange(imm(1), 0, 124):
+			o.replace(CLW, ops...)
+		case reg(0) != 0 && reg(2) == 2 && imm(1)%4 == 0 && inRange(imm(1), 0, 252):
+			o.replace(CLWSP, ops...)
+		}
+
+	case SW:
+		switch {
+		case isCompressedReg(ops[0]) && isCompressedReg(ops[2]) && imm(1)%4 == 0 && inRange(imm(1), 0, 124):
+			o.replace(CSW, ops...)
+		case reg(2) == 2 && imm(1)%4 == 0 && inRange(imm(1), 0, 252):
+			o.replace(CSWSP, ops...)
+		}
+
+	case JALR:
+		if reg(1) != 0 && imm(2) == 0 {
+			if reg(0) == 0 {
+				o.replace(CJR, ops[1])
+			} else if reg(0) == 1 {
+				o.replace(CJALR, ops[1])
+			}
+		}
+
+	case EBREAK:
+		o.replace(CEBREAK)
+	}
+}
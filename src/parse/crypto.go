@@ -0,0 +1,114 @@
+package parse
+
+// Scalar cryptography (Zbkb, Zbkc, Zbkx, Zknd, Zkne, Zknh, Zksed, Zksh)
+const (
+	// Zbkb
+	PACK  = "pack"
+	PACKH = "packh"
+	BREV8 = "brev8"
+	ZIP   = "zip"
+	UNZIP = "unzip"
+
+	// Zbkx
+	XPERM4 = "xperm4"
+	XPERM8 = "xperm8"
+
+	// Zknd
+	AES32DSI  = "aes32dsi"
+	AES32DSMI = "aes32dsmi"
+
+	// Zkne
+	AES32ESI  = "aes32esi"
+	AES32ESMI = "aes32esmi"
+
+	// Zknh
+	SHA256SIG0  = "sha256sig0"
+	SHA256SIG1  = "sha256sig1"
+	SHA256SUM0  = "sha256sum0"
+	SHA256SUM1  = "sha256sum1"
+	SHA512SIG0H = "sha512sig0h"
+	SHA512SIG0L = "sha512sig0l"
+	SHA512SIG1H = "sha512sig1h"
+	SHA512SIG1L = "sha512sig1l"
+	SHA512SUM0R = "sha512sum0r"
+	SHA512SUM1R = "sha512sum1r"
+
+	// Zksed
+	SM4ED = "sm4ed"
+	SM4KS = "sm4ks"
+
+	// Zksh
+	SM3P0 = "sm3p0"
+	SM3P1 = "sm3p1"
+)
+
+// Zbbと共通の命令も含む
+var zbkbInstructions = map[string]InstructionSpec{
+	ROR:   zbbInstructions[ROR],
+	ROL:   zbbInstructions[ROL],
+	RORI:  zbbInstructions[RORI],
+	ANDN:  zbbInstructions[ANDN],
+	ORN:   zbbInstructions[ORN],
+	XNOR:  zbbInstructions[XNOR],
+	PACK:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b100, Funct7: 0b0000100}},
+	PACKH: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b111, Funct7: 0b0000100}},
+	BREV8: {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b101, Funct7: 0b0110100, Rs2: 0b00111}},
+	REV8:  zbbInstructions[REV8],
+	ZIP:   {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0000100, Rs2: 0b01111}},
+	UNZIP: {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b101, Funct7: 0b0000100, Rs2: 0b01111}},
+}
+
+// Zbcと共通の命令
+var zbkcInstructions = map[string]InstructionSpec{
+	CLMUL:  zbcInstructions[CLMUL],
+	CLMULH: zbcInstructions[CLMULH],
+}
+
+var zbkxInstructions = map[string]InstructionSpec{
+	XPERM4: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b010, Funct7: 0b0010100}},
+	XPERM8: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b100, Funct7: 0b0010100}},
+}
+
+var zkndInstructions = map[string]InstructionSpec{
+	AES32DSI:  {Format: BsType, Syntax: "rd, rs1, rs2, bs", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0010101}},
+	AES32DSMI: {Format: BsType, Syntax: "rd, rs1, rs2, bs", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0010111}},
+}
+
+var zkneInstructions = map[string]InstructionSpec{
+	AES32ESI:  {Format: BsType, Syntax: "rd, rs1, rs2, bs", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0010001}},
+	AES32ESMI: {Format: BsType, Syntax: "rd, rs1, rs2, bs", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0010011}},
+}
+
+var zknhInstructions = map[string]InstructionSpec{
+	SHA256SIG0:  {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0001000, Rs2: 0b00010}},
+	SHA256SIG1:  {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0001000, Rs2: 0b00011}},
+	SHA256SUM0:  {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0001000, Rs2: 0b00000}},
+	SHA256SUM1:  {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0001000, Rs2: 0b00001}},
+	SHA512SIG0H: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0101110}},
+	SHA512SIG0L: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0101010}},
+	SHA512SIG1H: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0101111}},
+	SHA512SIG1L: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0101011}},
+	SHA512SUM0R: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0101000}},
+	SHA512SUM1R: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0101001}},
+}
+
+var zksedInstructions = map[string]InstructionSpec{
+	SM4ED: {Format: BsType, Syntax: "rd, rs1, rs2, bs", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0011000}},
+	SM4KS: {Format: BsType, Syntax: "rd, rs1, rs2, bs", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0011010}},
+}
+
+var zkshInstructions = map[string]InstructionSpec{
+	SM3P0: {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0001000, Rs2: 0b01000}},
+	SM3P1: {Format: UnaryType, Syntax: "rd, rs1", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001, Funct7: 0b0001000, Rs2: 0b01001}},
+}
+
+func init() {
+	MustRegisterExtension(Extension{Name: "zbkb", Instructions: zbkbInstructions})
+	MustRegisterExtension(Extension{Name: "zbkc", Instructions: zbkcInstructions})
+	MustRegisterExtension(Extension{Name: "zbkx", Instructions: zbkxInstructions})
+	MustRegisterExtension(Extension{Name: "zknd", Instructions: zkndInstructions})
+	MustRegisterExtension(Extension{Name: "zkne", Instructions: zkneInstructions})
+	MustRegisterExtension(Extension{Name: "zknh", Instructions: zknhInstructions})
+	MustRegisterExtension(Extension{Name: "zksed", Instructions: zksedInstructions})
+	MustRegisterExtension(Extension{Name: "zksh", Instructions: zkshInstructions})
+}
@@ -0,0 +1,172 @@
+package parse
+
+import (
+	"fmt"
+)
+
+// Zicsr, 特権命令
+const (
+	CSRRW  = "csrrw"
+	CSRRS  = "csrrs"
+	CSRRC  = "csrrc"
+	CSRRWI = "csrrwi"
+	CSRRSI = "csrrsi"
+	CSRRCI = "csrrci"
+
+	// 疑似命令
+	CSRR  = "csrr"
+	CSRW  = "csrw"
+	CSRS  = "csrs"
+	CSRC  = "csrc"
+	CSRWI = "csrwi"
+	CSRSI = "csrsi"
+	CSRCI = "csrci"
+
+	MRET      = "mret"
+	SRET      = "sret"
+	WFI       = "wfi"
+	SFENCEVMA = "sfence.vma"
+)
+
+var zicsrInstructions = map[string]InstructionSpec{
+	CSRRW:  {Format: CSRType, Syntax: "rd, csr, rs1", Fields: Fields{Opcode: 0b1110011, Funct3: 0b001}},
+	CSRRS:  {Format: CSRType, Syntax: "rd, csr, rs1", Fields: Fields{Opcode: 0b1110011, Funct3: 0b010}},
+	CSRRC:  {Format: CSRType, Syntax: "rd, csr, rs1", Fields: Fields{Opcode: 0b1110011, Funct3: 0b011}},
+	CSRRWI: {Format: CSRIType, Syntax: "rd, csr, zimm", Fields: Fields{Opcode: 0b1110011, Funct3: 0b101}},
+	CSRRSI: {Format: CSRIType, Syntax: "rd, csr, zimm", Fields: Fields{Opcode: 0b1110011, Funct3: 0b110}},
+	CSRRCI: {Format: CSRIType, Syntax: "rd, csr, zimm", Fields: Fields{Opcode: 0b1110011, Funct3: 0b111}},
+
+	// 疑似命令
+	CSRR:  {Syntax: "rd, csr", Alias: "csrrs rd, csr, x0"},
+	CSRW:  {Syntax: "csr, rs1", Alias: "csrrw x0, csr, rs1"},
+	CSRS:  {Syntax: "csr, rs1", Alias: "csrrs x0, csr, rs1"},
+	CSRC:  {Syntax: "csr, rs1", Alias: "csrrc x0, csr, rs1"},
+	CSRWI: {Syntax: "csr, zimm", Alias: "csrrwi x0, csr, zimm"},
+	CSRSI: {Syntax: "csr, zimm", Alias: "csrrsi x0, csr, zimm"},
+	CSRCI: {Syntax: "csr, zimm", Alias: "csrrci x0, csr, zimm"},
+}
+
+// 特権命令。基本命令セットと同じく拡張の指定なしで使える
+var privilegedInstructions = map[string]InstructionSpec{
+	MRET:      {Format: SysType, Syntax: "", Fields: Fields{Opcode: 0b1110011, Funct7: 0b0011000, Rs2: 0b00010}},
+	SRET:      {Format: SysType, Syntax: "", Fields: Fields{Opcode: 0b1110011, Funct7: 0b0001000, Rs2: 0b00010}},
+	WFI:       {Format: SysType, Syntax: "", Fields: Fields{Opcode: 0b1110011, Funct7: 0b0001000, Rs2: 0b00101}},
+	SFENCEVMA: {Format: SysType, Syntax: "[rs1, rs2]", Fields: Fields{Opcode: 0b1110011, Funct7: 0b0001001}},
+}
+
+// CSR名とCSRアドレスの対応
+var CSRMap = map[string]int{
+	// Unprivileged Floating-Point CSRs
+	"fflags": 0x001,
+	"frm":    0x002,
+	"fcsr":   0x003,
+
+	// Vector CSRs
+	"vstart": 0x008,
+	"vxsat":  0x009,
+	"vxrm":   0x00A,
+	"vcsr":   0x00F,
+	"vl":     0xC20,
+	"vtype":  0xC21,
+	"vlenb":  0xC22,
+
+	// Unprivileged Counter/Timers
+	"cycle":    0xC00,
+	"time":     0xC01,
+	"instret":  0xC02,
+	"cycleh":   0xC80,
+	"timeh":    0xC81,
+	"instreth": 0xC82,
+
+	// Supervisor Trap Setup, Trap Handling, Protection and Translation
+	"sstatus":    0x100,
+	"sie":        0x104,
+	"stvec":      0x105,
+	"scounteren": 0x106,
+	"senvcfg":    0x10A,
+	"sscratch":   0x140,
+	"sepc":       0x141,
+	"scause":     0x142,
+	"stval":      0x143,
+	"sip":        0x144,
+	"satp":       0x180,
+
+	// Machine Information Registers
+	"mvendorid":  0xF11,
+	"marchid":    0xF12,
+	"mimpid":     0xF13,
+	"mhartid":    0xF14,
+	"mconfigptr": 0xF15,
+
+	// Machine Trap Setup, Trap Handling and Configuration
+	"mstatus":    0x300,
+	"misa":       0x301,
+	"medeleg":    0x302,
+	"mideleg":    0x303,
+	"mie":        0x304,
+	"mtvec":      0x305,
+	"mcounteren": 0x306,
+	"menvcfg":    0x30A,
+	"mstatush":   0x310,
+	"menvcfgh":   0x31A,
+	"mscratch":   0x340,
+	"mepc":       0x341,
+	"mcause":     0x342,
+	"mtval":      0x343,
+	"mip":        0x344,
+	"mtinst":     0x34A,
+	"mtval2":     0x34B,
+	"mseccfg":    0x747,
+	"mseccfgh":   0x757,
+
+	// Machine Counter/Timers
+	"mcycle":        0xB00,
+	"minstret":      0xB02,
+	"mcycleh":       0xB80,
+	"minstreth":     0xB82,
+	"mcountinhibit": 0x320,
+
+	// Debug/Trace Registers
+	"tselect":   0x7A0,
+	"tdata1":    0x7A1,
+	"tdata2":    0x7A2,
+	"tdata3":    0x7A3,
+	"mcontext":  0x7A8,
+	"dcsr":      0x7B0,
+	"dpc":       0x7B1,
+	"dscratch0": 0x7B2,
+	"dscratch1": 0x7B3,
+}
+
+func init() {
+	MustRegisterExtension(Extension{Name: "zicsr", Instructions: zicsrInstructions})
+	MustRegisterExtension(Extension{Name: baseExtension, Instructions: privilegedInstructions})
+
+	// 番号付きのCSR
+	for i := 3; i <= 31; i++ {
+		CSRMap[fmt.Sprintf("hpmcounter%d", i)] = 0xC00 + i
+		CSRMap[fmt.Sprintf("hpmcounter%dh", i)] = 0xC80 + i
+		CSRMap[fmt.Sprintf("mhpmcounter%d", i)] = 0xB00 + i
+		CSRMap[fmt.Sprintf("mhpmcounter%dh", i)] = 0xB80 + i
+		CSRMap[fmt.Sprintf("mhpmevent%d", i)] = 0x320 + i
+	}
+	for i := 0; i <= 15; i++ {
+		CSRMap[fmt.Sprintf("pmpcfg%d", i)] = 0x3A0 + i
+	}
+	for i := 0; i <= 63; i++ {
+		CSRMap[fmt.Sprintf("pmpaddr%d", i)] = 0x3B0 + i
+	}
+}
+
+func isCSR(val string) bool {
+	_, exists := CSRMap[val]
+	return exists
+}
+
+// CSR名または数値からCSRアドレスを返す。検証済みであることが前提
+func CSRNumber(val string) int {
+	if n, exists := CSRMap[val]; exists {
+		return n
+	}
+	return int(ImmValue(val))
+}
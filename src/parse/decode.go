@@ -0,0 +1,188 @@
+package parse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 逆アセンブルで使うレジスタ名
+var abiRegisterNames = [32]string{
+	"zero", "ra", "sp", "gp", "tp", "t0", "t1", "t2",
+	"s0", "s1", "a0", "a1", "a2", "a3", "a4", "a5",
+	"a6", "a7", "s2", "s3", "s4", "s5", "s6", "s7",
+	"s8", "s9", "s10", "s11", "t3", "t4", "t5", "t6",
+}
+
+/*
+命令を RegisterExtension で登録された命令の定義から逆アセンブルする
+下位2bitが0b11でなければ下位16bitをRVC命令として読む
+複数の命令に一致する場合は、固定されたビットが最も多い命令を選ぶ (zext.h と pack、csrr と csrrs など)
+同じ数なら疑似命令でない方を選ぶ
+*/
+func Disassemble(insn uint32) (string, bool) {
+	size := 4
+	if insn&0b11 != 0b11 {
+		insn &= 0xffff
+		size = 2
+	}
+
+	name, spec, found := "", InstructionSpec{}, false
+	for n, s := range instructionSpecs {
+		if s.Format == PseudoType || s.Size() != size || insn&s.mask != s.match || !s.decodable(insn) {
+			continue
+		}
+		if found && !s.preferredTo(n, spec, name) {
+			continue
+		}
+		name, spec, found = n, s, true
+	}
+	if !found {
+		return "", false
+	}
+	return name + spec.formatOperands(insn), true
+}
+
+// 逆アセンブルで命令nameの定義sを other より優先するか
+func (s InstructionSpec) preferredTo(name string, other InstructionSpec, otherName string) bool {
+	if c := s.specificity() - other.specificity(); c != 0 {
+		return c > 0
+	}
+	if (s.Alias == "") != (other.Alias == "") {
+		return s.Alias == ""
+	}
+	return name < otherName
+}
+
+// すべてのオペランドがその命令でとれる値になっているか
+// 複数のフィールドに置くオペランドは、すべてのフィールドが同じ値でなければならない
+func (s InstructionSpec) decodable(insn uint32) bool {
+	for _, opr := range s.operands {
+		if opr.literal {
+			continue
+		}
+		val := opr.layout.decode(insn, opr.signed)
+		if opr.layout.encode(val) != insn&opr.layout.mask() {
+			return false
+		}
+		if opr.typ&(REG|CREG|VREG|VMASK|FENCESET|CSR) == 0 && !opr.acceptsValue(val) || containsInt(opr.invalid, val) {
+			return false
+		}
+	}
+	return true
+}
+
+// 書式に従ってオペランドを文字列にする
+// 省略できるオペランドがすべて省略時の値なら書かない
+func (s InstructionSpec) formatOperands(insn uint32) string {
+	syntax := s.Syntax
+	if start := strings.Index(syntax, "["); start >= 0 {
+		omit := true
+		for _, opr := range s.operands {
+			if opr.optional && opr.layout.decode(insn, false) != opr.def {
+				omit = false
+			}
+		}
+		if omit {
+			syntax = strings.TrimRight(syntax[:start], ", ")
+		}
+	}
+	syntax = strings.NewReplacer("[", "", "]", "").Replace(syntax)
+
+	var sb strings.Builder
+	i := 0
+	for _, opr := range s.operands {
+		idx := strings.Index(syntax[i:], opr.name)
+		if idx < 0 {
+			break
+		}
+		sb.WriteString(syntax[i : i+idx])
+		sb.WriteString(opr.format(opr.layout.decode(insn, opr.signed)))
+		i += idx + len(opr.name)
+	}
+	sb.WriteString(syntax[i:])
+	if sb.Len() == 0 {
+		return ""
+	}
+	return " " + sb.String()
+}
+
+func (opr specOperand) format(val int64) string {
+	switch {
+	case opr.literal:
+		return opr.name
+	case opr.typ&CREG != 0:
+		return abiRegisterNames[val+8]
+	case opr.typ&REG != 0:
+		return abiRegisterNames[val]
+	case opr.typ&VREG != 0:
+		return fmt.Sprintf("v%d", val)
+	case opr.typ&VMASK != 0:
+		return VectorMask
+	case opr.typ&VTYPE != 0:
+		return vtypeString(val)
+	case opr.typ&FENCESET != 0:
+		var set strings.Builder
+		for i, c := range "iorw" {
+			if val>>(3-i)&1 == 1 {
+				set.WriteRune(c)
+			}
+		}
+		if set.Len() == 0 {
+			return "0"
+		}
+		return set.String()
+	case opr.typ&CSR != 0:
+		if name, exists := csrNames()[int(val)]; exists {
+			return name
+		}
+		return fmt.Sprintf("%#x", val)
+	case opr.wrap != 0:
+		if val < 0 {
+			val += 1 << opr.wrap
+		}
+		return fmt.Sprintf("%#x", val)
+	case opr.name == "imm" && !opr.signed:
+		return fmt.Sprintf("%#x", val)
+	}
+	return fmt.Sprint(val)
+}
+
+// vtypeの即値を "e32,m4,ta,ma" 形式にする。予約された値は数値のまま書く
+func vtypeString(val int64) string {
+	name := func(values map[string]int, v int64) string {
+		for n, value := range values {
+			if int64(value) == v {
+				return n
+			}
+		}
+		return ""
+	}
+	fields := []string{
+		name(vtypeSEW, val>>3&0b111),
+		name(vtypeLMUL, val&0b111),
+		name(vtypeTail, val>>6&1),
+		name(vtypeMask, val>>7&1),
+	}
+	for _, f := range fields {
+		if f == "" || val>>8 != 0 {
+			return fmt.Sprintf("%#x", val)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// CSRアドレスとCSR名の対応
+// 同じアドレスに複数の名前があれば辞書順で先の名前を使う
+func csrNames() map[int]string {
+	names := map[int]string{}
+	var keys []string
+	for name := range CSRMap {
+		keys = append(keys, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	for _, name := range keys {
+		names[CSRMap[name]] = name
+	}
+	return names
+}
@@ -3,14 +3,16 @@ package parse
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 type Directive struct {
-	name    string
-	args    []string
-	argTyps []DirectiveArgType
-	src     []rune
-	idx     int
+	name     string
+	args     []string
+	argTyps  []DirectiveArgType
+	src      []rune
+	idx      int
+	valStart int // 最後に読んだ引数のsrcでの位置。エラーの列に使う
 	// 引数自体がvalidかどうかはparseで判断
 }
 
@@ -23,6 +25,7 @@ func (d *Directive) isEOF() bool {
 func (d *Directive) nextVal() (string, DirectiveArgType) {
 	isLiteral := false
 	start := d.idx
+	d.valStart = start
 	for ; d.idx < len(d.src); d.idx++ {
 		if '"' == d.src[d.idx] && !isLiteral {
 			isLiteral = true
@@ -56,10 +59,47 @@ func (d *Directive) skipUntilNextVal() {
 func analyzeDirArgType(val string) DirectiveArgType {
 	if IsImmediate(val) {
 		return INT
+	} else if _, _, ok := LabelDiff(val); ok {
+		return DIFF
 	}
 	return STR
 }
 
+/*
+"end-start" 形式のラベルの差を2つのラベルに分ける
+*/
+func LabelDiff(val string) (string, string, bool) {
+	a, b, found := strings.Cut(val, "-")
+	if !found || a == "" || b == "" || strings.ContainsAny(val, "\"") || IsImmediate(a) || IsImmediate(b) {
+		return "", "", false
+	}
+	return a, b, true
+}
+
+// "end - start" のように空白を挟んだラベルの差を1つの引数にまとめる
+func (d *Directive) joinLabelDiff(first string) string {
+	i := d.idx
+	for i < len(d.src) && (d.src[i] == ' ' || d.src[i] == '\t') {
+		i++
+	}
+	if !strings.HasSuffix(first, "-") {
+		if i == len(d.src) || d.src[i] != '-' {
+			return first
+		}
+		first += "-"
+		i++
+		for i < len(d.src) && (d.src[i] == ' ' || d.src[i] == '\t') {
+			i++
+		}
+	}
+	d.idx = i
+	if d.isEOF() {
+		return first
+	}
+	next, _ := d.nextVal()
+	return first + next
+}
+
 func (d Directive) isSection() bool {
 	return d.name == Text || d.name == Data || d.name == RoData || d.name == Bss
 }
@@ -88,19 +128,20 @@ const (
 	Macro   = ".macro"
 	Endm    = ".endm"
 	Type    = ".type"
-	// Option     = ".option"
-	Byte  = ".byte"
-	Byte2 = ".2byte"
-	Half  = ".half"
-	Short = ".short"
-	Byte4 = ".4byte"
-	Word  = ".word"
-	Long  = ".long"
+	Option  = ".option"
+	Byte    = ".byte"
+	Byte2   = ".2byte"
+	Half    = ".half"
+	Short   = ".short"
+	Byte4   = ".4byte"
+	Word    = ".word"
+	Long    = ".long"
 	// Float      = ".float"
 	// DtprelWord = ".dtprelword"
 	Zero = ".zero"
 	// VariantCC = ".variant_cc"
 	Attribute = ".attribute"
+	Reloc     = ".reloc"
 )
 
 type DirectiveArgType int
@@ -108,6 +149,7 @@ type DirectiveArgType int
 const (
 	INT DirectiveArgType = 1 << iota
 	STR
+	DIFF // ラベルの差 (end-start)
 )
 
 var directiveSet = map[string][]DirectiveArgType{
@@ -132,19 +174,37 @@ var directiveSet = map[string][]DirectiveArgType{
 	Macro:   {STR},
 	Endm:    {},
 	Type:    {STR, INT},
-	// Option:     {},
-	Byte:  {INT},
-	Byte2: {INT},
-	Half:  {INT},
-	Short: {INT},
-	Byte4: {INT},
-	Word:  {INT},
-	Long:  {INT},
+	Option:  {STR},
+	Byte:    {INT | DIFF},
+	Byte2:   {INT | DIFF},
+	Half:    {INT | DIFF},
+	Short:   {INT | DIFF},
+	Byte4:   {INT | DIFF},
+	Word:    {INT | DIFF},
+	Long:    {INT | DIFF},
 	// Float:      {},
 	// DtprelWord: {},
 	Zero: {INT},
 	// VariantCC: {STR},
-	Attribute: {STR, INT},
+	Attribute: {STR | INT, STR | INT}, // タグは名前か数値、値は文字列か数値
+	Insn:      {},                     // 引数はparseInsnで読む
+	Reloc:     {INT | STR, INT | STR}, // オフセット, 再配置の種類[, シンボル+加数]
+}
+
+// 最後の引数を","区切りで複数並べられるディレクティブ
+// (例: .option arch, +zba, -c)
+var variadicDirectives = map[string]bool{
+	Option:  true,
+	Section: true, // .section .tdata,"awT",@progbits
+	Reloc:   true, // .reloc ., R_RISCV_SET32, sym+4
+}
+
+// .sectionのフラグ("awT")か種類(@progbits)かどうか
+func isSectionAttribute(val string) bool {
+	if len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"' {
+		return strings.Trim(val[1:len(val)-1], "awxMSGT") == ""
+	}
+	return len(val) > 1 && (val[0] == '@' || val[0] == '%')
 }
 
 var directiveMap = map[string]func() error{
@@ -181,11 +241,14 @@ var directiveMap = map[string]func() error{
 
 func (st *Stmt) parseDirective(val string) error {
 	d := Directive{
-		name:    val,
-		argTyps: directiveSet[val],
-		src:     st.src,
-		idx:     st.idx,
+		name:     val,
+		argTyps:  directiveSet[val],
+		src:      st.src,
+		idx:      st.idx,
+		valStart: st.idx,
 	}
+	// エラーの列は最後に読んだ引数の位置にする
+	defer func() { st.errIdx = d.valStart }()
 
 	// 必要な引数の分だけコードを読み進めながらパース
 	argTypIdx := 0
@@ -193,6 +256,10 @@ func (st *Stmt) parseDirective(val string) error {
 
 	for !d.isEOF() && argTypIdx < len(d.argTyps) {
 		val, typ := d.nextVal()
+		if d.argTyps[argTypIdx]&DIFF != 0 {
+			val = d.joinLabelDiff(val)
+			typ = analyzeDirArgType(val)
+		}
 		if d.argTyps[argTypIdx]&typ == 0 {
 			return errors.New(fmt.Sprintf(ErrMsg, val[0]))
 		}
@@ -201,13 +268,36 @@ func (st *Stmt) parseDirective(val string) error {
 		argTypIdx++
 	}
 
+	// 可変長の引数を読む
+	for variadicDirectives[d.name] && !d.isEOF() && argTypIdx == len(d.argTyps) {
+		val, typ := d.nextVal()
+		if d.argTyps[argTypIdx-1]&typ == 0 || (d.name == Section && !isSectionAttribute(val)) {
+			return errors.New(fmt.Sprintf(ErrMsg, val[0]))
+		}
+		d.args = append(d.args, val)
+		d.skipUntilNextVal()
+	}
+
 	// その行に文字列が残っていたらエラー
 	if argTypIdx != len(d.argTyps) {
+		d.valStart = d.idx
 		return errors.New("missing argument.")
 	} else if !d.isEOF() {
+		d.valStart = d.idx
 		return errors.New(fmt.Sprintf(ErrMsg, d.src[d.idx]))
 	}
 
+	if d.name == Attribute {
+		if err := d.normalizeAttribute(); err != nil {
+			return err
+		}
+	}
+	if d.name == Reloc {
+		if err := d.checkReloc(); err != nil {
+			return err
+		}
+	}
+
 	if d.isSection() {
 		st.section = d.name
 	}
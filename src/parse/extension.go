@@ -0,0 +1,127 @@
+package parse
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/ayase-mstk/go32as/src/isa"
+)
+
+/*
+命令セット拡張
+RegisterExtension で登録すると、-march でその拡張を有効にしたときに
+パーサー、エンコーダ、逆アセンブラがその命令を扱えるようになる
+組み込みの命令もすべてこの形で登録している
+*/
+type Extension struct {
+	Name         string                     // -march で使う拡張名。ベンダー拡張は "x" で始める
+	Version      isa.Version                // Tag_RISCV_arch に書くバージョン。省略すると1.0
+	Implies      []string                   // この拡張と一緒に有効になる拡張
+	Instructions map[string]InstructionSpec // 命令名と命令の定義
+}
+
+/*
+命令の定義
+パーサーのオペランドの検証、エンコード、逆アセンブルはすべてこの定義から行う
+Syntaxに書けるオペランドは rd, rs1, rs2, imm, shamt, bs, csr, zimm, pred, succ, ベクトル命令の vd, vs1, vs2 等と
+RVC命令の c_imm6 等で、immの配置はFormat (IType, SType, BType, UType, JType) で決まる
+"sp" や "v0" のようにレジスタ名を書くと、そのレジスタしかとらないオペランドになる
+Aliasを指定すると、別の命令のオペランドを固定した疑似命令になる。Formatは展開先の命令と同じになる
+*/
+type InstructionSpec struct {
+	Format OpecodeType // 命令形式 (RType, IType, ...)
+	Syntax string      // オペランドの書式 (例: "rd, rs1, rs2", "rd, imm(rs1)")
+	Fields Fields      // オペランドが使わないビットの値
+	Reloc  string      // オペランドのシンボルに付けるリロケーションファンクション ("%lo" 等)。空か%lo等が付いていれば形式から決める
+	Alias  string      // 展開先の命令とオペランド (例: "csrrs rd, csr, x0")
+
+	VGroup  int  // 0でなければ、ベクトルレジスタのオペランドはVGroup個の組で、番号はVGroupの倍数 (vmv2r.v など)
+	MaskDst bool // v0.tをとっても結果をv0に書ける。結果がマスクかvd[0]だけの命令 (比較、リダクション)
+
+	operands []specOperand // Syntaxを解釈したもの
+	match    uint32
+	mask     uint32
+}
+
+// 命令ごとに固定のフィールドの値
+// オペランドと重なるビットは無視される。RVC命令では括弧内の位置に置く
+type Fields struct {
+	Opcode int // bits[6:0] (RVC: bits[1:0])
+	Rd     int // bits[11:7] (RVC: bits[11:7])
+	Funct3 int // bits[14:12] (RVC: bits[15:13])
+	Rs1    int // bits[19:15] (RVC: bits[11:7])
+	Rs2    int // bits[24:20] (RVC: bits[6:2])
+	Funct7 int // bits[31:25]
+	Funct2 int // RVC: bits[6:5]
+	Funct4 int // RVC: bits[15:12]
+	Funct6 int // RVC: bits[15:10]
+}
+
+// 基本命令セット。-march で "i" と "e" のどちらを選んでも使える
+const baseExtension = "i"
+
+// 登録された命令の定義
+var instructionSpecs = map[string]InstructionSpec{}
+
+/*
+拡張とその命令を登録する
+既に登録されている拡張には命令を追加する
+同じ命令を複数の拡張に登録する場合は、定義が一致していなければならない
+*/
+func RegisterExtension(ext Extension) error {
+	// 疑似命令は展開先の命令の定義を使うので後から解釈する
+	specs := map[string]InstructionSpec{}
+	lookup := func(name string) (InstructionSpec, bool) {
+		if spec, exists := specs[name]; exists {
+			return spec, true
+		}
+		return LookupInstruction(name)
+	}
+	for _, alias := range []bool{false, true} {
+		for name, spec := range ext.Instructions {
+			if (spec.Alias != "") != alias {
+				continue
+			}
+			if err := spec.compile(name, lookup); err != nil {
+				return err
+			}
+			specs[name] = spec
+		}
+	}
+
+	for name, spec := range specs {
+		if registered, exists := instructionSpecs[name]; exists && !reflect.DeepEqual(registered, spec) {
+			return fmt.Errorf("instruction `%s' is already defined with a different encoding", name)
+		}
+	}
+
+	if !isa.IsExtension(ext.Name) {
+		if err := isa.RegisterExtension(ext.Name, ext.Version, ext.Implies); err != nil {
+			return err
+		}
+	}
+
+	for name, spec := range specs {
+		instructionSpecs[name] = spec
+		OpecodeMap[name] = OpecodeInfo{spec.Format, spec.operandTypes()}
+		if ext.Name != baseExtension && !contains(requiredExtension[name], ext.Name) {
+			requiredExtension[name] = append(requiredExtension[name], ext.Name)
+			sort.Strings(requiredExtension[name])
+		}
+	}
+	return nil
+}
+
+// RegisterExtension と同じだが、登録に失敗したらpanicする。init関数から使う
+func MustRegisterExtension(ext Extension) {
+	if err := RegisterExtension(ext); err != nil {
+		panic(err)
+	}
+}
+
+// 登録された命令の定義を返す
+func LookupInstruction(name string) (InstructionSpec, bool) {
+	spec, exists := instructionSpecs[name]
+	return spec, exists
+}
@@ -0,0 +1,301 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// .insn ディレクティブ
+// 命令名の代わりに形式とフィールドの値を指定して、任意の命令を出力する
+const Insn = ".insn"
+
+// .insnで指定された命令のフィールド
+type InsnFields struct {
+	Opcode int    // opcode。RVC命令ではop(bits[1:0])
+	Funct  int    // funct3。crではfunct4、caではfunct6
+	Funct2 int    // rではfunct7、r4とcaではfunct2
+	Len    int    // 値を直接指定した場合の命令長(2か4)
+	Value  uint32 // 値を直接指定した場合の命令
+}
+
+// .insnの命令形式
+type insnFormat struct {
+	opcTyp  OpecodeType
+	fields  []string      // opcodeとfunctフィールドの名前
+	oprTyps []OperandType // 命令のオペランド。エンコーダに渡す順に並べる
+	layouts []bitLayout   // oprTypsの各オペランドを置くビット
+	memory  bool          // "rd, imm(rs1)" の順に書く形式
+	immMin  int64         // 即値の範囲
+	immMax  int64
+}
+
+// フィールドの最大値
+var insnFieldMax = map[string]int64{
+	"opcode":            127,
+	"compressed opcode": 2,
+	"funct2":            3,
+	"funct3":            7,
+	"funct4":            15,
+	"funct6":            63,
+	"funct7":            127,
+}
+
+// 形式ごとのフィールドとオペランド
+// 同じ形式に複数の書き方がある場合は先頭から順に試す
+var insnFormats = map[string][]insnFormat{
+	"r":  {{opcTyp: RType, fields: []string{"opcode", "funct3", "funct7"}, oprTyps: []OperandType{REG, REG, REG}, layouts: []bitLayout{rdField, rs1Field, rs2Field}}},
+	"r4": {{opcTyp: R4Type, fields: []string{"opcode", "funct3", "funct2"}, oprTyps: []OperandType{REG, REG, REG, REG}, layouts: []bitLayout{rdField, rs1Field, rs2Field, rs3Field}}},
+	"i": {
+		{opcTyp: IType, fields: []string{"opcode", "funct3"}, oprTyps: []OperandType{REG, REG, IMM | LAB}, layouts: []bitLayout{rdField, rs1Field, immLayouts[IType]}, immMin: -2048, immMax: 2047},
+		{opcTyp: IType, fields: []string{"opcode", "funct3"}, oprTyps: []OperandType{REG, REG, IMM | LAB}, layouts: []bitLayout{rdField, rs1Field, immLayouts[IType]}, memory: true, immMin: -2048, immMax: 2047},
+	},
+	"s": {{opcTyp: SType, fields: []string{"opcode", "funct3"}, oprTyps: []OperandType{REG, IMM | LAB, REG}, layouts: []bitLayout{rs2Field, immLayouts[SType], rs1Field}, immMin: -2048, immMax: 2047}},
+	"b": {{opcTyp: BType, fields: []string{"opcode", "funct3"}, oprTyps: []OperandType{REG, REG, IMM | LAB}, layouts: []bitLayout{rs1Field, rs2Field, immLayouts[BType]}, immMin: -4096, immMax: 4094}},
+	"u": {{opcTyp: UType, fields: []string{"opcode"}, oprTyps: []OperandType{REG, IMM | LAB}, layouts: []bitLayout{rdField, immLayouts[UType]}, immMin: 0, immMax: 0xfffff}},
+	"j": {{opcTyp: JType, fields: []string{"opcode"}, oprTyps: []OperandType{REG, IMM | LAB}, layouts: []bitLayout{rdField, immLayouts[JType]}, immMin: -1048576, immMax: 1048574}},
+
+	// RVCの形式の即値は命令ごとの並べ替えをせず、形式の即値フィールドにそのまま入れる
+	// cbとcjだけは分岐先のオフセットとして並べ替える
+	"cr":  {{opcTyp: CRType, fields: []string{"compressed opcode", "funct4"}, oprTyps: []OperandType{REG, REG}, layouts: []bitLayout{cRdField, cRs2Field}}},
+	"ci":  {{opcTyp: CIType, fields: []string{"compressed opcode", "funct3"}, oprTyps: []OperandType{REG, IMM}, layouts: []bitLayout{cRdField, cImm6Layout}, immMin: -32, immMax: 31}},
+	"ciw": {{opcTyp: CIWType, fields: []string{"compressed opcode", "funct3"}, oprTyps: []OperandType{CREG, IMM}, layouts: []bitLayout{cPrimeLoField, {{12, 5, 0}}}, immMin: 0, immMax: 255}},
+	"css": {{opcTyp: CSSType, fields: []string{"compressed opcode", "funct3"}, oprTyps: []OperandType{REG, IMM}, layouts: []bitLayout{cRs2Field, {{12, 7, 0}}}, immMin: 0, immMax: 63}},
+	"cl":  {{opcTyp: CLType, fields: []string{"compressed opcode", "funct3"}, oprTyps: []OperandType{CREG, IMM, CREG}, layouts: []bitLayout{cPrimeLoField, {{12, 10, 2}, {6, 5, 0}}, cPrimeHiField}, immMin: 0, immMax: 31}},
+	"cs":  {{opcTyp: CSType, fields: []string{"compressed opcode", "funct3"}, oprTyps: []OperandType{CREG, IMM, CREG}, layouts: []bitLayout{cPrimeLoField, {{12, 10, 2}, {6, 5, 0}}, cPrimeHiField}, immMin: 0, immMax: 31}},
+	"ca":  {{opcTyp: CAType, fields: []string{"compressed opcode", "funct6", "funct2"}, oprTyps: []OperandType{CREG, CREG}, layouts: []bitLayout{cPrimeHiField, cPrimeLoField}}},
+	"cb":  {{opcTyp: CBType, fields: []string{"compressed opcode", "funct3"}, oprTyps: []OperandType{CREG, IMM | LAB}, layouts: []bitLayout{cPrimeHiField, cBimm9Layout}, immMin: -256, immMax: 254}},
+	"cj":  {{opcTyp: CJType, fields: []string{"compressed opcode", "funct3"}, oprTyps: []OperandType{IMM | LAB}, layouts: []bitLayout{cImm12Layout}, immMin: -2048, immMax: 2046}},
+}
+
+// opcodeとfunctフィールドを置くビット
+var insnFieldLayouts = map[string]bitLayout{
+	"opcode": opcodeField,
+	"funct3": funct3Field,
+	"funct2": {{26, 25, 0}},
+	"funct7": funct7Field,
+}
+
+// RVCの形式でのopcodeとfunctフィールドの位置
+var compressedInsnFieldLayouts = map[string]bitLayout{
+	"compressed opcode": cOpcodeField,
+	"funct2":            {{6, 5, 0}},
+	"funct3":            cFunct3Field,
+	"funct4":            cFunct4Field,
+	"funct6":            cFunct6Field,
+}
+
+// 形式の別名
+var insnFormatAliases = map[string]string{
+	"sb": "b",
+	"uj": "j",
+}
+
+// opcodeフィールドに名前で指定できる値
+var insnOpcodes = map[string]int{
+	"C0": 0x0, "C1": 0x1, "C2": 0x2,
+	"LOAD":      0x03,
+	"LOAD_FP":   0x07,
+	"CUSTOM_0":  0x0b,
+	"MISC_MEM":  0x0f,
+	"OP_IMM":    0x13,
+	"AUIPC":     0x17,
+	"OP_IMM_32": 0x1b,
+	"STORE":     0x23,
+	"STORE_FP":  0x27,
+	"CUSTOM_1":  0x2b,
+	"AMO":       0x2f,
+	"OP":        0x33,
+	"LUI":       0x37,
+	"OP_32":     0x3b,
+	"MADD":      0x43,
+	"MSUB":      0x47,
+	"NMSUB":     0x4b,
+	"NMADD":     0x4f,
+	"OP_FP":     0x53,
+	"OP_V":      0x57,
+	"CUSTOM_2":  0x5b,
+	"BRANCH":    0x63,
+	"JALR":      0x67,
+	"JAL":       0x6f,
+	"SYSTEM":    0x73,
+	"CUSTOM_3":  0x7b,
+}
+
+func init() {
+	// RVCの形式はC拡張が有効なときだけ使える
+	for name, formats := range insnFormats {
+		if formats[0].opcTyp >= CRType && formats[0].opcTyp <= CJType {
+			requiredExtension[Insn+" "+name] = []string{"c"}
+		}
+	}
+}
+
+func (o *Operation) Insn() *InsnFields { return o.insn }
+
+/*
+.insn の行を命令としてパースする
+".insn r CUSTOM_0, 0, 0, a0, a1, a2" のように形式とフィールドを指定するか
+".insn 4, 0x00000013" のように命令の値を直接指定する
+*/
+func (s *Stmt) parseInsn() error {
+	op := Operation{
+		mnemonic: Insn,
+		src:      s.src[s.idx:],
+	}
+	op.skipUntilNextOperand()
+	if op.isEOF() {
+		return errors.New("missing argument.")
+	}
+	name, typ := op.nextOperand()
+
+	var err error
+	if typ == IMM {
+		op.idx = 0
+		err = op.parseRawInsn()
+	} else {
+		err = op.parseInsnFormat(name)
+	}
+	s.errIdx = s.idx + op.oprStart
+	if err != nil {
+		return err
+	}
+	s.op = &op
+	return nil
+}
+
+// 値を直接指定した .insn [長さ,] 値
+func (o *Operation) parseRawInsn() error {
+	o.opcode = Insn
+	o.info = OpecodeInfo{RawType, []OperandType{IMM, IMM | OPT}}
+	if err := o.handleByOpType(); err != nil {
+		return err
+	}
+
+	value := ImmValue(o.operands[len(o.operands)-1])
+	length := int64(2)
+	if value&0b11 == 0b11 {
+		length = 4
+	}
+	if len(o.operands) == 2 && ImmValue(o.operands[0]) != length {
+		return errors.New("value conflicts with instruction length")
+	}
+	if !inRange(value, 0, 1<<(length*8)-1) {
+		return fmt.Errorf("value %#x does not fit in %d bytes", value, length)
+	}
+	o.insn = &InsnFields{Len: int(length), Value: uint32(value)}
+	o.operands = nil
+	o.info.oprTyps = nil
+	return nil
+}
+
+// 形式を指定した .insn
+func (o *Operation) parseInsnFormat(name string) error {
+	if alias, exists := insnFormatAliases[name]; exists {
+		name = alias
+	}
+	formats, exists := insnFormats[name]
+	if !exists {
+		return fmt.Errorf("unknown .insn format `%s'", name)
+	}
+
+	start := o.idx
+	for i, format := range formats {
+		o.idx, o.operands, o.relFunc = start, nil, ""
+		o.setInsnFormat(name, format)
+		if err := o.handleByOpType(); err != nil {
+			if i < len(formats)-1 {
+				continue
+			}
+			return err
+		}
+		return o.resolveInsnFields(format)
+	}
+	return nil
+}
+
+// 形式に合わせて、フィールドに続けてオペランドを読むように設定する
+func (o *Operation) setInsnFormat(name string, format insnFormat) {
+	o.opcode = Insn + " " + name
+	oprTyps := format.oprTyps
+	if format.memory {
+		// imm(rs1) の順に書かれる
+		oprTyps = []OperandType{oprTyps[0], oprTyps[2], oprTyps[1]}
+	}
+	// opcodeだけは名前でも指定できる
+	fieldTyps := []OperandType{IMM | LAB}
+	for range format.fields[1:] {
+		fieldTyps = append(fieldTyps, IMM)
+	}
+	o.info = OpecodeInfo{format.opcTyp, append(fieldTyps, oprTyps...)}
+}
+
+// 読んだフィールドの値をInsnFieldsに移し、オペランドをエンコーダに渡す順に並べる
+func (o *Operation) resolveInsnFields(format insnFormat) error {
+	fields := make([]int, 3)
+	for i, field := range format.fields {
+		val, err := insnFieldValue(field, o.operands[i])
+		if err != nil {
+			return err
+		}
+		fields[i] = val
+	}
+	o.insn = &InsnFields{Opcode: fields[0], Funct: fields[1], Funct2: fields[2]}
+
+	o.operands = o.operands[len(format.fields):]
+	if format.memory {
+		o.operands[1], o.operands[2] = o.operands[2], o.operands[1]
+	}
+	o.info.oprTyps = format.oprTyps
+
+	// 即値にシンボルが使われていれば範囲はリンク時に決まる
+	for i, typ := range o.info.oprTyps {
+		if typ&IMM != 0 && IsImmediate(o.operands[i]) {
+			if imm := ImmValue(o.operands[i]); !inRange(imm, format.immMin, format.immMax) {
+				return fmt.Errorf("immediate value %d out of range (%d...%d)", imm, format.immMin, format.immMax)
+			}
+		}
+	}
+	return nil
+}
+
+// フィールドの値を数値にして範囲を確かめる
+func insnFieldValue(field, val string) (int, error) {
+	var n int64
+	if IsImmediate(val) {
+		n = ImmValue(val)
+	} else if code, exists := insnOpcodes[strings.ToUpper(val)]; exists {
+		n = int64(code)
+	} else {
+		return 0, fmt.Errorf("bad value for %s field: %s", field, val)
+	}
+	if !inRange(n, 0, insnFieldMax[field]) {
+		return 0, fmt.Errorf("bad value for %s field, value must be 0...%d", field, insnFieldMax[field])
+	}
+	return int(n), nil
+}
+
+/*
+.insnの命令をフィールドの値とオペランドからエンコードする
+シンボルの値は resolve で求める
+*/
+func (o *Operation) EncodeInsn(resolve func(string) int) uint32 {
+	if o.info.opcTyp == RawType {
+		return o.insn.Value
+	}
+	format := insnFormats[strings.TrimPrefix(o.opcode, Insn+" ")][0]
+	fieldLayouts := insnFieldLayouts
+	if o.Size() == 2 {
+		fieldLayouts = compressedInsnFieldLayouts
+	}
+
+	values := []int{o.insn.Opcode, o.insn.Funct, o.insn.Funct2}
+	var insn uint32
+	for i, field := range format.fields {
+		insn |= fieldLayouts[field].encode(int64(values[i]))
+	}
+	for i, layout := range format.layouts {
+		insn |= layout.encode(operandValue(format.oprTyps[i], o.operands[i], resolve))
+	}
+	return insn
+}
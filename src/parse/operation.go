@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -58,49 +59,63 @@ const (
 
 	// J format
 	JAL = "jal"
+
+	// FENCE
+	FENCE    = "fence"
+	FENCETSO = "fence.tso"
+	PAUSE    = "pause"   // Zihintpause
+	FENCEI   = "fence.i" // Zifencei
 )
 
-var RegisterSet = map[string]bool{
-	"x0": true, "zero": true,
-	"x1": true, "ra": true,
-	"x2": true, "sp": true,
-	"x3": true, "gp": true,
-	"x4": true, "tp": true,
-	"x5": true, "t0": true,
-	"x6": true, "t1": true,
-	"x7": true, "t2": true,
-	"x8": true, "s0": true, "fp": true,
-	"x9": true, "s1": true,
-	"x10": true, "a0": true,
-	"x11": true, "a1": true,
-	"x12": true, "a2": true,
-	"x13": true, "a3": true,
-	"x14": true, "a4": true,
-	"x15": true, "a5": true,
-	"x16": true, "a6": true,
-	"x17": true, "a7": true,
-	"x18": true, "s2": true,
-	"x19": true, "s3": true,
-	"x20": true, "s4": true,
-	"x21": true, "s5": true,
-	"x22": true, "s6": true,
-	"x23": true, "s7": true,
-	"x24": true, "s8": true,
-	"x25": true, "s9": true,
-	"x26": true, "s10": true,
-	"x27": true, "s11": true,
-	"x28": true, "t3": true,
-	"x29": true, "t4": true,
-	"x30": true, "t5": true,
-	"x31": true, "t6": true,
+// レジスタ名とレジスタ番号の対応
+var RegisterSet = map[string]int{
+	"x0": 0, "zero": 0,
+	"x1": 1, "ra": 1,
+	"x2": 2, "sp": 2,
+	"x3": 3, "gp": 3,
+	"x4": 4, "tp": 4,
+	"x5": 5, "t0": 5,
+	"x6": 6, "t1": 6,
+	"x7": 7, "t2": 7,
+	"x8": 8, "s0": 8, "fp": 8,
+	"x9": 9, "s1": 9,
+	"x10": 10, "a0": 10,
+	"x11": 11, "a1": 11,
+	"x12": 12, "a2": 12,
+	"x13": 13, "a3": 13,
+	"x14": 14, "a4": 14,
+	"x15": 15, "a5": 15,
+	"x16": 16, "a6": 16,
+	"x17": 17, "a7": 17,
+	"x18": 18, "s2": 18,
+	"x19": 19, "s3": 19,
+	"x20": 20, "s4": 20,
+	"x21": 21, "s5": 21,
+	"x22": 22, "s6": 22,
+	"x23": 23, "s7": 23,
+	"x24": 24, "s8": 24,
+	"x25": 25, "s9": 25,
+	"x26": 26, "s10": 26,
+	"x27": 27, "s11": 27,
+	"x28": 28, "t3": 28,
+	"x29": 29, "t4": 29,
+	"x30": 30, "t5": 30,
+	"x31": 31, "t6": 31,
 }
 
 type OperandType int
 
 const (
-	REG OperandType = 1 << iota // 0x00000001
-	IMM                         // 0x00000010
-	LAB                         // 0x00000100
+	REG      OperandType = 1 << iota // 0x00000001
+	IMM                              // 0x00000010
+	LAB                              // 0x00000100
+	CREG                             // 0x00001000 RVCで指定できるx8-x15のレジスタ
+	CSR                              // 0x00010000 CSR名
+	OPT                              // 0x00100000 省略可能なオペランド
+	FENCESET                         // 0x01000000 fenceのiorw集合
+	VREG                             // ベクトルレジスタ v0-v31
+	VMASK                            // マスクオペランド v0.t
+	VTYPE                            // vsetvliのvtype (e32, m4, ta, ma)
 )
 
 type OpecodeInfo struct {
@@ -118,63 +133,123 @@ const (
 	BType
 	JType
 	UType
+	FenceType
+	UnaryType  // rs2フィールドが固定の1オペランド命令
+	BsType     // bs(byte select)を取るスカラー暗号命令
+	R4Type     // rs3をとる命令 (.insn r4)
+	RawType    // 値を直接指定した命令 (.insn 4, 0x13)
+	PseudoType // 複数の命令に展開される疑似命令 (call, tail)
+
+	// RVC (C extension)
+	CRType
+	CIType
+	CSSType
+	CIWType
+	CLType
+	CSType
+	CAType
+	CBType
+	CJType
+
+	// Zicsr, 特権命令
+	CSRType
+	CSRIType
+	SysType
+
+	// Vector (V extension)
+	VCfgType    // vsetvli, vsetivli, vsetvl
+	VMemType    // ベクトルのロード、ストア
+	VArithType  // vd, vs2, vs1/rs1/imm
+	VMulAddType // vd, vs1/rs1, vs2 の順にオペランドをとる積和演算
+	VUnaryType  // vd, vs2 でvs1フィールドが固定
+	VMoveType   // vd, vs1/rs1/imm でvs2フィールドが0
+	VMergeType  // vd, vs2, vs1/rs1/imm, v0 でv0をマスクとして使う
 )
 
-var OpecodeMap = map[string]OpecodeInfo{
-	ADD:  {RType, []OperandType{REG, REG, REG}},
-	SUB:  {RType, []OperandType{REG, REG, REG}},
-	XOR:  {RType, []OperandType{REG, REG, REG}},
-	OR:   {RType, []OperandType{REG, REG, REG}},
-	AND:  {RType, []OperandType{REG, REG, REG}},
-	SLL:  {RType, []OperandType{REG, REG, REG}},
-	SRL:  {RType, []OperandType{REG, REG, REG}},
-	SRA:  {RType, []OperandType{REG, REG, REG}},
-	SLT:  {RType, []OperandType{REG, REG, REG}},
-	SLTU: {RType, []OperandType{REG, REG, REG}},
-
-	ADDI:  {IType, []OperandType{REG, REG, IMM | LAB}},
-	WORI:  {IType, []OperandType{REG, REG, IMM | LAB}},
-	ORI:   {IType, []OperandType{REG, REG, IMM | LAB}},
-	ANDI:  {IType, []OperandType{REG, REG, IMM | LAB}},
-	SLLI:  {IType, []OperandType{REG, REG, IMM}}, // なぜかこの3つの命令はラベルをとれない
-	SRLI:  {IType, []OperandType{REG, REG, IMM}},
-	SRAI:  {IType, []OperandType{REG, REG, IMM}},
-	SLTI:  {IType, []OperandType{REG, REG, IMM | LAB}},
-	SLTIU: {IType, []OperandType{REG, REG, IMM | LAB}},
-	LB:    {IType, []OperandType{REG, IMM | LAB, REG}},
-	LH:    {IType, []OperandType{REG, IMM | LAB, REG}},
-	LW:    {IType, []OperandType{REG, IMM | LAB, REG}},
-	LBU:   {IType, []OperandType{REG, IMM | LAB, REG}},
-	LHU:   {IType, []OperandType{REG, IMM | LAB, REG}},
-	JALR:  {IType, []OperandType{REG, REG, IMM | LAB}},
-	//JALR:   {IType, []OperandType{REG, IMM | LAB, REG}},
-	ECALL:  {IType, []OperandType{}},
-	EBREAK: {IType, []OperandType{}},
-
-	SB: {SType, []OperandType{REG, IMM | LAB, REG}},
-	SH: {SType, []OperandType{REG, IMM | LAB, REG}},
-	SW: {SType, []OperandType{REG, IMM | LAB, REG}},
-
-	BEQ:  {BType, []OperandType{REG, REG, IMM | LAB}},
-	BNE:  {BType, []OperandType{REG, REG, IMM | LAB}},
-	BLT:  {BType, []OperandType{REG, REG, IMM | LAB}},
-	BGE:  {BType, []OperandType{REG, REG, IMM | LAB}},
-	BLTU: {BType, []OperandType{REG, REG, IMM | LAB}},
-	BGEU: {BType, []OperandType{REG, REG, IMM | LAB}},
-
-	LUI:   {UType, []OperandType{REG, IMM | LAB}},
-	AUIPC: {UType, []OperandType{REG, IMM | LAB}},
-
-	JAL: {JType, []OperandType{REG, IMM | LAB}},
+// 命令名とオペランドの種類の対応
+// 命令は RegisterExtension で登録する
+var OpecodeMap = map[string]OpecodeInfo{}
+
+// 基本命令セット (RV32I)
+var rv32iInstructions = map[string]InstructionSpec{
+	ADD:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0000000}},
+	SUB:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b000, Funct7: 0b0100000}},
+	XOR:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b100, Funct7: 0b0000000}},
+	OR:   {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b110, Funct7: 0b0000000}},
+	AND:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b111, Funct7: 0b0000000}},
+	SLL:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b001, Funct7: 0b0000000}},
+	SRL:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b101, Funct7: 0b0000000}},
+	SRA:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b101, Funct7: 0b0100000}},
+	SLT:  {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b010, Funct7: 0b0000000}},
+	SLTU: {Format: RType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: 0b0110011, Funct3: 0b011, Funct7: 0b0000000}},
+
+	ADDI:   {Format: IType, Syntax: "rd, rs1, imm", Fields: Fields{Opcode: 0b0010011, Funct3: 0b000}},
+	WORI:   {Format: IType, Syntax: "rd, rs1, imm", Fields: Fields{Opcode: 0b0010011, Funct3: 0b100}},
+	ORI:    {Format: IType, Syntax: "rd, rs1, imm", Fields: Fields{Opcode: 0b0010011, Funct3: 0b110}},
+	ANDI:   {Format: IType, Syntax: "rd, rs1, imm", Fields: Fields{Opcode: 0b0010011, Funct3: 0b111}},
+	SLLI:   {Format: IType, Syntax: "rd, rs1, shamt", Fields: Fields{Opcode: 0b0010011, Funct3: 0b001}}, // シフト量(shamt)はラベルをとれない
+	SRLI:   {Format: IType, Syntax: "rd, rs1, shamt", Fields: Fields{Opcode: 0b0010011, Funct3: 0b101}},
+	SRAI:   {Format: IType, Syntax: "rd, rs1, shamt", Fields: Fields{Opcode: 0b0010011, Funct3: 0b101, Funct7: 0b0100000}},
+	SLTI:   {Format: IType, Syntax: "rd, rs1, imm", Fields: Fields{Opcode: 0b0010011, Funct3: 0b010}},
+	SLTIU:  {Format: IType, Syntax: "rd, rs1, imm", Fields: Fields{Opcode: 0b0010011, Funct3: 0b011}},
+	LB:     {Format: IType, Syntax: "rd, imm(rs1)", Fields: Fields{Opcode: 0b0000011, Funct3: 0b000}},
+	LH:     {Format: IType, Syntax: "rd, imm(rs1)", Fields: Fields{Opcode: 0b0000011, Funct3: 0b001}},
+	LW:     {Format: IType, Syntax: "rd, imm(rs1)", Fields: Fields{Opcode: 0b0000011, Funct3: 0b010}},
+	LBU:    {Format: IType, Syntax: "rd, imm(rs1)", Fields: Fields{Opcode: 0b0000011, Funct3: 0b100}},
+	LHU:    {Format: IType, Syntax: "rd, imm(rs1)", Fields: Fields{Opcode: 0b0000011, Funct3: 0b101}},
+	JALR:   {Format: IType, Syntax: "rd, rs1, imm", Fields: Fields{Opcode: 0b1100111, Funct3: 0b000}},
+	ECALL:  {Format: IType, Syntax: "", Fields: Fields{Opcode: 0b1110011}},
+	EBREAK: {Format: IType, Syntax: "", Fields: Fields{Opcode: 0b1110011, Rs2: 0b00001}}, // imm=1
+
+	SB: {Format: SType, Syntax: "rs2, imm(rs1)", Fields: Fields{Opcode: 0b0100011, Funct3: 0b000}},
+	SH: {Format: SType, Syntax: "rs2, imm(rs1)", Fields: Fields{Opcode: 0b0100011, Funct3: 0b001}},
+	SW: {Format: SType, Syntax: "rs2, imm(rs1)", Fields: Fields{Opcode: 0b0100011, Funct3: 0b010}},
+
+	BEQ:  {Format: BType, Syntax: "rs1, rs2, imm", Fields: Fields{Opcode: 0b1100011, Funct3: 0b000}},
+	BNE:  {Format: BType, Syntax: "rs1, rs2, imm", Fields: Fields{Opcode: 0b1100011, Funct3: 0b001}},
+	BLT:  {Format: BType, Syntax: "rs1, rs2, imm", Fields: Fields{Opcode: 0b1100011, Funct3: 0b100}},
+	BGE:  {Format: BType, Syntax: "rs1, rs2, imm", Fields: Fields{Opcode: 0b1100011, Funct3: 0b101}},
+	BLTU: {Format: BType, Syntax: "rs1, rs2, imm", Fields: Fields{Opcode: 0b1100011, Funct3: 0b110}},
+	BGEU: {Format: BType, Syntax: "rs1, rs2, imm", Fields: Fields{Opcode: 0b1100011, Funct3: 0b111}},
+
+	LUI:   {Format: UType, Syntax: "rd, imm", Fields: Fields{Opcode: 0b0110111}},
+	AUIPC: {Format: UType, Syntax: "rd, imm", Fields: Fields{Opcode: 0b0010111}},
+
+	JAL: {Format: JType, Syntax: "rd, imm", Fields: Fields{Opcode: 0b1101111}},
+
+	FENCE:    {Format: FenceType, Syntax: "[pred, succ]", Fields: Fields{Opcode: 0b0001111, Funct3: 0b000}},
+	FENCETSO: {Format: FenceType, Syntax: "", Fields: Fields{Opcode: 0b0001111, Funct3: 0b000, Rs2: 0b10011, Funct7: 0b1000001}}, // fm=TSO, pred=rw, succ=rw
+}
+
+var zifenceiInstructions = map[string]InstructionSpec{
+	FENCEI: {Format: FenceType, Syntax: "", Fields: Fields{Opcode: 0b0001111, Funct3: 0b001}},
+}
+
+var zihintpauseInstructions = map[string]InstructionSpec{
+	PAUSE: {Format: FenceType, Syntax: "", Fields: Fields{Opcode: 0b0001111, Funct3: 0b000, Rs2: 0b10000}}, // fence w, 0
 }
 
+func init() {
+	MustRegisterExtension(Extension{Name: baseExtension, Instructions: rv32iInstructions})
+	MustRegisterExtension(Extension{Name: "zifencei", Instructions: zifenceiInstructions})
+	MustRegisterExtension(Extension{Name: "zihintpause", Instructions: zihintpauseInstructions})
+}
+
+// 拡張命令の命令名と、その命令を使うのに必要な拡張の対応
+// 複数の拡張に含まれる命令は、どれか1つが有効なら使える
+// 基本命令セットの命令は含まない
+var requiredExtension = map[string][]string{}
+
 type Operation struct {
 	opcode   string
+	mnemonic string // ソースに書かれた命令名。疑似命令を置き換えても変わらない
 	info     OpecodeInfo
 	operands []string
 	relFunc  string
+	insn     *InsnFields // .insnで指定されたフィールド
 	src      []rune
 	idx      int
+	oprStart int // 最後に読んだオペランドのsrcでの位置。エラーの列に使う
 }
 
 func (o *Operation) Opecode() string        { return o.opcode }
@@ -183,6 +258,17 @@ func (o *Operation) RelFunc() string        { return o.relFunc }
 func (o *Operation) OpcType() OpecodeType   { return o.info.opcTyp }
 func (o *Operation) OprType() []OperandType { return o.info.oprTyps }
 
+// 命令のバイト数。RVC命令は2byte、それ以外は4byte
+func (o *Operation) Size() int {
+	if o.info.opcTyp == RawType {
+		return o.insn.Len
+	}
+	if isCompressedFormat(o.info.opcTyp) {
+		return 2
+	}
+	return 4
+}
+
 // 命令文中にシンボルが出現していればそれを返す関数
 func (o *Operation) RetIfSymbol() string {
 	for i, typ := range o.info.oprTyps {
@@ -222,6 +308,7 @@ func (o *Operation) nextOperand() (string, OperandType) {
 	isLiteral := false
 	hasRelFunc := false
 	start := o.idx
+	o.oprStart = start
 	for ; o.idx < len(o.src); o.idx++ {
 		c := o.src[o.idx]
 		if c == '"' && !isLiteral {
@@ -251,14 +338,15 @@ func (o *Operation) nextOperand() (string, OperandType) {
 }
 
 func isRegister(val string) bool {
-	return RegisterSet[val]
+	_, exists := RegisterSet[val]
+	return exists
 }
 
 func IsImmediate(value string) bool {
-	// 正の整数リテラル（例: 42）
-	integerPattern := `^\d+$`
-	// 16進数リテラル（例: 0x2A）
-	hexPattern := `^0x[0-9A-Fa-f]+$`
+	// 整数リテラル（例: 42, -16）
+	integerPattern := `^-?\d+$`
+	// 16進数リテラル（例: 0x2A, -0x10）
+	hexPattern := `^-?0x[0-9A-Fa-f]+$`
 
 	// 数値の形式に合致するかを確認
 	if matched, _ := regexp.MatchString(integerPattern, value); matched {
@@ -270,16 +358,53 @@ func IsImmediate(value string) bool {
 	// 16進数リテラルとしての形式に合致するかを確認
 	if matched, _ := regexp.MatchString(hexPattern, value); matched {
 		// 16進数として変換できるか確認
-		_, err := strconv.ParseInt(value[2:], 16, 64) // "0x" を除去して変換
+		_, err := strconv.ParseInt(strings.Replace(value, "0x", "", 1), 16, 64) // "0x" を除去して変換
 		return err == nil
 	}
 
 	return false
 }
 
+// fenceのpredecessor/successorに指定できる"iorw"の部分集合かどうか
+// 文字はi, o, r, wの順に並んでいなければならない
+func isFenceSet(val string) bool {
+	if len(val) == 0 {
+		return false
+	}
+	order := "iorw"
+	for _, c := range val {
+		i := strings.IndexRune(order, c)
+		if i < 0 {
+			return false
+		}
+		order = order[i+1:]
+	}
+	return true
+}
+
+// 即値の文字列を数値に変換する。IsImmediateで検証済みであることが前提
+func ImmValue(value string) int64 {
+	n, _ := strconv.ParseInt(value, 0, 64)
+	return n
+}
+
 func analyzeOperandType(operand string) OperandType {
-	if isRegister(operand) {
+	if isCompressedReg(operand) {
+		return REG | CREG
+	} else if isRegister(operand) {
 		return REG
+	} else if isVectorRegister(operand) {
+		return VREG
+	} else if operand == VectorMask {
+		return VMASK
+	} else if isVtypeField(operand) {
+		// vtypeの要素と同じ名前のラベルも使えるようにする
+		return VTYPE | LAB
+	} else if isFenceSet(operand) {
+		return FENCESET | LAB
+	} else if isCSR(operand) {
+		// CSR名と同じ名前のラベルも使えるようにする
+		return CSR | LAB
 	} else if IsImmediate(operand) {
 		return IMM
 	} else {
@@ -287,27 +412,32 @@ func analyzeOperandType(operand string) OperandType {
 	}
 }
 
-// この関数に来る時点でラベルをオペランドにとることは確定している
-func isValidRelFunc(opecode, relFunc string) bool {
-	typ := OpecodeMap[opecode].opcTyp
-
-	switch typ {
-	case IType, SType:
-		if relFunc == "%lo" || relFunc == "%pcrel_lo" {
-			return true
-		}
-		break
+// リロケーションファンクションと、それを使える命令形式
+var relocFuncFormats = map[string][]OpecodeType{
+	"%hi":              {UType},
+	"%lo":              {IType, SType},
+	"%pcrel_hi":        {UType},
+	"%pcrel_lo":        {IType, SType},
+	"%got_pcrel_hi":    {UType},
+	"%tprel_hi":        {UType},
+	"%tprel_lo":        {IType, SType},
+	"%tprel_add":       {RType},
+	"%tls_ie_pcrel_hi": {UType},
+	"%tls_gd_pcrel_hi": {UType},
+}
 
-	case UType:
-		if relFunc == "%hi" || relFunc == "%pcrel_hi" {
-			return true
+// この関数に来る時点でラベルをオペランドにとることは確定している
+func checkRelFunc(typ OpecodeType, relFunc string) error {
+	formats, exists := relocFuncFormats[relFunc]
+	if !exists {
+		return fmt.Errorf("unknown relocation function `%s'", relFunc)
+	}
+	for _, format := range formats {
+		if format == typ {
+			return nil
 		}
-		break
-
-	default:
-		break
 	}
-	return false
+	return fmt.Errorf("relocation function `%s' cannot be used with this instruction", relFunc)
 }
 
 /*
@@ -320,22 +450,33 @@ func (o *Operation) handleByOpType() error {
 	for !o.isEOF() && oprTypIdx < len(o.info.oprTyps) {
 		val, typ := o.nextOperand()
 		if o.info.oprTyps[oprTypIdx]&typ == 0 {
+			if o.info.oprTyps[oprTypIdx]&CSR != 0 && typ == LAB {
+				return fmt.Errorf("unknown CSR `%s'", val)
+			}
 			return errors.New("illegal operand.")
 		}
 		// リロケーションファンクションの場合
 		if typ == LAB && val[0] == '%' {
-			if isValidRelFunc(o.Opecode(), val) {
-				o.relFunc = val
-				o.skipUntilNextOperand()
-				continue
+			if err := checkRelFunc(o.info.opcTyp, val); err != nil {
+				return err
 			}
-			return errors.New("illegal operand.")
+			o.relFunc = val
+			o.skipUntilNextOperand()
+			continue
 		}
-		o.operands = append(o.operands, val)
 		o.skipUntilNextOperand()
+		// "e32, m4, ta, ma" は1つのオペランドとしてまとめる
+		if o.info.oprTyps[oprTypIdx]&VTYPE != 0 && typ&VTYPE != 0 {
+			val = o.joinVtype(val)
+		}
+		o.operands = append(o.operands, val)
 		oprTypIdx++
 	}
 
+	// 省略可能なオペランドが省略されていれば、その分は足りなくてよい
+	for oprTypIdx < len(o.info.oprTyps) && o.info.oprTyps[oprTypIdx]&OPT != 0 {
+		oprTypIdx++
+	}
 	if oprTypIdx != len(o.info.oprTyps) {
 		return errors.New("illegal operand.")
 	} else if !o.isEOF() {
@@ -344,18 +485,118 @@ func (o *Operation) handleByOpType() error {
 	return nil
 }
 
-func (s *Stmt) parseOperation(val string) error {
+// オペランドの種類だけでは判断できない、値の制約を見る
+func (o *Operation) validateOperands() error {
+	spec, exists := instructionSpecs[o.opcode]
+	// シンボルを直接指定したロード、ストアは命令の書式と違うので見ない
+	if !exists || o.info.opcTyp == PseudoType && spec.Format != PseudoType {
+		return nil
+	}
+	return spec.validate(o.operands)
+}
+
+// シンボルを値valに置き換えたオペランドが命令の制約を満たしているか
+// .equの値を命令に畳み込むときに、パース時には分からなかった範囲を確かめる
+func (o Operation) ValidateSymbolValue(symbol string, val int64) error {
+	o.operands = append([]string(nil), o.operands...)
+	for i, opr := range o.operands {
+		if opr == symbol {
+			o.operands[i] = strconv.FormatInt(val, 10)
+		}
+	}
+	return o.validateOperands()
+}
+
+// %tprel_addを付けたaddの書式。4つめのオペランドは再配置のためだけに使う
+var tprelAddOpecodeInfo = OpecodeInfo{RType, []OperandType{REG, REG, REG, LAB}}
+
+// %tprel_addはスレッドポインタとの加算にしか使えない
+func (o *Operation) checkTprelAdd() error {
+	if o.relFunc != "%tprel_add" {
+		return errors.New("illegal operand.")
+	}
+	if RegisterSet[o.operands[2]] != RegisterSet["tp"] {
+		return errors.New("the third operand of `%tprel_add' must be tp")
+	}
+	return nil
+}
+
+// Aliasを指定した疑似命令を展開先の命令に置き換える
+// 省略された省略可能なオペランドは展開先でも省略する
+func (o *Operation) expandPseudo() {
+	spec, exists := instructionSpecs[o.opcode]
+	if !exists || spec.Alias == "" {
+		return
+	}
+	values := map[string]string{}
+	for i, opr := range syntaxOperands(spec.Syntax) {
+		if i < len(o.operands) {
+			values[opr.name] = o.operands[i]
+		} else {
+			values[opr.name] = ""
+		}
+	}
+
+	target, args, _ := strings.Cut(spec.Alias, " ")
+	var operands []string
+	for _, arg := range syntaxOperands(args) {
+		val, isOperand := values[arg.name]
+		if !isOperand {
+			val = arg.name
+		}
+		if val != "" {
+			operands = append(operands, val)
+		}
+	}
+	o.replace(target, operands...)
+}
+
+func (o *Operation) replace(opcode string, operands ...string) {
+	o.opcode = opcode
+	o.info = OpecodeMap[opcode]
+	o.operands = operands
+}
+
+func (s *Stmt) parseOperation(val string, opts *Options) error {
 	op := Operation{
-		opcode: val,
-		info:   OpecodeMap[val],
-		src:    s.src[s.idx:],
-		idx:    0,
+		opcode:   val,
+		mnemonic: val,
+		info:     OpecodeMap[val],
+		src:      s.src[s.idx:],
+		idx:      0,
+	}
+	if opts != nil {
+		if err := op.checkExtension(*opts); err != nil {
+			return err
+		}
 	}
 
 	err := op.handleByOpType()
+	s.errIdx = s.idx + op.oprStart
+	if info, exists := symbolAccessOpecodeMap[val]; exists && (err != nil || op.relFunc == "" && op.RetIfSymbol() != "") {
+		// lw rd, sym のようにシンボルを直接指定したロード、ストアとして読み直す
+		// sw rs, sym, rt は sw rs, sym(rt) と区別できないので、%loなしのシンボルはこちらで読む
+		sym := Operation{opcode: val, mnemonic: val, info: info, src: op.src}
+		if sym.handleByOpType() == nil && sym.relFunc == "" {
+			op, err = sym, nil
+		}
+	}
+	if err != nil && val == ADD {
+		// add rd, rs, tp, %tprel_add(sym)
+		tprel := Operation{opcode: val, mnemonic: val, info: tprelAddOpecodeInfo, src: op.src}
+		if tprel.handleByOpType() == nil {
+			op, err = tprel, tprel.checkTprelAdd()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.errIdx = s.idx + op.oprStart
+	err = op.validateOperands()
 	if err != nil {
 		return err
 	}
+	op.expandPseudo()
 
 	s.op = &op
 	return nil
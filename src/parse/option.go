@@ -0,0 +1,169 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ayase-mstk/go32as/src/isa"
+)
+
+// .optionで切り替えられるアセンブラの設定
+// 各Stmtはその行の時点で有効な設定を保持する
+type Options struct {
+	rvc   bool    // RVC命令の使用と自動圧縮
+	relax bool    // リンカによる緩和を許すか。R_RISCV_RELAXを出力する
+	pic   bool    // 位置独立なコードを生成するか
+	arch  isa.ISA // 命令セット。-marchの指定を.option archで変更できる
+
+	maxErrors int // 集めるエラーの数の上限。0なら制限しない
+}
+
+// -marchで指定された命令セットから初期の設定を作る
+func NewOptions(arch isa.ISA) Options {
+	return Options{
+		rvc:   arch.Has("c"),
+		relax: true,
+		arch:  arch,
+	}
+}
+
+func (o Options) RVC() bool     { return o.rvc }
+func (o Options) Relax() bool   { return o.relax }
+func (o Options) PIC() bool     { return o.pic }
+func (o Options) Arch() isa.ISA { return o.arch }
+
+// -mrelax, -mno-relax で緩和の初期値を変える
+func (o *Options) SetRelax(relax bool) { o.relax = relax }
+
+// -fpic, -fno-pic で位置独立なコードを生成するかの初期値を変える
+func (o *Options) SetPIC(pic bool) { o.pic = pic }
+
+// エラーをmax個見つけたら、残りの行は読まない。0なら最後まで読む
+func (o *Options) SetMaxErrors(max int) { o.maxErrors = max }
+
+// 拡張が有効かどうか。C拡張は.option rvc/norvcでも切り替わる
+func (o Options) has(ext string) bool {
+	if ext == "c" {
+		return o.rvc
+	}
+	return o.arch.Has(ext)
+}
+
+// .option push/popで退避された設定
+type optionStack []Options
+
+func (s *optionStack) push(o Options) {
+	*s = append(*s, o)
+}
+
+func (s *optionStack) pop() (Options, error) {
+	if len(*s) == 0 {
+		return Options{}, errors.New(".option pop with no .option push")
+	}
+	o := (*s)[len(*s)-1]
+	*s = (*s)[:len(*s)-1]
+	return o, nil
+}
+
+// .option の引数を設定に反映する
+func (o *Options) apply(args []string, stack *optionStack) error {
+	if args[0] != "arch" && len(args) != 1 {
+		return fmt.Errorf(ErrMsg, ',')
+	}
+	switch args[0] {
+	case "rvc":
+		o.rvc = true
+	case "norvc":
+		o.rvc = false
+	case "relax":
+		o.relax = true
+	case "norelax":
+		o.relax = false
+	case "pic":
+		o.pic = true
+	case "nopic":
+		o.pic = false
+	case "push":
+		stack.push(*o)
+	case "pop":
+		saved, err := stack.pop()
+		if err != nil {
+			return err
+		}
+		*o = saved
+	case "arch":
+		return o.applyArch(args[1:])
+	default:
+		return fmt.Errorf("unrecognized .option directive: %s", args[0])
+	}
+	return nil
+}
+
+/*
+.option arch の引数を反映する
+"rv32imac" のように命令セット全体を指定するか、"+zba", "-c" のように拡張を足し引きする
+*/
+func (o *Options) applyArch(args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing argument.")
+	}
+	if strings.HasPrefix(args[0], "rv") {
+		if len(args) != 1 {
+			return fmt.Errorf(ErrMsg, ',')
+		}
+		arch, err := isa.Parse(args[0])
+		if err != nil {
+			return err
+		}
+		o.arch = arch
+		o.rvc = arch.Has("c")
+		return nil
+	}
+
+	for _, arg := range args {
+		ext := arg[1:]
+		if !isa.IsExtension(ext) || ext == "i" || ext == "e" {
+			return fmt.Errorf("unknown ISA extension `%s' in .option arch", ext)
+		}
+		switch arg[0] {
+		case '+':
+			o.arch = o.arch.With(ext)
+		case '-':
+			o.arch = o.arch.Without(ext)
+		default:
+			return fmt.Errorf("invalid ISA extension `%s' in .option arch", arg)
+		}
+		if ext == "c" {
+			o.rvc = arg[0] == '+'
+		}
+	}
+	return nil
+}
+
+// 有効になっていない拡張の命令が使われていないか見る
+func (o *Operation) checkExtension(opts Options) error {
+	exts, exists := requiredExtension[o.opcode]
+	if !exists {
+		return nil
+	}
+	for _, ext := range exts {
+		if opts.has(ext) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognized opcode `%s', extension `%s' required", o.mnemonic, strings.Join(exts, "' or `"))
+}
+
+// RV32Eではx16-x31のレジスタを使えない
+func (o *Operation) checkRegisters(opts Options) error {
+	if !opts.arch.Has("e") {
+		return nil
+	}
+	for _, operand := range o.operands {
+		if num, exists := RegisterSet[operand]; exists && num > 15 {
+			return fmt.Errorf("register `%s' is not available in RV32E", operand)
+		}
+	}
+	return nil
+}
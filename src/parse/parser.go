@@ -4,7 +4,10 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+
+	"github.com/ayase-mstk/go32as/src/diag"
 )
 
 const ErrMsg string = "junk at end of line, first unrecognized character is `%c'"
@@ -54,9 +57,14 @@ type Stmt struct {
 	dir         *Directive
 	section     string
 	labelSymbol string
+	opts        Options
 	row         int
+	file        string // 文を読んだソースの名前
 	src         []rune
 	idx         int
+	labelIdx    int // ラベルのsrcでの位置
+	nameIdx     int // 命令やディレクティブの名前のsrcでの位置
+	errIdx      int // パースエラーを見つけたsrcでの位置
 }
 
 func (s *Stmt) Type() StmtType  { return s.typ }
@@ -65,6 +73,19 @@ func (s *Stmt) Dir() *Directive { return s.dir }
 func (s *Stmt) Section() string { return s.section }
 func (s *Stmt) LSymbol() string { return s.labelSymbol }
 func (s *Stmt) Row() int        { return s.row }
+func (s *Stmt) File() string    { return s.file }
+func (s *Stmt) Opts() Options   { return s.opts }
+
+// 命令やディレクティブの名前の列 (1始まり)。なければラベルの列
+func (s *Stmt) Column() int {
+	if s.op == nil && s.dir == nil {
+		return s.labelIdx + 1
+	}
+	return s.nameIdx + 1
+}
+
+// ラベルの列 (1始まり)
+func (s *Stmt) LabelColumn() int { return s.labelIdx + 1 }
 
 func (s *Stmt) setType() {
 	if s.Op() != nil {
@@ -125,7 +146,38 @@ func changeSection(curSection *string, s Stmt) {
 	}
 }
 
+// .optionによる設定の変更を反映し、その時点の設定をStmtに記録する
+func applyOptions(opts *Options, stack *optionStack, s *Stmt) error {
+	if s.Dir() != nil && s.Dir().Name() == Option {
+		if err := opts.apply(s.Dir().Args(), stack); err != nil {
+			return err
+		}
+	}
+	s.opts = *opts
+
+	if s.Op() != nil {
+		if err := s.op.checkExtension(*opts); err != nil {
+			return err
+		}
+		if err := s.op.checkRegisters(*opts); err != nil {
+			return err
+		}
+		if opts.rvc {
+			s.op.compress()
+		}
+	}
+	return nil
+}
+
 func ParseLine(input []rune, row int) (Stmt, error) {
+	return parseLine(input, row, nil)
+}
+
+/*
+1行をパースする。optsにその行を読む時点の設定を渡すと、
+gasと同じくオペランドを検証する前に命令の拡張が有効か見る
+*/
+func parseLine(input []rune, row int, opts *Options) (Stmt, error) {
 	stmt := Stmt{
 		op:  nil,
 		dir: nil,
@@ -138,6 +190,7 @@ func ParseLine(input []rune, row int) (Stmt, error) {
 	if stmt.isEOF() {
 		return stmt, nil
 	}
+	stmt.labelIdx, stmt.nameIdx, stmt.errIdx = stmt.idx, stmt.idx, stmt.idx
 	tk := stmt.getToken()
 
 	if tk.Type() == TLabel {
@@ -151,6 +204,7 @@ func ParseLine(input []rune, row int) (Stmt, error) {
 			stmt.setType()
 			return stmt, nil
 		}
+		stmt.nameIdx, stmt.errIdx = stmt.idx, stmt.idx
 		tk = stmt.getToken()
 	}
 	stmt.skipUntilNextToken()
@@ -158,13 +212,19 @@ func ParseLine(input []rune, row int) (Stmt, error) {
 	// Stmtタイプで処理を分ける
 	switch tk.Type() {
 	case TDirective:
+		// .insnは命令として扱う
+		if tk.Val() == Insn {
+			err := stmt.parseInsn()
+			stmt.setType()
+			return stmt, err
+		}
 		// それぞれのパーサーを呼ぶ
 		err := stmt.parseDirective(tk.Val())
 		stmt.setType()
 		return stmt, err
 	case TOpecode:
 		// それぞれのパーサーを呼ぶ
-		err := stmt.parseOperation(tk.Val())
+		err := stmt.parseOperation(tk.Val(), opts)
 		stmt.setType()
 		return stmt, err
 	default:
@@ -176,10 +236,7 @@ func ParseLine(input []rune, row int) (Stmt, error) {
 	}
 }
 
-func ParseFile(filename string) ([]Stmt, error) {
-	var stmts []Stmt
-	var currentSection string = ".text" // default section
-
+func ParseFile(filename string, opts Options) ([]Stmt, error) {
 	// ファイルをオープンします。
 	file, err := os.Open(filename)
 	if err != nil {
@@ -187,27 +244,118 @@ func ParseFile(filename string) ([]Stmt, error) {
 	}
 	defer file.Close() // 関数が終了する際にファイルをクローズします。
 
-	// バッファードリーダーを作成します。
-	scanner := bufio.NewScanner(file)
-	row := 1
+	return Parse(file, filename, opts)
+}
+
+// rからソースを読んでパースする。filenameはエラーメッセージに使う
+func Parse(r io.Reader, filename string, opts Options) ([]Stmt, error) {
+	return ParseSources([]Source{{Name: filename, Reader: r}}, opts)
+}
+
+// パースするソースと、エラーメッセージに使うその名前
+type Source struct {
+	Name   string
+	Reader io.Reader
+}
 
-	// ファイルの各行を読み込みます。
-	for scanner.Scan() {
-		line := scanner.Text() // 現在の行を取得します。
-		newStmt, err := ParseLine([]rune(line), row)
-		if err != nil {
-			return nil, fmt.Errorf("%s:%d: Error: %s\n", filename, row, err.Error())
+/*
+複数のソースを順につなげて1つのアセンブル単位としてパースする
+gasと同じく、セクションや.optionの状態は次のソースに引き継ぐ
+誤りのある行は飛ばして最後まで読み、見つけたエラーを全てdiag.Listで返す
+エラーがあっても、正しく読めた文は返すので続けてアセンブルできる
+Options.SetMaxErrorsの数だけエラーを見つけたら、そこで読むのをやめる
+*/
+func ParseSources(srcs []Source, opts Options) ([]Stmt, error) {
+	var stmts []Stmt
+	var diags diag.List
+	var currentSection string = ".text" // default section
+	var stack optionStack               // .option push/pop
+
+	for _, src := range srcs {
+		// バッファードリーダーを作成します。
+		scanner := bufio.NewScanner(src.Reader)
+		row := 1
+
+		// ファイルの各行を読み込みます。
+		for ; !diags.Reached(opts.maxErrors) && scanner.Scan(); row++ {
+			line := scanner.Text() // 現在の行を取得します。
+			newStmt, err := parseLine([]rune(line), row, &opts)
+			newStmt.file = src.Name
+			if err != nil {
+				diags = append(diags, newStmt.diagnostic(newStmt.errIdx+1, err))
+				continue
+			}
+			changeSection(&currentSection, newStmt)
+			newStmt.section = currentSection
+			err = applyOptions(&opts, &stack, &newStmt)
+			if err != nil {
+				diags = append(diags, newStmt.diagnostic(newStmt.Column(), err))
+				continue
+			}
+			stmts = append(stmts, newStmt)
 		}
-		changeSection(&currentSection, newStmt)
-		newStmt.section = currentSection
-		stmts = append(stmts, newStmt) // 行を処理します。
-		row++
-	}
 
-	// 読み込み中にエラーが発生した場合はエラーを返します。
-	if err := scanner.Err(); err != nil {
-		return nil, err
+		// 読み込み中にエラーが発生した場合はエラーを返します。
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
 	}
 
+	// call, tail などの疑似命令は命令列に展開する
+	// -fpicのlaはシンボルがファイル内で閉じているかで展開が変わるので、全行を読んでから展開する
+	stmts = expandPseudos(stmts)
+
+	if !diags.Reached(opts.maxErrors) {
+		diags = append(diags, checkPcrelLo(stmts)...)
+	}
+	if len(diags) != 0 {
+		return stmts, diags
+	}
 	return stmts, nil
 }
+
+// 文のcolumn列目で見つかったエラー
+func (s *Stmt) diagnostic(column int, err error) diag.Diagnostic {
+	return diag.Diagnostic{File: s.file, Line: s.row, Column: column, Severity: diag.Error, Message: err.Error()}
+}
+
+// auipc に付けて %pcrel_lo から参照できるリロケーションファンクション
+var pcrelHiFuncs = map[string]bool{
+	"%pcrel_hi":        true,
+	"%got_pcrel_hi":    true,
+	"%tls_ie_pcrel_hi": true,
+	"%tls_gd_pcrel_hi": true,
+}
+
+/*
+%pcrel_lo のオペランドは、対応する auipc に付けたラベルでなければならない
+ラベルの直後の命令が %pcrel_hi を使った auipc か見る
+*/
+func checkPcrelLo(stmts []Stmt) diag.List {
+	pcrelHi := map[string]bool{}
+	var labels []string // まだ後ろに命令が来ていないラベル
+	for _, s := range stmts {
+		if s.labelSymbol != "" {
+			labels = append(labels, s.labelSymbol)
+		}
+		if s.op == nil && (s.dir == nil || s.dir.name == Option) {
+			continue
+		}
+		isHi := s.op != nil && s.op.opcode == AUIPC && pcrelHiFuncs[s.op.relFunc]
+		for _, label := range labels {
+			pcrelHi[label] = isHi
+		}
+		labels = nil
+	}
+
+	var diags diag.List
+	for _, s := range stmts {
+		if s.op == nil || s.op.relFunc != "%pcrel_lo" {
+			continue
+		}
+		if label := s.op.RetIfSymbol(); !pcrelHi[label] {
+			diags = append(diags, s.diagnostic(s.Column(), fmt.Errorf("could not find corresponding %%pcrel_hi for `%s'", label)))
+		}
+	}
+	return diags
+}
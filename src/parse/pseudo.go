@@ -0,0 +1,195 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 複数の命令に展開される疑似命令
+const (
+	CALL = "call"
+	TAIL = "tail"
+	LA   = "la"
+	LLA  = "lla"
+
+	LATLSIE = "la.tls.ie" // TLSのinitial-execモデルで変数のオフセットをGOTから読む
+	LATLSGD = "la.tls.gd" // TLSのglobal-dynamicモデルで__tls_get_addrに渡す引数を求める
+)
+
+// call, tail で展開した auipc に付けるリロケーションファンクション
+// R_RISCV_CALL_PLT を表す。ソースには書けない
+const CallRelFunc = "%call_plt"
+
+var pseudoInstructions = map[string]InstructionSpec{
+	CALL: {Format: PseudoType, Syntax: "symbol"},
+	TAIL: {Format: PseudoType, Syntax: "symbol"},
+	LA:   {Format: PseudoType, Syntax: "rd, symbol"},
+	LLA:  {Format: PseudoType, Syntax: "rd, symbol"},
+
+	LATLSIE: {Format: PseudoType, Syntax: "rd, symbol"},
+	LATLSGD: {Format: PseudoType, Syntax: "rd, symbol"},
+}
+
+// シンボルのアドレスを直接指定したロード、ストア (lw rd, sym / sw rs, sym, rt)
+// 通常の書式で読めなかったときにこちらで読み直す
+var symbolAccessOpecodeMap = map[string]OpecodeInfo{
+	LB:  {PseudoType, []OperandType{REG, LAB}},
+	LH:  {PseudoType, []OperandType{REG, LAB}},
+	LW:  {PseudoType, []OperandType{REG, LAB}},
+	LBU: {PseudoType, []OperandType{REG, LAB}},
+	LHU: {PseudoType, []OperandType{REG, LAB}},
+	SB:  {PseudoType, []OperandType{REG, LAB, REG}},
+	SH:  {PseudoType, []OperandType{REG, LAB, REG}},
+	SW:  {PseudoType, []OperandType{REG, LAB, REG}},
+}
+
+func init() {
+	MustRegisterExtension(Extension{Name: baseExtension, Instructions: pseudoInstructions})
+}
+
+// PC相対のアドレスを求める auipc に付ける合成ラベル
+// %pcrel_lo はこのラベルを通して auipc の %pcrel_hi を参照する
+const pcrelLabelPrefix = ".Lpcrel_hi"
+
+// ファイル全体の疑似命令を展開する
+func expandPseudos(stmts []Stmt) []Stmt {
+	var expanded []Stmt
+	var pcrelLabels int // 疑似命令の展開で作った合成ラベルの数
+	preemptible := preemptibleSymbols(stmts)
+	for _, s := range stmts {
+		expanded = append(expanded, s.expandSequence(&pcrelLabels, preemptible)...)
+	}
+	return expanded
+}
+
+/*
+リンク時に他のモジュールの定義で置き換えられうるシンボルかどうかを返す関数を作る
+ファイル内にラベルがあり、.globl, .commされていないシンボルだけが置き換えられない
+*/
+func preemptibleSymbols(stmts []Stmt) func(string) bool {
+	defined := map[string]bool{}
+	global := map[string]bool{}
+	for _, s := range stmts {
+		if s.labelSymbol != "" {
+			defined[s.labelSymbol] = true
+		}
+		if s.dir == nil || len(s.dir.args) == 0 {
+			continue
+		}
+		switch s.dir.name {
+		case Globl, Comm, Common:
+			global[s.dir.args[0]] = true
+		case Equ:
+			defined[s.dir.args[0]] = true
+		}
+	}
+	return func(sym string) bool {
+		return !defined[sym] || global[sym]
+	}
+}
+
+/*
+疑似命令を命令列に展開する
+展開した命令はRVCに圧縮しない。リンカが緩和で短くできるように、常に同じ長さの命令列にする
+ラベルは先頭の命令に付ける。pcrelLabelsは合成ラベルの通し番号
+*/
+func (s Stmt) expandSequence(pcrelLabels *int, preemptible func(string) bool) []Stmt {
+	if s.op == nil || s.op.info.opcTyp != PseudoType {
+		return []Stmt{s}
+	}
+
+	oprs := s.op.operands
+	var ops []Operation
+	var label string
+	// auipc に付ける合成ラベルを作る
+	newLabel := func() string {
+		label = fmt.Sprintf("%s%d", pcrelLabelPrefix, *pcrelLabels)
+		*pcrelLabels++
+		return label
+	}
+
+	switch s.op.opcode {
+	case CALL:
+		// "call __tls_get_addr@plt" の@pltは付けなくても同じ
+		ops = []Operation{
+			s.op.sequence(AUIPC, CallRelFunc, "ra", strings.TrimSuffix(oprs[0], "@plt")),
+			s.op.sequence(JALR, "", "ra", "ra", "0"),
+		}
+	case TAIL:
+		ops = []Operation{
+			s.op.sequence(AUIPC, CallRelFunc, "t1", strings.TrimSuffix(oprs[0], "@plt")),
+			s.op.sequence(JALR, "", "zero", "t1", "0"),
+		}
+	case LATLSIE:
+		ops = []Operation{
+			s.op.sequence(AUIPC, "%tls_ie_pcrel_hi", oprs[0], oprs[1]),
+			s.op.sequence(LW, "%pcrel_lo", oprs[0], newLabel(), oprs[0]),
+		}
+	case LATLSGD:
+		ops = []Operation{
+			s.op.sequence(AUIPC, "%tls_gd_pcrel_hi", oprs[0], oprs[1]),
+			s.op.sequence(ADDI, "%pcrel_lo", oprs[0], oprs[0], newLabel()),
+		}
+	case LA:
+		// 位置独立なコードでは、置き換えられうるシンボルのアドレスをGOTから読む
+		if s.opts.PIC() && preemptible(oprs[1]) {
+			ops = []Operation{
+				s.op.sequence(AUIPC, "%got_pcrel_hi", oprs[0], oprs[1]),
+				s.op.sequence(LW, "%pcrel_lo", oprs[0], newLabel(), oprs[0]),
+			}
+			break
+		}
+		ops = []Operation{
+			s.op.sequence(AUIPC, "%pcrel_hi", oprs[0], oprs[1]),
+			s.op.sequence(ADDI, "%pcrel_lo", oprs[0], oprs[0], newLabel()),
+		}
+	case LLA:
+		ops = []Operation{
+			s.op.sequence(AUIPC, "%pcrel_hi", oprs[0], oprs[1]),
+			s.op.sequence(ADDI, "%pcrel_lo", oprs[0], oprs[0], newLabel()),
+		}
+	case LB, LH, LW, LBU, LHU:
+		ops = []Operation{
+			s.op.sequence(AUIPC, "%pcrel_hi", oprs[0], oprs[1]),
+			s.op.sequence(s.op.opcode, "%pcrel_lo", oprs[0], newLabel(), oprs[0]),
+		}
+	case VMSLTVI, VMSLTUVI, VMSGEVI, VMSGEUVI, VMSGEVX, VMSGEUVX:
+		ops = s.op.expandVectorCompare()
+	case SB, SH, SW:
+		// アドレスの計算には3つめのオペランドのレジスタを使う
+		ops = []Operation{
+			s.op.sequence(AUIPC, "%pcrel_hi", oprs[2], oprs[1]),
+			s.op.sequence(s.op.opcode, "%pcrel_lo", oprs[0], newLabel(), oprs[2]),
+		}
+	}
+
+	var stmts []Stmt
+	if label != "" && s.labelSymbol != "" {
+		// 合成ラベルとソースのラベルを同じ位置に置く
+		stmts = append(stmts, Stmt{typ: UNKNOWN, section: s.section, labelSymbol: s.labelSymbol, opts: s.opts, row: s.row, src: s.src})
+	}
+	for i := range ops {
+		stmt := s
+		stmt.op = &ops[i]
+		stmt.labelSymbol = ""
+		if i == 0 && label != "" {
+			stmt.labelSymbol = label
+		} else if i == 0 {
+			stmt.labelSymbol = s.labelSymbol
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+// 展開した命令列の1命令を作る。mnemonicは元の疑似命令のまま
+func (o *Operation) sequence(opcode, relFunc string, operands ...string) Operation {
+	return Operation{
+		opcode:   opcode,
+		mnemonic: o.mnemonic,
+		info:     OpecodeMap[opcode],
+		operands: operands,
+		relFunc:  relFunc,
+		src:      o.src,
+	}
+}
@@ -0,0 +1,47 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+.reloc offset, type[, symbol+addend] の引数を確かめる
+offsetは数値か、"."やラベルに数値を足した式。typeの名前は出力側で解決する
+*/
+func (d *Directive) checkReloc() error {
+	if len(d.args) > 3 {
+		return fmt.Errorf(ErrMsg, ',')
+	}
+	if _, _, ok := SymbolAddend(d.args[0]); !ok {
+		return fmt.Errorf("bad .reloc offset `%s'", d.args[0])
+	}
+	if len(d.args) == 3 {
+		if _, _, ok := SymbolAddend(d.args[2]); !ok {
+			return fmt.Errorf("bad .reloc expression `%s'", d.args[2])
+		}
+	}
+	return nil
+}
+
+/*
+"sym", "sym+8", "sym-4", "16" の形の式をシンボルと加数に分ける
+数値だけならシンボルは空文字列
+*/
+func SymbolAddend(val string) (string, int64, bool) {
+	if IsImmediate(val) {
+		return "", ImmValue(val), true
+	}
+	i := strings.LastIndexAny(val, "+-")
+	if i <= 0 {
+		return val, 0, !strings.ContainsAny(val, "\"")
+	}
+	sym, addend := val[:i], val[i+1:]
+	if !IsImmediate(addend) || strings.ContainsAny(sym, "+-\"") {
+		return "", 0, false
+	}
+	if val[i] == '-' {
+		return sym, -ImmValue(addend), true
+	}
+	return sym, ImmValue(addend), true
+}
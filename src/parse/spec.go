@@ -0,0 +1,586 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// 値のビット[Shift+Hi-Lo:Shift]を命令のビット[Hi:Lo]に置く
+type bitRange struct {
+	Hi, Lo, Shift int
+}
+
+func (b bitRange) width() int { return b.Hi - b.Lo + 1 }
+
+// ビットフィールドの並び
+type bitLayout []bitRange
+
+func (l bitLayout) mask() uint32 {
+	var m uint32
+	for _, b := range l {
+		m |= (1<<b.width() - 1) << b.Lo
+	}
+	return m
+}
+
+// 値の幅。符号拡張に使う
+func (l bitLayout) width() int {
+	w := 0
+	for _, b := range l {
+		if b.Shift+b.width() > w {
+			w = b.Shift + b.width()
+		}
+	}
+	return w
+}
+
+// 値のいちばん下に置くビット。それより下のビットは0でなければならない
+func (l bitLayout) lowest() int {
+	low := l.width()
+	for _, b := range l {
+		if b.Shift < low {
+			low = b.Shift
+		}
+	}
+	return low
+}
+
+func (l bitLayout) encode(val int64) uint32 {
+	var insn uint32
+	for _, b := range l {
+		insn |= uint32(val>>b.Shift) & (1<<b.width() - 1) << b.Lo
+	}
+	return insn
+}
+
+func (l bitLayout) decode(insn uint32, signed bool) int64 {
+	var val int64
+	for _, b := range l {
+		val |= int64(insn>>b.Lo&(1<<b.width()-1)) << b.Shift
+	}
+	if w := l.width(); signed && val>>(w-1)&1 == 1 {
+		val -= 1 << w
+	}
+	return val
+}
+
+// 固定フィールドの位置
+var (
+	opcodeField = bitLayout{{6, 0, 0}}
+	rdField     = bitLayout{{11, 7, 0}}
+	funct3Field = bitLayout{{14, 12, 0}}
+	rs1Field    = bitLayout{{19, 15, 0}}
+	rs2Field    = bitLayout{{24, 20, 0}}
+	funct7Field = bitLayout{{31, 25, 0}}
+	rs3Field    = bitLayout{{31, 27, 0}}
+)
+
+// RVC命令の固定フィールドとレジスタの位置
+var (
+	cOpcodeField  = bitLayout{{1, 0, 0}}
+	cFunct3Field  = bitLayout{{15, 13, 0}}
+	cFunct4Field  = bitLayout{{15, 12, 0}}
+	cFunct6Field  = bitLayout{{15, 10, 0}}
+	cFunct2Field  = bitLayout{{6, 5, 0}}
+	cRdField      = bitLayout{{11, 7, 0}}
+	cRs2Field     = bitLayout{{6, 2, 0}}
+	cPrimeLoField = bitLayout{{4, 2, 0}} // x8-x15を3bitで表すレジスタ (rd', rs2')
+	cPrimeHiField = bitLayout{{9, 7, 0}} // rs1', rd'/rs1'
+)
+
+// RVC命令の即値の配置
+var (
+	cImm6Layout  = bitLayout{{12, 12, 5}, {6, 2, 0}}                                                                        // CI形式の imm[5|4:0]
+	cBimm9Layout = bitLayout{{12, 12, 8}, {11, 10, 3}, {6, 5, 6}, {4, 3, 1}, {2, 2, 5}}                                     // c.beqz, c.bnez の offset[8|4:3|7:6|2:1|5]
+	cImm12Layout = bitLayout{{12, 12, 11}, {11, 11, 4}, {10, 9, 8}, {8, 8, 10}, {7, 7, 6}, {6, 6, 7}, {5, 3, 1}, {2, 2, 5}} // c.j, c.jal の offset[11|4|9:8|10|6|7|3:1|5]
+)
+
+// 形式ごとの即値(imm)の配置
+var immLayouts = map[OpecodeType]bitLayout{
+	IType: {{31, 20, 0}},
+	SType: {{31, 25, 5}, {11, 7, 0}},
+	BType: {{31, 31, 12}, {30, 25, 5}, {11, 8, 1}, {7, 7, 11}},
+	UType: {{31, 12, 0}},
+	JType: {{31, 31, 20}, {30, 21, 1}, {20, 20, 11}, {19, 12, 12}},
+}
+
+/*
+形式ごとの即値(imm)の役割。範囲は配置のビット幅から求める
+U形式は符号なし、それ以外は符号付きで、最下位ビットを置かない形式 (B, J) は2の倍数
+*/
+func immRole(format OpecodeType) (operandRole, bool) {
+	layout, exists := immLayouts[format]
+	if !exists {
+		return operandRole{}, false
+	}
+	role := operandRole{typ: IMM | LAB, layout: layout, signed: format != UType, rangeErr: "illegal operands: immediate %d out of range"}
+	w := layout.width()
+	role.align = 1 << layout.lowest()
+	if role.signed {
+		role.min, role.max = -1<<(w-1), 1<<(w-1)-role.align
+	} else {
+		role.max = 1<<w - 1
+	}
+	return role, true
+}
+
+// 書式に書けるオペランドの役割
+type operandRole struct {
+	typ      OperandType
+	layout   bitLayout
+	signed   bool    // 逆アセンブルで符号拡張する
+	def      int64   // 省略されたときの値
+	min, max int64   // どちらかが0でなければ即値の範囲はmin...max
+	align    int64   // 0でなければ即値はこの倍数
+	invalid  []int64 // 使えない値。レジスタではレジスタ番号
+	wrap     int     // 0でなければ、このビット幅の符号なしの値を符号付きの値として範囲を見る (c.lui)
+	rangeErr string  // 範囲外のときのエラー。空なら"illegal operand."
+	literal  bool    // 書式にレジスタ名そのものを書いたオペランド。値は決まっているのでエンコードしない
+}
+
+var operandRoles = map[string]operandRole{
+	"rd":     {typ: REG, layout: rdField},
+	"rs1":    {typ: REG, layout: rs1Field},
+	"rs2":    {typ: REG, layout: rs2Field},
+	"shamt":  {typ: IMM, layout: rs2Field, max: 31, rangeErr: "improper shift amount (%d)"},
+	"bs":     {typ: IMM, layout: bitLayout{{31, 30, 0}}, max: 3, rangeErr: "improper bs immediate (%d)"},
+	"csr":    {typ: CSR | IMM, layout: bitLayout{{31, 20, 0}}, max: 0xfff, rangeErr: "CSR address out of range: %d"},
+	"zimm":   {typ: IMM, layout: rs1Field, max: 31},
+	"pred":   {typ: FENCESET, layout: bitLayout{{27, 24, 0}}, def: 0b1111},
+	"succ":   {typ: FENCESET, layout: bitLayout{{23, 20, 0}}, def: 0b1111},
+	"symbol": {typ: LAB}, // 疑似命令が展開先の命令に渡すシンボル
+
+	// ベクトル命令
+	"vd":     {typ: VREG, layout: rdField},
+	"vs1":    {typ: VREG, layout: rs1Field},
+	"vs2":    {typ: VREG, layout: rs2Field},
+	"vs3":    {typ: VREG, layout: rdField},
+	"vm":     {typ: VMASK, layout: bitLayout{{25, 25, 0}}, def: 1}, // v0.tを書くとvm=0
+	"simm5":  {typ: IMM, layout: rs1Field, signed: true, min: -16, max: 15},
+	"uimm5":  {typ: IMM, layout: rs1Field, max: 31},
+	"zimm11": {typ: VTYPE | IMM, layout: bitLayout{{30, 20, 0}}, max: 0x7ff},
+	"zimm10": {typ: VTYPE | IMM, layout: bitLayout{{29, 20, 0}}, max: 0x3ff},
+
+	// ベクトルの比較の疑似命令が1を引いてsimm5にする即値 (vmslt.vi など)
+	"simm5p1": {typ: IMM, min: -15, max: 16},
+}
+
+// RVC命令のオペランドの役割。名前は riscv-opcodes にならう
+// _n0 はx0を、_n2 はx0とx2を使えないレジスタ、_p はx8-x15のレジスタ
+var compressedOperandRoles = map[string]operandRole{
+	"rd_n0":     {typ: REG, layout: cRdField, invalid: []int64{0}},
+	"rd_n2":     {typ: REG, layout: cRdField, invalid: []int64{0, 2}},
+	"rd_rs1_n0": {typ: REG, layout: cRdField, invalid: []int64{0}},
+	"rs1_n0":    {typ: REG, layout: cRdField, invalid: []int64{0}},
+	"c_rs2":     {typ: REG, layout: cRs2Field},
+	"c_rs2_n0":  {typ: REG, layout: cRs2Field, invalid: []int64{0}},
+	"rd_p":      {typ: CREG, layout: cPrimeLoField},
+	"rs2_p":     {typ: CREG, layout: cPrimeLoField},
+	"rs1_p":     {typ: CREG, layout: cPrimeHiField},
+	"rd_rs1_p":  {typ: CREG, layout: cPrimeHiField},
+
+	"c_nzuimm10":  {typ: IMM, layout: bitLayout{{12, 11, 4}, {10, 7, 6}, {6, 6, 2}, {5, 5, 3}}, min: 4, max: 1020, align: 4},
+	"c_uimm7":     {typ: IMM, layout: bitLayout{{12, 10, 3}, {6, 6, 2}, {5, 5, 6}}, max: 124, align: 4},
+	"c_nzimm6":    {typ: IMM, layout: cImm6Layout, signed: true, min: -32, max: 31, invalid: []int64{0}},
+	"c_imm6":      {typ: IMM, layout: cImm6Layout, signed: true, min: -32, max: 31},
+	"c_nzimm10":   {typ: IMM, layout: bitLayout{{12, 12, 9}, {6, 6, 4}, {5, 5, 6}, {4, 3, 7}, {2, 2, 5}}, signed: true, min: -512, max: 496, align: 16, invalid: []int64{0}},
+	"c_nzimm18":   {typ: IMM, layout: cImm6Layout, signed: true, min: -32, max: 31, invalid: []int64{0}, wrap: 20}, // luiの即値の下位6bit
+	"c_nzuimm6":   {typ: IMM, layout: cImm6Layout, min: 1, max: 31},                                                // RV32ではshamt[5]は0
+	"c_imm12":     {typ: IMM | LAB, layout: cImm12Layout, signed: true, min: -2048, max: 2046, align: 2},
+	"c_bimm9":     {typ: IMM | LAB, layout: cBimm9Layout, signed: true, min: -256, max: 254, align: 2},
+	"c_uimm8sp":   {typ: IMM, layout: bitLayout{{12, 12, 5}, {6, 4, 2}, {3, 2, 6}}, max: 252, align: 4},
+	"c_uimm8sp_s": {typ: IMM, layout: bitLayout{{12, 9, 2}, {8, 7, 6}}, max: 252, align: 4},
+}
+
+// 書式中のオペランド
+type specOperand struct {
+	name     string
+	optional bool
+	operandRole
+}
+
+// 書式に書かれたオペランドの名前
+type syntaxOperand struct {
+	name     string
+	optional bool
+}
+
+// 書式をオペランドの名前に分ける。"[...]" で囲まれたオペランドは省略できる
+func syntaxOperands(syntax string) []syntaxOperand {
+	var operands []syntaxOperand
+	optional := false
+	for _, tok := range strings.FieldsFunc(syntax, func(r rune) bool { return strings.ContainsRune(", ()", r) }) {
+		if strings.HasPrefix(tok, "[") {
+			optional = true
+			tok = tok[1:]
+		}
+		closing := strings.HasSuffix(tok, "]")
+		operands = append(operands, syntaxOperand{strings.TrimSuffix(tok, "]"), optional})
+		if closing {
+			optional = false
+		}
+	}
+	return operands
+}
+
+// 書式にレジスタ名そのものが書かれていれば、そのレジスタだけをとるオペランドにする (c.lwspのspなど)
+func literalRole(name string) (operandRole, bool) {
+	if isRegister(name) {
+		return operandRole{typ: REG, literal: true}, true
+	} else if isVectorRegister(name) {
+		return operandRole{typ: VREG, literal: true}, true
+	}
+	return operandRole{}, false
+}
+
+func isCompressedFormat(typ OpecodeType) bool {
+	return CRType <= typ && typ <= CJType
+}
+
+/*
+書式を解釈して、オペランドの役割とmatch/maskを求める
+書式は "rd, imm(rs1)" のようにソースに書く形で、省略できるオペランドは "[rs1, rs2]" のように括弧で囲む
+オペランドが使わないビットはすべてFieldsの値で固定される
+Aliasを指定した疑似命令は、lookupで展開先の命令を探して求める
+*/
+func (s *InstructionSpec) compile(name string, lookup func(string) (InstructionSpec, bool)) error {
+	if s.Alias != "" {
+		return s.compileAlias(name, lookup)
+	}
+
+	roles := operandRoles
+	if isCompressedFormat(s.Format) {
+		roles = compressedOperandRoles
+	}
+	var operands []specOperand
+	var used uint32
+	for _, tok := range syntaxOperands(s.Syntax) {
+		role, exists := roles[tok.name]
+		if tok.name == "imm" {
+			role, exists = immRole(s.Format)
+		}
+		if !exists {
+			role, exists = literalRole(tok.name)
+		}
+		if !exists {
+			return fmt.Errorf("unknown operand `%s' in syntax of `%s'", tok.name, name)
+		}
+		if used&role.layout.mask() != 0 {
+			return fmt.Errorf("operand `%s' overlaps another operand in syntax of `%s'", tok.name, name)
+		}
+		used |= role.layout.mask()
+		operands = append(operands, specOperand{tok.name, tok.optional, role})
+	}
+	s.operands = operands
+
+	// 複数の命令に展開する疑似命令はそれ自体をエンコードしない
+	if s.Format == PseudoType {
+		return nil
+	}
+
+	f := s.Fields
+	var fixed, width uint32
+	if isCompressedFormat(s.Format) {
+		if f.Opcode&0b11 == 0b11 {
+			return fmt.Errorf("`%s' is not a 16-bit instruction (opcode %#x)", name, f.Opcode)
+		}
+		fixed = cOpcodeField.encode(int64(f.Opcode)) | cRdField.encode(int64(f.Rd)) | cRdField.encode(int64(f.Rs1)) |
+			cRs2Field.encode(int64(f.Rs2)) | cFunct2Field.encode(int64(f.Funct2)) | cFunct3Field.encode(int64(f.Funct3)) |
+			cFunct4Field.encode(int64(f.Funct4)) | cFunct6Field.encode(int64(f.Funct6))
+		width = 0xffff
+	} else {
+		if f.Opcode&0b11 != 0b11 {
+			return fmt.Errorf("`%s' is not a 32-bit instruction (opcode %#x)", name, f.Opcode)
+		}
+		fixed = opcodeField.encode(int64(f.Opcode)) | rdField.encode(int64(f.Rd)) | funct3Field.encode(int64(f.Funct3)) |
+			rs1Field.encode(int64(f.Rs1)) | rs2Field.encode(int64(f.Rs2)) | funct7Field.encode(int64(f.Funct7))
+		width = 0xffffffff
+	}
+	s.mask = ^used & width
+	s.match = fixed & s.mask
+
+	// リロケーションファンクションは即値のオペランドに付けられ、命令形式に合っていなければならない
+	if s.Reloc != "" {
+		if !s.hasOperand("imm") {
+			return fmt.Errorf("`%s' has no immediate operand for relocation function `%s'", name, s.Reloc)
+		}
+		if err := checkRelFunc(s.Format, s.Reloc); err != nil {
+			return fmt.Errorf("%s: `%s'", err.Error(), name)
+		}
+	}
+	return nil
+}
+
+/*
+1命令の疑似命令のmatch/maskとオペランドを、展開先の命令から求める
+Aliasの展開先のオペランドには、疑似命令の書式のオペランド名かレジスタ名、即値を書く
+同じオペランドを複数の位置に書けば、そのすべてのフィールドに同じ値を置く (vmmv.m など)
+*/
+func (s *InstructionSpec) compileAlias(name string, lookup func(string) (InstructionSpec, bool)) error {
+	targetName, args, _ := strings.Cut(s.Alias, " ")
+	target, exists := lookup(targetName)
+	if !exists || target.Alias != "" || target.Format == PseudoType {
+		return fmt.Errorf("unknown instruction `%s' in alias of `%s'", targetName, name)
+	}
+	targetArgs := syntaxOperands(args)
+	if len(targetArgs) > len(target.operands) {
+		return fmt.Errorf("too many operands in alias of `%s'", name)
+	}
+
+	syntax := syntaxOperands(s.Syntax)
+	isOperand := func(arg string) bool {
+		for _, opr := range syntax {
+			if opr.name == arg {
+				return true
+			}
+		}
+		return false
+	}
+
+	roles := map[string]operandRole{}
+	fixed, mask := target.match, target.mask
+	for i, opr := range target.operands {
+		if i >= len(targetArgs) {
+			if !opr.optional {
+				return fmt.Errorf("missing operand `%s' in alias of `%s'", opr.name, name)
+			}
+			fixed |= opr.layout.encode(opr.def)
+			mask |= opr.layout.mask()
+			continue
+		}
+
+		arg := targetArgs[i].name
+		if isOperand(arg) {
+			role, seen := roles[arg]
+			if !seen {
+				role = opr.operandRole
+				role.layout = nil
+			} else if role.typ != opr.typ {
+				return fmt.Errorf("operand `%s' is used as different kinds of operands in alias of `%s'", arg, name)
+			}
+			role.layout = append(append(bitLayout{}, role.layout...), opr.layout...)
+			roles[arg] = role
+			continue
+		}
+
+		// 展開先のオペランドに直接書かれた値はフィールドに固定する
+		if analyzeOperandType(arg)&opr.typ == 0 || !opr.accepts(arg) {
+			return fmt.Errorf("illegal operand `%s' in alias of `%s'", arg, name)
+		}
+		fixed |= opr.layout.encode(operandValue(opr.typ, arg, nil))
+		mask |= opr.layout.mask()
+	}
+
+	var operands []specOperand
+	for _, opr := range syntax {
+		role, exists := roles[opr.name]
+		if !exists {
+			return fmt.Errorf("operand `%s' of `%s' is not used in alias", opr.name, name)
+		}
+		operands = append(operands, specOperand{opr.name, opr.optional, role})
+	}
+	s.Format = target.Format
+	if s.VGroup == 0 {
+		s.VGroup = target.VGroup
+	}
+	s.MaskDst = s.MaskDst || target.MaskDst
+	s.operands = operands
+	s.mask = mask
+	s.match = fixed & mask
+	return nil
+}
+
+func (s InstructionSpec) hasOperand(name string) bool {
+	for _, opr := range s.operands {
+		if opr.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// パーサーが使うオペランドの種類
+func (s InstructionSpec) operandTypes() []OperandType {
+	typs := []OperandType{}
+	for _, opr := range s.operands {
+		typ := opr.typ
+		if opr.optional {
+			typ |= OPT
+		}
+		typs = append(typs, typ)
+	}
+	return typs
+}
+
+// オペランドの値によらず決まるビット
+func (s InstructionSpec) Match() uint32 { return s.match }
+
+// Matchで決まるビットの位置
+func (s InstructionSpec) Mask() uint32 { return s.mask }
+
+// 命令のバイト数。RVC命令は2byte、それ以外は4byte
+func (s InstructionSpec) Size() int {
+	if isCompressedFormat(s.Format) {
+		return 2
+	}
+	return 4
+}
+
+/*
+逆アセンブルで命令を選ぶときの優先度
+固定されたビットと、複数のフィールドに同じ値を置くことで決まるビットが多いほど優先する
+*/
+func (s InstructionSpec) specificity() int {
+	n := bits.OnesCount32(s.mask)
+	for _, opr := range s.operands {
+		n += opr.layout.duplicated()
+	}
+	return n
+}
+
+// 値の同じビットを複数のフィールドに置いている数
+func (l bitLayout) duplicated() int {
+	var covered uint64
+	n := 0
+	for _, b := range l {
+		n += b.width()
+		covered |= (1<<b.width() - 1) << b.Shift
+	}
+	return n - bits.OnesCount64(covered)
+}
+
+// 値の制約を見る
+func (s InstructionSpec) validate(operands []string) error {
+	for i, opr := range s.operands {
+		if i >= len(operands) {
+			break
+		}
+		val := operands[i]
+		if opr.accepts(val) {
+			continue
+		}
+		if opr.rangeErr != "" {
+			return fmt.Errorf(opr.rangeErr, ImmValue(val))
+		}
+		return errors.New("illegal operand.")
+	}
+	return s.validateVector(operands)
+}
+
+// ベクトルレジスタの組は組の大きさの倍数の番号から始まり、v0.tをとる命令は結果でマスクを上書きできない
+func (s InstructionSpec) validateVector(operands []string) error {
+	masked, vd := false, ""
+	for i, opr := range s.operands {
+		if i >= len(operands) {
+			break
+		}
+		switch {
+		case opr.typ&VMASK != 0:
+			masked = operands[i] == VectorMask
+		case opr.typ&VREG != 0 && s.VGroup != 0 && VRegisterSet[operands[i]]%s.VGroup != 0:
+			return fmt.Errorf("illegal operands: `%s' is not aligned to a group of %d vector registers", operands[i], s.VGroup)
+		}
+		if opr.name == "vd" {
+			vd = operands[i]
+		}
+	}
+	if masked && !s.MaskDst && vd != "" && VRegisterSet[vd] == 0 {
+		return errors.New("illegal operands: the destination of a masked instruction cannot be v0")
+	}
+	return nil
+}
+
+// オペランドの値が制約を満たしているか
+// 即値にシンボルが使われていれば範囲はリンク時に決まる
+func (opr specOperand) accepts(val string) bool {
+	switch {
+	case opr.literal:
+		return registerNumber(val) == registerNumber(opr.name)
+	case opr.typ&(REG|CREG|VREG) != 0:
+		return !containsInt(opr.invalid, int64(registerNumber(val)))
+	case opr.typ&VTYPE != 0:
+		vtype, ok := vtypeValue(val)
+		return ok && inRange(vtype, opr.min, opr.max)
+	case !IsImmediate(val):
+		return true
+	}
+
+	imm := ImmValue(val)
+	if opr.wrap != 0 {
+		if !inRange(imm, 0, 1<<opr.wrap-1) {
+			return false
+		}
+		if imm >= 1<<(opr.wrap-1) {
+			imm -= 1 << opr.wrap
+		}
+	}
+	return opr.acceptsValue(imm)
+}
+
+// 即値が範囲、倍数、使えない値の制約を満たしているか
+func (opr specOperand) acceptsValue(imm int64) bool {
+	if (opr.min != 0 || opr.max != 0) && !inRange(imm, opr.min, opr.max) {
+		return false
+	}
+	if opr.align != 0 && imm%opr.align != 0 {
+		return false
+	}
+	return !containsInt(opr.invalid, imm)
+}
+
+// x/vレジスタの番号
+func registerNumber(val string) int {
+	if n, exists := RegisterSet[val]; exists {
+		return n
+	}
+	return VRegisterSet[val]
+}
+
+/*
+書式の順に並んだオペランドから命令をエンコードする
+シンボルの値は resolve で求める
+*/
+func (s InstructionSpec) Encode(operands []string, resolve func(string) int) uint32 {
+	insn := s.match
+	for i, opr := range s.operands {
+		val := opr.def
+		if i < len(operands) {
+			val = operandValue(opr.typ, operands[i], resolve)
+		}
+		insn |= opr.layout.encode(val)
+	}
+	return insn
+}
+
+func operandValue(typ OperandType, val string, resolve func(string) int) int64 {
+	switch {
+	case typ&CREG != 0:
+		return int64(RegisterSet[val] - 8)
+	case typ&REG != 0:
+		return int64(RegisterSet[val])
+	case typ&VREG != 0:
+		return int64(VRegisterSet[val])
+	case typ&VMASK != 0:
+		return 0
+	case typ&VTYPE != 0:
+		return int64(VtypeValue(val))
+	case typ&FENCESET != 0:
+		return int64(fenceSetBits(val))
+	case typ&CSR != 0:
+		return int64(CSRNumber(val))
+	case IsImmediate(val):
+		return ImmValue(val)
+	}
+	return int64(resolve(val))
+}
+
+// fenceの"iorw"をビットにする
+func fenceSetBits(set string) int {
+	bits := 0
+	for _, c := range set {
+		bits |= 1 << (3 - strings.IndexRune("iorw", c))
+	}
+	return bits
+}
@@ -39,6 +39,10 @@ func (t Token) isLabel() bool {
 		return false
 	}
 	literal = literal[:len(literal)-1]
+	// ":"だけではラベルにならない
+	if len(literal) == 0 {
+		return false
+	}
 	// すべて数値
 	if isNumericStr(literal[:len(literal)-1]) {
 		return true
@@ -0,0 +1,516 @@
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Vector (V extension)
+const (
+	VSETVLI  = "vsetvli"
+	VSETIVLI = "vsetivli"
+	VSETVL   = "vsetvl"
+
+	VectorMask = "v0.t"
+)
+
+// 比較の疑似命令。gasと同じく、反対の比較や1つずらした即値との比較に展開する
+// 一時レジスタをとる vmsge{u}.vx vd, va, x, v0.t, vt の書式と、浮動小数点の疑似命令は扱わない
+const (
+	VMSLTVI  = "vmslt.vi"
+	VMSLTUVI = "vmsltu.vi"
+	VMSGEVI  = "vmsge.vi"
+	VMSGEUVI = "vmsgeu.vi"
+	VMSGEVX  = "vmsge.vx"
+	VMSGEUVX = "vmsgeu.vx"
+)
+
+// ベクトルレジスタ名とレジスタ番号の対応
+var VRegisterSet = map[string]int{}
+
+// ベクトル命令のopcodeとfunct3
+const (
+	opcodeOPV     = 0b1010111
+	opcodeLoadFP  = 0b0000111
+	opcodeStoreFP = 0b0100111
+
+	opIVV = 0b000
+	opMVV = 0b010
+	opIVI = 0b011
+	opIVX = 0b100
+	opMVX = 0b110
+	opCFG = 0b111
+)
+
+// 算術命令の命令名、funct6、OPM(vs1/rs1をとる演算がOPMVV/OPMVX)かどうか、オペランド形式の接尾辞
+// 接尾辞の最後の文字(vvm, vxm, vimでは2文字目)がvs1/rs1/immのどれをとるかを表す
+type vectorArithForm struct {
+	name   string
+	funct6 int
+	opm    bool
+	forms  []string
+}
+
+// マスクをとれる算術命令
+var vectorArithForms = []vectorArithForm{
+	// 整数演算
+	{"vadd", 0b000000, false, []string{"vv", "vx", "vi"}},
+	{"vsub", 0b000010, false, []string{"vv", "vx"}},
+	{"vrsub", 0b000011, false, []string{"vx", "vi"}},
+	{"vwaddu", 0b110000, true, []string{"vv", "vx"}},
+	{"vwadd", 0b110001, true, []string{"vv", "vx"}},
+	{"vwsubu", 0b110010, true, []string{"vv", "vx"}},
+	{"vwsub", 0b110011, true, []string{"vv", "vx"}},
+	{"vwaddu", 0b110100, true, []string{"wv", "wx"}},
+	{"vwadd", 0b110101, true, []string{"wv", "wx"}},
+	{"vwsubu", 0b110110, true, []string{"wv", "wx"}},
+	{"vwsub", 0b110111, true, []string{"wv", "wx"}},
+	{"vand", 0b001001, false, []string{"vv", "vx", "vi"}},
+	{"vor", 0b001010, false, []string{"vv", "vx", "vi"}},
+	{"vxor", 0b001011, false, []string{"vv", "vx", "vi"}},
+	{"vsll", 0b100101, false, []string{"vv", "vx", "vi"}},
+	{"vsrl", 0b101000, false, []string{"vv", "vx", "vi"}},
+	{"vsra", 0b101001, false, []string{"vv", "vx", "vi"}},
+	{"vnsrl", 0b101100, false, []string{"wv", "wx", "wi"}},
+	{"vnsra", 0b101101, false, []string{"wv", "wx", "wi"}},
+	{"vmseq", 0b011000, false, []string{"vv", "vx", "vi"}},
+	{"vmsne", 0b011001, false, []string{"vv", "vx", "vi"}},
+	{"vmsltu", 0b011010, false, []string{"vv", "vx"}},
+	{"vmslt", 0b011011, false, []string{"vv", "vx"}},
+	{"vmsleu", 0b011100, false, []string{"vv", "vx", "vi"}},
+	{"vmsle", 0b011101, false, []string{"vv", "vx", "vi"}},
+	{"vmsgtu", 0b011110, false, []string{"vx", "vi"}},
+	{"vmsgt", 0b011111, false, []string{"vx", "vi"}},
+	{"vminu", 0b000100, false, []string{"vv", "vx"}},
+	{"vmin", 0b000101, false, []string{"vv", "vx"}},
+	{"vmaxu", 0b000110, false, []string{"vv", "vx"}},
+	{"vmax", 0b000111, false, []string{"vv", "vx"}},
+	{"vmul", 0b100101, true, []string{"vv", "vx"}},
+	{"vmulh", 0b100111, true, []string{"vv", "vx"}},
+	{"vmulhu", 0b100100, true, []string{"vv", "vx"}},
+	{"vmulhsu", 0b100110, true, []string{"vv", "vx"}},
+	{"vdivu", 0b100000, true, []string{"vv", "vx"}},
+	{"vdiv", 0b100001, true, []string{"vv", "vx"}},
+	{"vremu", 0b100010, true, []string{"vv", "vx"}},
+	{"vrem", 0b100011, true, []string{"vv", "vx"}},
+	{"vwmul", 0b111011, true, []string{"vv", "vx"}},
+	{"vwmulu", 0b111000, true, []string{"vv", "vx"}},
+	{"vwmulsu", 0b111010, true, []string{"vv", "vx"}},
+
+	// 固定小数点演算
+	{"vsaddu", 0b100000, false, []string{"vv", "vx", "vi"}},
+	{"vsadd", 0b100001, false, []string{"vv", "vx", "vi"}},
+	{"vssubu", 0b100010, false, []string{"vv", "vx"}},
+	{"vssub", 0b100011, false, []string{"vv", "vx"}},
+	{"vaaddu", 0b001000, true, []string{"vv", "vx"}},
+	{"vaadd", 0b001001, true, []string{"vv", "vx"}},
+	{"vasubu", 0b001010, true, []string{"vv", "vx"}},
+	{"vasub", 0b001011, true, []string{"vv", "vx"}},
+	{"vsmul", 0b100111, false, []string{"vv", "vx"}},
+	{"vssrl", 0b101010, false, []string{"vv", "vx", "vi"}},
+	{"vssra", 0b101011, false, []string{"vv", "vx", "vi"}},
+	{"vnclipu", 0b101110, false, []string{"wv", "wx", "wi"}},
+	{"vnclip", 0b101111, false, []string{"wv", "wx", "wi"}},
+
+	// リダクション
+	{"vredsum", 0b000000, true, []string{"vs"}},
+	{"vredand", 0b000001, true, []string{"vs"}},
+	{"vredor", 0b000010, true, []string{"vs"}},
+	{"vredxor", 0b000011, true, []string{"vs"}},
+	{"vredminu", 0b000100, true, []string{"vs"}},
+	{"vredmin", 0b000101, true, []string{"vs"}},
+	{"vredmaxu", 0b000110, true, []string{"vs"}},
+	{"vredmax", 0b000111, true, []string{"vs"}},
+	{"vwredsumu", 0b110000, false, []string{"vs"}},
+	{"vwredsum", 0b110001, false, []string{"vs"}},
+
+	// 置換
+	{"vslideup", 0b001110, false, []string{"vx", "vi"}},
+	{"vslidedown", 0b001111, false, []string{"vx", "vi"}},
+	{"vslide1up", 0b001110, true, []string{"vx"}},
+	{"vslide1down", 0b001111, true, []string{"vx"}},
+	{"vrgather", 0b001100, false, []string{"vv", "vx", "vi"}},
+	{"vrgatherei16", 0b001110, false, []string{"vv"}},
+}
+
+// マスクをとらない算術命令
+var vectorUnmaskedForms = []vectorArithForm{
+	{"vmadc", 0b010001, false, []string{"vv", "vx", "vi"}},
+	{"vmsbc", 0b010011, false, []string{"vv", "vx"}},
+	{"vcompress", 0b010111, true, []string{"vm"}},
+	{"vmand", 0b011001, true, []string{"mm"}},
+	{"vmnand", 0b011101, true, []string{"mm"}},
+	{"vmandn", 0b011000, true, []string{"mm"}},
+	{"vmxor", 0b011011, true, []string{"mm"}},
+	{"vmor", 0b011010, true, []string{"mm"}},
+	{"vmnor", 0b011110, true, []string{"mm"}},
+	{"vmorn", 0b011100, true, []string{"mm"}},
+	{"vmxnor", 0b011111, true, []string{"mm"}},
+}
+
+// v0をマスクとして使う命令
+var vectorMergeForms = []vectorArithForm{
+	{"vadc", 0b010000, false, []string{"vvm", "vxm", "vim"}},
+	{"vmadc", 0b010001, false, []string{"vvm", "vxm", "vim"}},
+	{"vsbc", 0b010010, false, []string{"vvm", "vxm"}},
+	{"vmsbc", 0b010011, false, []string{"vvm", "vxm"}},
+	{"vmerge", 0b010111, false, []string{"vvm", "vxm", "vim"}},
+}
+
+// 積和演算
+var vectorMulAddForms = []vectorArithForm{
+	{"vmacc", 0b101101, true, []string{"vv", "vx"}},
+	{"vnmsac", 0b101111, true, []string{"vv", "vx"}},
+	{"vmadd", 0b101001, true, []string{"vv", "vx"}},
+	{"vnmsub", 0b101011, true, []string{"vv", "vx"}},
+	{"vwmaccu", 0b111100, true, []string{"vv", "vx"}},
+	{"vwmacc", 0b111101, true, []string{"vv", "vx"}},
+	{"vwmaccsu", 0b111111, true, []string{"vv", "vx"}},
+	{"vwmaccus", 0b111110, true, []string{"vx"}},
+}
+
+// .viの即値が符号なし5bitの命令
+var vectorUimm5 = map[string]bool{
+	"vsll.vi":       true,
+	"vsrl.vi":       true,
+	"vsra.vi":       true,
+	"vssrl.vi":      true,
+	"vssra.vi":      true,
+	"vnsrl.wi":      true,
+	"vnsra.wi":      true,
+	"vnclipu.wi":    true,
+	"vnclip.wi":     true,
+	"vslideup.vi":   true,
+	"vslidedown.vi": true,
+	"vrgather.vi":   true,
+}
+
+// 結果がマスクかvd[0]だけなので、v0.tをとってもv0に書ける命令
+var vectorMaskDst = map[string]bool{
+	"vmseq":     true,
+	"vmsne":     true,
+	"vmsltu":    true,
+	"vmslt":     true,
+	"vmsleu":    true,
+	"vmsle":     true,
+	"vmsgtu":    true,
+	"vmsgt":     true,
+	"vredsum":   true,
+	"vredand":   true,
+	"vredor":    true,
+	"vredxor":   true,
+	"vredminu":  true,
+	"vredmin":   true,
+	"vredmaxu":  true,
+	"vredmax":   true,
+	"vwredsumu": true,
+	"vwredsum":  true,
+}
+
+// funct6とvmからbits[31:25]の値を作る
+func vectorFunct7(funct6, vm int) int {
+	return funct6<<1 | vm
+}
+
+// vsetvli等と、vs1フィールドやvs2フィールドが固定の命令
+var vectorInstructions = map[string]InstructionSpec{
+	VSETVLI:  {Format: VCfgType, Syntax: "rd, rs1, zimm11", Fields: Fields{Opcode: opcodeOPV, Funct3: opCFG}},
+	VSETIVLI: {Format: VCfgType, Syntax: "rd, uimm5, zimm10", Fields: Fields{Opcode: opcodeOPV, Funct3: opCFG, Funct7: 0b1100000}},
+	VSETVL:   {Format: VCfgType, Syntax: "rd, rs1, rs2", Fields: Fields{Opcode: opcodeOPV, Funct3: opCFG, Funct7: 0b1000000}},
+
+	"vmv.x.s":   {Format: VUnaryType, Syntax: "rd, vs2", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010000, 1), Rs1: 0b00000}},
+	"vcpop.m":   {Format: VUnaryType, Syntax: "rd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010000, 0), Rs1: 0b10000}},
+	"vfirst.m":  {Format: VUnaryType, Syntax: "rd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010000, 0), Rs1: 0b10001}},
+	"vzext.vf8": {Format: VUnaryType, Syntax: "vd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010010, 0), Rs1: 0b00010}},
+	"vsext.vf8": {Format: VUnaryType, Syntax: "vd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010010, 0), Rs1: 0b00011}},
+	"vzext.vf4": {Format: VUnaryType, Syntax: "vd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010010, 0), Rs1: 0b00100}},
+	"vsext.vf4": {Format: VUnaryType, Syntax: "vd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010010, 0), Rs1: 0b00101}},
+	"vzext.vf2": {Format: VUnaryType, Syntax: "vd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010010, 0), Rs1: 0b00110}},
+	"vsext.vf2": {Format: VUnaryType, Syntax: "vd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010010, 0), Rs1: 0b00111}},
+	"vmsbf.m":   {Format: VUnaryType, Syntax: "vd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010100, 0), Rs1: 0b00001}},
+	"vmsof.m":   {Format: VUnaryType, Syntax: "vd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010100, 0), Rs1: 0b00010}},
+	"vmsif.m":   {Format: VUnaryType, Syntax: "vd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010100, 0), Rs1: 0b00011}},
+	"viota.m":   {Format: VUnaryType, Syntax: "vd, vs2, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010100, 0), Rs1: 0b10000}},
+	"vid.v":     {Format: VUnaryType, Syntax: "vd, [vm]", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVV, Funct7: vectorFunct7(0b010100, 0), Rs1: 0b10001}},
+	"vmv1r.v":   {Format: VUnaryType, Syntax: "vd, vs2", Fields: Fields{Opcode: opcodeOPV, Funct3: opIVI, Funct7: vectorFunct7(0b100111, 1), Rs1: 0}},
+	"vmv2r.v":   {Format: VUnaryType, Syntax: "vd, vs2", Fields: Fields{Opcode: opcodeOPV, Funct3: opIVI, Funct7: vectorFunct7(0b100111, 1), Rs1: 1}, VGroup: 2},
+	"vmv4r.v":   {Format: VUnaryType, Syntax: "vd, vs2", Fields: Fields{Opcode: opcodeOPV, Funct3: opIVI, Funct7: vectorFunct7(0b100111, 1), Rs1: 3}, VGroup: 4},
+	"vmv8r.v":   {Format: VUnaryType, Syntax: "vd, vs2", Fields: Fields{Opcode: opcodeOPV, Funct3: opIVI, Funct7: vectorFunct7(0b100111, 1), Rs1: 7}, VGroup: 8},
+
+	"vmv.v.v": {Format: VMoveType, Syntax: "vd, vs1", Fields: Fields{Opcode: opcodeOPV, Funct3: opIVV, Funct7: vectorFunct7(0b010111, 1)}},
+	"vmv.v.x": {Format: VMoveType, Syntax: "vd, rs1", Fields: Fields{Opcode: opcodeOPV, Funct3: opIVX, Funct7: vectorFunct7(0b010111, 1)}},
+	"vmv.v.i": {Format: VMoveType, Syntax: "vd, simm5", Fields: Fields{Opcode: opcodeOPV, Funct3: opIVI, Funct7: vectorFunct7(0b010111, 1)}},
+	"vmv.s.x": {Format: VMoveType, Syntax: "vd, rs1", Fields: Fields{Opcode: opcodeOPV, Funct3: opMVX, Funct7: vectorFunct7(0b010000, 1)}},
+
+	// 疑似命令
+	"vneg.v":       {Syntax: "vd, vs, [vm]", Alias: "vrsub.vx vd, vs, x0, vm"},
+	"vnot.v":       {Syntax: "vd, vs, [vm]", Alias: "vxor.vi vd, vs, -1, vm"},
+	"vwcvt.x.x.v":  {Syntax: "vd, vs, [vm]", Alias: "vwadd.vx vd, vs, x0, vm"},
+	"vwcvtu.x.x.v": {Syntax: "vd, vs, [vm]", Alias: "vwaddu.vx vd, vs, x0, vm"},
+	"vncvt.x.x.w":  {Syntax: "vd, vs, [vm]", Alias: "vnsrl.wx vd, vs, x0, vm"},
+	"vmsgt.vv":     {Syntax: "vd, va, vb, [vm]", Alias: "vmslt.vv vd, vb, va, vm"}, // vs2とvs1を入れ替える
+	"vmsgtu.vv":    {Syntax: "vd, va, vb, [vm]", Alias: "vmsltu.vv vd, vb, va, vm"},
+	"vmsge.vv":     {Syntax: "vd, va, vb, [vm]", Alias: "vmsle.vv vd, vb, va, vm"},
+	"vmsgeu.vv":    {Syntax: "vd, va, vb, [vm]", Alias: "vmsleu.vv vd, vb, va, vm"},
+	"vmmv.m":       {Syntax: "vd, vs", Alias: "vmand.mm vd, vs, vs"},
+	"vmnot.m":      {Syntax: "vd, vs", Alias: "vmnand.mm vd, vs, vs"},
+	"vmclr.m":      {Syntax: "vd", Alias: "vmxor.mm vd, vd, vd"},
+	"vmset.m":      {Syntax: "vd", Alias: "vmxnor.mm vd, vd, vd"},
+
+	VMSLTVI:  {Format: PseudoType, Syntax: "vd, vs2, simm5p1, [vm]", MaskDst: true},
+	VMSLTUVI: {Format: PseudoType, Syntax: "vd, vs2, simm5p1, [vm]", MaskDst: true},
+	VMSGEVI:  {Format: PseudoType, Syntax: "vd, vs2, simm5p1, [vm]", MaskDst: true},
+	VMSGEUVI: {Format: PseudoType, Syntax: "vd, vs2, simm5p1, [vm]", MaskDst: true},
+	VMSGEVX:  {Format: PseudoType, Syntax: "vd, vs2, rs1, [vm]"}, // マスクをとるときは結果をv0と組み合わせるので、v0に書けない
+	VMSGEUVX: {Format: PseudoType, Syntax: "vd, vs2, rs1, [vm]"},
+}
+
+// ロード、ストアのeewとwidthフィールドの対応
+var vectorWidth = map[int]int{8: 0b000, 16: 0b101, 32: 0b110, 64: 0b111}
+
+// ロード、ストアのmopフィールド
+const (
+	mopUnitStride       = 0b00
+	mopIndexedUnordered = 0b01
+	mopStrided          = 0b10
+	mopIndexedOrdered   = 0b11
+)
+
+// ロード、ストアのlumop/sumopフィールド
+const (
+	umopUnitStride    = 0b00000
+	umopWholeRegister = 0b01000
+	umopMask          = 0b01011
+	umopFaultOnly     = 0b10000
+)
+
+// ロード、ストアの命令の定義を作る
+// ストアはvdの代わりにvs3をとり、マスクをとらない命令はvm=1に固定する
+func vectorMem(load bool, syntax string, nf, mop, umop, eew int) InstructionSpec {
+	opcode, vm := opcodeStoreFP, 0
+	if load {
+		opcode = opcodeLoadFP
+	} else {
+		syntax = strings.Replace(syntax, "vd", "vs3", 1)
+	}
+	if !strings.Contains(syntax, "vm") {
+		vm = 1
+	}
+	return InstructionSpec{Format: VMemType, Syntax: syntax, Fields: Fields{
+		Opcode: opcode,
+		Funct3: vectorWidth[eew],
+		Rs2:    umop,
+		Funct7: ((nf-1)<<3|mop)<<1 | vm,
+	}}
+}
+
+// 接尾辞から、vs1/rs1/immのどれをとるかと、funct3を返す
+func vectorSource(name, form string, opm bool) (string, int) {
+	kind := form[len(form)-1]
+	if len(form) == 3 {
+		kind = form[1]
+	}
+	switch {
+	case kind == 'x' && opm:
+		return "rs1", opMVX
+	case kind == 'x':
+		return "rs1", opIVX
+	case kind == 'i' && vectorUimm5[name]:
+		return "uimm5", opIVI
+	case kind == 'i':
+		return "simm5", opIVI
+	case opm:
+		return "vs1", opMVV
+	}
+	return "vs1", opIVV
+}
+
+// 算術命令の定義を作る。syntaxの"src"はvs1/rs1/immに置き換える
+func addVectorArith(specs map[string]InstructionSpec, forms []vectorArithForm, format OpecodeType, syntax string, vm int) {
+	for _, inst := range forms {
+		for _, form := range inst.forms {
+			name := inst.name + "." + form
+			src, funct3 := vectorSource(name, form, inst.opm)
+			specs[name] = InstructionSpec{
+				Format:  format,
+				Syntax:  strings.Replace(syntax, "src", src, 1),
+				Fields:  Fields{Opcode: opcodeOPV, Funct3: funct3, Funct7: vectorFunct7(inst.funct6, vm)},
+				MaskDst: vectorMaskDst[inst.name],
+			}
+		}
+	}
+}
+
+func init() {
+	for i := 0; i <= 31; i++ {
+		VRegisterSet[fmt.Sprintf("v%d", i)] = i
+	}
+
+	specs := map[string]InstructionSpec{}
+	for name, spec := range vectorInstructions {
+		specs[name] = spec
+	}
+	addVectorArith(specs, vectorArithForms, VArithType, "vd, vs2, src, [vm]", 0)
+	addVectorArith(specs, vectorUnmaskedForms, VArithType, "vd, vs2, src", 1)
+	addVectorArith(specs, vectorMergeForms, VMergeType, "vd, vs2, src, v0", 0)
+	addVectorArith(specs, vectorMulAddForms, VMulAddType, "vd, src, vs2, [vm]", 0)
+
+	// ロード、ストア
+	const (
+		unitStride    = "vd, (rs1), [vm]"
+		strided       = "vd, (rs1), rs2, [vm]"
+		indexed       = "vd, (rs1), vs2, [vm]"
+		wholeRegister = "vd, (rs1)"
+	)
+	for eew := range vectorWidth {
+		for nf := 1; nf <= 8; nf++ {
+			seg := ""
+			if nf > 1 {
+				seg = fmt.Sprintf("seg%d", nf)
+			}
+			specs[fmt.Sprintf("vl%se%d.v", seg, eew)] = vectorMem(true, unitStride, nf, mopUnitStride, umopUnitStride, eew)
+			specs[fmt.Sprintf("vs%se%d.v", seg, eew)] = vectorMem(false, unitStride, nf, mopUnitStride, umopUnitStride, eew)
+			specs[fmt.Sprintf("vl%se%dff.v", seg, eew)] = vectorMem(true, unitStride, nf, mopUnitStride, umopFaultOnly, eew)
+			specs[fmt.Sprintf("vls%se%d.v", seg, eew)] = vectorMem(true, strided, nf, mopStrided, 0, eew)
+			specs[fmt.Sprintf("vss%se%d.v", seg, eew)] = vectorMem(false, strided, nf, mopStrided, 0, eew)
+
+			// RV32ではインデックスのEEWに64は使えない
+			if eew == 64 {
+				continue
+			}
+			specs[fmt.Sprintf("vlux%sei%d.v", seg, eew)] = vectorMem(true, indexed, nf, mopIndexedUnordered, 0, eew)
+			specs[fmt.Sprintf("vlox%sei%d.v", seg, eew)] = vectorMem(true, indexed, nf, mopIndexedOrdered, 0, eew)
+			specs[fmt.Sprintf("vsux%sei%d.v", seg, eew)] = vectorMem(false, indexed, nf, mopIndexedUnordered, 0, eew)
+			specs[fmt.Sprintf("vsox%sei%d.v", seg, eew)] = vectorMem(false, indexed, nf, mopIndexedOrdered, 0, eew)
+		}
+		for _, nf := range []int{1, 2, 4, 8} {
+			spec := vectorMem(true, wholeRegister, nf, mopUnitStride, umopWholeRegister, eew)
+			spec.VGroup = nf
+			specs[fmt.Sprintf("vl%dre%d.v", nf, eew)] = spec
+		}
+	}
+	for _, nf := range []int{1, 2, 4, 8} {
+		spec := vectorMem(false, wholeRegister, nf, mopUnitStride, umopWholeRegister, 8)
+		spec.VGroup = nf
+		specs[fmt.Sprintf("vs%dr.v", nf)] = spec
+		specs[fmt.Sprintf("vl%dr.v", nf)] = InstructionSpec{Syntax: "vd, (rs1)", Alias: fmt.Sprintf("vl%dre8.v vd, (rs1)", nf)} // 疑似命令
+	}
+	specs["vlm.v"] = vectorMem(true, wholeRegister, 1, mopUnitStride, umopMask, 8)
+	specs["vsm.v"] = vectorMem(false, wholeRegister, 1, mopUnitStride, umopMask, 8)
+
+	// Vはzve32xを含むので、どちらが有効でも使える
+	MustRegisterExtension(Extension{Name: "v", Instructions: specs})
+	MustRegisterExtension(Extension{Name: "zve32x", Instructions: specs})
+}
+
+// 即値を1つずらした比較に展開する疑似命令と、即値が0のときに展開する常に真か偽の比較
+var vectorCompareImm = map[string]struct{ cmp, zero string }{
+	VMSLTVI:  {"vmsle.vi", ""},
+	VMSLTUVI: {"vmsleu.vi", "vmsne.vv"}, // 0より小さい符号なし整数はない
+	VMSGEVI:  {"vmsgt.vi", ""},
+	VMSGEUVI: {"vmsgtu.vi", "vmseq.vv"}, // 符号なし整数は全て0以上
+}
+
+// vmsge.vx, vmsgeu.vx の結果を反転する前の比較
+var vectorCompareNot = map[string]string{
+	VMSGEVX:  "vmslt.vx",
+	VMSGEUVX: "vmsltu.vx",
+}
+
+/*
+ベクトルの比較の疑似命令を命令列に展開する。展開はgasと同じ
+vmsge.vx, vmsgeu.vx は反対の比較の結果を反転する。マスクをとるときはv0との排他的論理和で
+マスクの立っている要素だけを反転する
+*/
+func (o *Operation) expandVectorCompare() []Operation {
+	oprs := o.operands
+	mask := oprs[3:] // v0.tがあれば1つ
+	if c, exists := vectorCompareImm[o.opcode]; exists {
+		imm := ImmValue(oprs[2])
+		if imm == 0 && c.zero != "" {
+			return []Operation{o.sequence(c.zero, "", append([]string{oprs[0], oprs[1], oprs[1]}, mask...)...)}
+		}
+		return []Operation{o.sequence(c.cmp, "", append([]string{oprs[0], oprs[1], strconv.FormatInt(imm-1, 10)}, mask...)...)}
+	}
+	cmp := o.sequence(vectorCompareNot[o.opcode], "", append([]string{oprs[0], oprs[1], oprs[2]}, mask...)...)
+	if len(mask) == 0 {
+		return []Operation{cmp, o.sequence("vmnand.mm", "", oprs[0], oprs[0], oprs[0])}
+	}
+	return []Operation{cmp, o.sequence("vmxor.mm", "", oprs[0], oprs[0], "v0")}
+}
+
+func isVectorRegister(val string) bool {
+	_, exists := VRegisterSet[val]
+	return exists
+}
+
+// vtypeの各要素の値
+var (
+	vtypeSEW  = map[string]int{"e8": 0, "e16": 1, "e32": 2, "e64": 3}
+	vtypeLMUL = map[string]int{"m1": 0, "m2": 1, "m4": 2, "m8": 3, "mf8": 5, "mf4": 6, "mf2": 7}
+	vtypeTail = map[string]int{"tu": 0, "ta": 1}
+	vtypeMask = map[string]int{"mu": 0, "ma": 1}
+)
+
+func isVtypeField(val string) bool {
+	for _, fields := range []map[string]int{vtypeSEW, vtypeLMUL, vtypeTail, vtypeMask} {
+		if _, exists := fields[val]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// vtypeの残りの要素を読み進めて、","区切りの1つの文字列にする
+func (o *Operation) joinVtype(first string) string {
+	fields := []string{first}
+	for !o.isEOF() {
+		start := o.idx
+		val, typ := o.nextOperand()
+		if typ&VTYPE == 0 {
+			o.idx = start
+			break
+		}
+		fields = append(fields, val)
+		o.skipUntilNextOperand()
+	}
+	return strings.Join(fields, ",")
+}
+
+/*
+"e32,m4,ta,ma" 形式のvtypeを即値に変換する
+SEWは必須で、LMUL、テールポリシー、マスクポリシーは省略できるがこの順に並んでいなければならない
+*/
+func vtypeValue(val string) (int64, bool) {
+	if IsImmediate(val) {
+		return ImmValue(val), true
+	}
+	fields := strings.Split(val, ",")
+	sew, exists := vtypeSEW[fields[0]]
+	if !exists {
+		return 0, false
+	}
+	value := sew << 3
+	fields = fields[1:]
+	shifts := []struct {
+		values map[string]int
+		shift  int
+	}{{vtypeLMUL, 0}, {vtypeTail, 6}, {vtypeMask, 7}}
+	for _, s := range shifts {
+		if len(fields) == 0 {
+			break
+		}
+		if v, exists := s.values[fields[0]]; exists {
+			value |= v << s.shift
+			fields = fields[1:]
+		}
+	}
+	return int64(value), len(fields) == 0
+}
+
+// vtypeの即値を返す。検証済みであることが前提
+func VtypeValue(val string) int {
+	v, _ := vtypeValue(val)
+	return int(v)
+}
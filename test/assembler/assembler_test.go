@@ -0,0 +1,328 @@
+// assembler/assembler_test.go
+
+package assemblertest
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/assembler"
+	"github.com/ayase-mstk/go32as/src/diag"
+)
+
+const src = `    .globl _start
+_start:
+    addi a0, zero, 1
+    lui a1, %hi(msg)
+    .data
+msg:
+    .string "hi"
+`
+
+func TestAssembleBytes(t *testing.T) {
+	obj, warnings, err := assembler.AssembleBytes([]byte(src), assembler.Config{Filename: "test.s"})
+	if err != nil {
+		t.Fatalf("test - assemble failed:\n%q", err.Error())
+	}
+	if len(warnings) != 0 {
+		t.Errorf("test - unexpected warnings: %q", warnings)
+	}
+	f, err := elf.NewFile(bytes.NewReader(obj))
+	if err != nil {
+		t.Fatalf("test - output is not a valid ELF file: %s", err.Error())
+	}
+	if f.Machine != elf.EM_RISCV || f.Type != elf.ET_REL {
+		t.Errorf("test - ELF header wrong. got=%v %v", f.Machine, f.Type)
+	}
+	if text := f.Section(".text"); text == nil || text.Size != 8 {
+		t.Errorf("test - .text wrong. got=%v", text)
+	}
+
+	// io.Writerに書いた結果と同じ
+	var buf bytes.Buffer
+	if _, err := assembler.Assemble(strings.NewReader(src), &buf, assembler.Config{Filename: "test.s"}); err != nil {
+		t.Fatalf("test - assemble failed:\n%q", err.Error())
+	}
+	if !bytes.Equal(buf.Bytes(), obj) {
+		t.Errorf("test - Assemble and AssembleBytes outputs differ")
+	}
+}
+
+func TestAssembleConfig(t *testing.T) {
+	picSrc := src + "    .text\n    lui a2, %hi(ext)\n"
+	obj, warnings, err := assembler.AssembleBytes([]byte(picSrc), assembler.Config{March: "rv32ic", PIC: true, Filename: "pic.s"})
+	if err != nil {
+		t.Fatalf("test - assemble failed:\n%q", err.Error())
+	}
+	f, err := elf.NewFile(bytes.NewReader(obj))
+	if err != nil {
+		t.Fatalf("test - output is not a valid ELF file: %s", err.Error())
+	}
+	// RVCが有効なのでaddiは圧縮される
+	if text := f.Section(".text"); text.Size != 10 {
+		t.Errorf("test - .text size wrong. got=%d, expected=10", text.Size)
+	}
+	// 警告にはソースの名前が付く。ファイル内のmsgは置き換えられないので警告しない
+	expected := "pic.s:9: Warning: absolute address of preemptible symbol `ext' used in position-independent code"
+	if len(warnings) != 1 || warnings[0] != expected {
+		t.Errorf("test - warnings wrong. got=%q, expected=%q", warnings, expected)
+	}
+}
+
+func TestAssembleError(t *testing.T) {
+	tests := []struct {
+		src      string
+		cfg      assembler.Config
+		expected string
+	}{
+		{"    addi a0, a0\n", assembler.Config{Filename: "a.s"}, "a.s:1: Error: "},
+		{"x:\n    .word x - foo\n", assembler.Config{Filename: "b.s"}, "b.s:2: Error: can't resolve"},
+		{"    addi a0, a0, 1\n", assembler.Config{March: "rv64i"}, ""},
+	}
+
+	for i, tt := range tests {
+		obj, _, err := assembler.AssembleBytes([]byte(tt.src), tt.cfg)
+		if err == nil {
+			t.Fatalf("test[%d] - expected error, but got nil", i)
+		}
+		if obj != nil {
+			t.Errorf("test[%d] - output must be nil on error", i)
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("test[%d] - error message wrong. got=%q, expected prefix=%q", i, err.Error(), tt.expected)
+		}
+	}
+}
+
+func TestAssembleFile(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.s")
+	output := filepath.Join(dir, "out", "test.o")
+	if err := os.WriteFile(input, []byte(src), 0644); err != nil {
+		t.Fatalf("test - failed to write source: %s", err.Error())
+	}
+	if err := os.Mkdir(filepath.Dir(output), 0755); err != nil {
+		t.Fatalf("test - failed to create directory: %s", err.Error())
+	}
+
+	if _, err := assembler.AssembleFile(input, output, assembler.Config{}); err != nil {
+		t.Fatalf("test - assemble failed:\n%q", err.Error())
+	}
+	written, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("test - output is missing: %s", err.Error())
+	}
+	expected, _, _ := assembler.AssembleBytes([]byte(src), assembler.Config{})
+	if !bytes.Equal(written, expected) {
+		t.Errorf("test - file output differs from AssembleBytes")
+	}
+
+	// 失敗したら既存の出力は書き換えず、一時ファイルも残さない
+	if err := os.WriteFile(input, []byte("    addi a0, a0\n"), 0644); err != nil {
+		t.Fatalf("test - failed to write source: %s", err.Error())
+	}
+	if _, err := assembler.AssembleFile(input, output, assembler.Config{}); err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	} else if !strings.HasPrefix(err.Error(), input+":1: Error: ") {
+		t.Errorf("test - error message wrong. got=%q", err.Error())
+	}
+	if after, _ := os.ReadFile(output); !bytes.Equal(after, written) {
+		t.Errorf("test - output was changed by a failed assembly")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(output))
+	if len(entries) != 1 {
+		t.Errorf("test - temporary files are left: %d entries", len(entries))
+	}
+}
+
+func TestBuildSources(t *testing.T) {
+	srcs := []assembler.Source{
+		{Name: "a.s", Data: []byte("    .globl _start\n_start:\n    call foo\n    .data\nmsg:\n    .string \"hi\"\n")},
+		// セクションは前のソースから引き継ぐ
+		{Name: "b.s", Data: []byte("    .word 1\n    .text\nfoo:\n    jalr zero, ra, 0\n")},
+	}
+	obj, err := assembler.Build(srcs, assembler.Config{Defsyms: []string{"VAL=0x10"}})
+	if err != nil {
+		t.Fatalf("test - build failed:\n%q", err.Error())
+	}
+	var buf bytes.Buffer
+	if err := obj.Write(&buf); err != nil {
+		t.Fatalf("test - write failed: %s", err.Error())
+	}
+	f, err := elf.NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("test - output is not a valid ELF file: %s", err.Error())
+	}
+	if text := f.Section(".text"); text.Size != 12 {
+		t.Errorf("test - .text size wrong. got=%d, expected=12", text.Size)
+	}
+	if data := f.Section(".data"); data.Size != 6 {
+		t.Errorf("test - .data size wrong. got=%d, expected=6", data.Size)
+	}
+	syms, _ := f.Symbols()
+	values := map[string]uint64{}
+	for _, sym := range syms {
+		values[sym.Name] = sym.Value
+	}
+	// foo は2つ目のソースで定義されているので外部シンボルにならない
+	if v, ok := values["foo"]; !ok || v != 8 {
+		t.Errorf("test - foo wrong. got=%d, %v", v, ok)
+	}
+	if v, ok := values["VAL"]; !ok || v != 0x10 {
+		t.Errorf("test - --defsym VAL wrong. got=%d, %v", v, ok)
+	}
+
+	// エラーは文のあるソースの名前で報告する
+	srcs[1].Data = []byte("_start:\n")
+	if _, err := assembler.Build(srcs, assembler.Config{}); err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	} else if !strings.HasPrefix(err.Error(), "b.s:1: Error: ") {
+		t.Errorf("test - error message wrong. got=%q", err.Error())
+	}
+
+	// 同じソースを2回渡すと、同じセクションでもラベルの定義が重複する
+	src := assembler.Source{Name: "c.s", Data: []byte("    .text\nbar:\n    addi a0, a0, 1\n")}
+	if _, err := assembler.Build([]assembler.Source{src, src}, assembler.Config{}); err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	} else if err.Error() != "c.s:2: Error: symbol `\"bar\"' is already defined" {
+		t.Errorf("test - error message wrong. got=%q", err.Error())
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	tests := []struct {
+		cfg      assembler.Config
+		expected string
+	}{
+		{assembler.Config{Defsyms: []string{"VAL=1", "MASK=0xff"}}, ""},
+		{assembler.Config{Defsyms: []string{"VAL"}}, "bad defsym; format is --defsym name=value"},
+		{assembler.Config{Defsyms: []string{"=1"}}, "bad defsym; format is --defsym name=value"},
+		{assembler.Config{Defsyms: []string{"VAL=x"}}, "bad defsym `VAL=x'"},
+		{assembler.Config{March: "rv64i"}, "-march=rv64i"},
+	}
+
+	for i, tt := range tests {
+		err := tt.cfg.Check()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("test[%d] - unexpected error: %q", i, err.Error())
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("test[%d] - error wrong. got=%v, expected prefix=%q", i, err, tt.expected)
+		}
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	listSrc := "    .globl _start\n_start:\n    call foo\n    .data\nmsg:\n    .word 1\n"
+	obj, err := assembler.Build([]assembler.Source{{Name: "l.s", Data: []byte(listSrc)}}, assembler.Config{})
+	if err != nil {
+		t.Fatalf("test - build failed:\n%q", err.Error())
+	}
+	var buf bytes.Buffer
+	if err := obj.WriteListing(&buf, assembler.ListingOptions{Assembly: true, Symbols: true}); err != nil {
+		t.Fatalf("test - listing failed: %s", err.Error())
+	}
+
+	expected := []string{
+		"RISC-V GAS  l.s \t\t\tpage 1",
+		"   1              \t    .globl _start",
+		"   2              \t_start:",
+		// callはauipcとjalrの2命令になる
+		"   3 0000 97000000 \t    call foo",
+		"   3      E7800000",
+		"   6 0000 01000000 \t    .word 1",
+		"DEFINED SYMBOLS",
+		"                 l.s:2  .text:00000000 _start",
+		"                 l.s:5  .data:00000000 msg",
+		"UNDEFINED SYMBOLS",
+		"foo",
+	}
+	listing := buf.String()
+	for _, line := range expected {
+		if !strings.Contains(listing, line+"\n") {
+			t.Errorf("test - listing does not contain %q:\n%s", line, listing)
+		}
+	}
+}
+
+func TestBuildDiagnostics(t *testing.T) {
+	srcs := []assembler.Source{{Name: "e.s", Data: []byte("x:\n    .data\nx:\n    .reloc 0, R_FOO\n    .bss\n    addi a0, a0, 1\n")}}
+	obj, err := assembler.Build(srcs, assembler.Config{})
+	if err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	}
+	// レイアウトのエラーにもソースの名前が付き、行の順に並ぶ
+	expected := "e.s:3: Error: symbol `\"x\"' is already defined\n" +
+		"e.s:4: Error: unknown relocation type `R_FOO'\n" +
+		"e.s:6: Error: unknown pseudo-op:addi"
+	if err.Error() != expected {
+		t.Errorf("test - error message wrong. got=%q, expected=%q", err.Error(), expected)
+	}
+
+	var buf bytes.Buffer
+	diags := obj.Diagnostics()
+	diag.Render(&buf, diags[1], obj.SourceLine)
+	rendered := "e.s:4:5: Error: unknown relocation type `R_FOO'\n    .reloc 0, R_FOO\n    ^\n"
+	if buf.String() != rendered {
+		t.Errorf("test - render wrong. got=%q, expected=%q", buf.String(), rendered)
+	}
+
+	// 上限を超えたエラーは捨てる
+	obj, err = assembler.Build(srcs, assembler.Config{ErrorLimit: 2})
+	var list diag.List
+	if !errors.As(err, &list) || len(list) != 3 || len(obj.Diagnostics()) != 3 {
+		t.Fatalf("test - truncated errors wrong. got=%v", list)
+	}
+	if list[2].Message != "too many errors (2), stopping" {
+		t.Errorf("test - last message wrong. got=%q", list[2].Message)
+	}
+}
+
+func TestBuildDiagnosticsAfterParseError(t *testing.T) {
+	// パースのエラーがあっても、正しく読めた文のレイアウトのエラーまで集める
+	srcs := []assembler.Source{{Name: "e.s", Data: []byte("x:\n    addi a0, a0\n    .data\nx:\n    .reloc 0, R_FOO\n")}}
+	obj, err := assembler.Build(srcs, assembler.Config{})
+	var list diag.List
+	if !errors.As(err, &list) {
+		t.Fatalf("test - expected diag.List, but got %v", err)
+	}
+	expected := []int{2, 4, 5}
+	if len(list) != len(expected) || len(obj.Diagnostics()) != len(expected) {
+		t.Fatalf("test - diagnostics length wrong. got=%v", list)
+	}
+	for i, line := range expected {
+		if list[i].Line != line {
+			t.Errorf("test[%d] - line wrong. got=%d, expected=%d", i, list[i].Line, line)
+		}
+	}
+}
+
+func TestBuildStopsAtErrorLimit(t *testing.T) {
+	// パースで上限を超えるエラーを見つけたら、残りの行もレイアウトのエラーも集めない
+	srcs := []assembler.Source{{Name: "e.s", Data: []byte("x:\n    addi a0, a0\n    .data\nx:\n    addi a0, a0\n    lw a1, 0(a9)\n")}}
+	obj, err := assembler.Build(srcs, assembler.Config{ErrorLimit: 1})
+	var list diag.List
+	if !errors.As(err, &list) || len(list) != 2 || len(obj.Diagnostics()) != 2 {
+		t.Fatalf("test - truncated errors wrong. got=%v", list)
+	}
+	if list[0].Line != 2 || list[1].Message != "too many errors (1), stopping" {
+		t.Errorf("test - diagnostics wrong. got=%v", list)
+	}
+
+	// パースのエラーが上限より少なければ、残りの数だけレイアウトのエラーを集める
+	obj, err = assembler.Build(srcs, assembler.Config{ErrorLimit: 3})
+	if !errors.As(err, &list) || len(list) != 4 {
+		t.Fatalf("test - truncated errors wrong. got=%v", list)
+	}
+	if list[1].Line != 4 || list[3].Message != "too many errors (3), stopping" {
+		t.Errorf("test - diagnostics wrong. got=%v", list)
+	}
+}
@@ -0,0 +1,137 @@
+// diag/diag_test.go
+
+package diagtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/diag"
+)
+
+func TestDiagnosticError(t *testing.T) {
+	tests := []struct {
+		d        diag.Diagnostic
+		expected string
+	}{
+		{diag.Diagnostic{File: "a.s", Line: 3, Column: 5, Severity: diag.Error, Message: "illegal operand."}, "a.s:3: Error: illegal operand."},
+		{diag.Diagnostic{File: "a.s", Line: 1, Severity: diag.Warning, Message: "w"}, "a.s:1: Warning: w"},
+		{diag.Diagnostic{Line: 2, Severity: diag.Error, Message: "e"}, "2: Error: e"},
+		{diag.Diagnostic{Severity: diag.Error, Message: "e"}, "Error: e"},
+	}
+
+	for i, tt := range tests {
+		if got := tt.d.Error(); got != tt.expected {
+			t.Errorf("test[%d] - message wrong. got=%q, expected=%q", i, got, tt.expected)
+		}
+	}
+}
+
+func TestListErrorsAs(t *testing.T) {
+	list := diag.List{
+		{File: "a.s", Line: 1, Severity: diag.Warning, Message: "w"},
+		{File: "a.s", Line: 2, Severity: diag.Error, Message: "first"},
+		{File: "a.s", Line: 3, Severity: diag.Error, Message: "second"},
+	}
+	if list.Errors() != 2 {
+		t.Errorf("test - error count wrong. got=%d", list.Errors())
+	}
+	err := fmt.Errorf("assemble: %w", list.Err())
+
+	var got diag.List
+	if !errors.As(err, &got) || len(got) != 3 {
+		t.Fatalf("test - errors.As(diag.List) failed. got=%v", got)
+	}
+	var d *diag.Diagnostic
+	if !errors.As(err, &d) || d.Line != 1 {
+		t.Errorf("test - errors.As(*diag.Diagnostic) wrong. got=%v", d)
+	}
+	if list[:1].Err() != nil {
+		t.Errorf("test - warnings only must not be an error")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	var list diag.List
+	for i := 1; i <= 5; i++ {
+		list = append(list, diag.Diagnostic{File: "a.s", Line: i, Severity: diag.Error, Message: "e"})
+	}
+	if got := list.Truncate(0); len(got) != 5 {
+		t.Errorf("test - limit 0 must keep all. got=%d", len(got))
+	}
+	if got := list.Truncate(5); len(got) != 5 {
+		t.Errorf("test - limit 5 must keep all. got=%d", len(got))
+	}
+	got := list.Truncate(2)
+	if len(got) != 3 || got[1].Line != 2 {
+		t.Fatalf("test - truncated list wrong. got=%v", got)
+	}
+	if got[2].Message != "too many errors (2), stopping" {
+		t.Errorf("test - last message wrong. got=%q", got[2].Message)
+	}
+	if len(list) != 5 || list[2].Line != 3 {
+		t.Errorf("test - Truncate must not modify the original list")
+	}
+}
+
+func TestReached(t *testing.T) {
+	list := diag.List{
+		{Line: 1, Severity: diag.Error, Message: "e"},
+		{Line: 2, Severity: diag.Warning, Message: "w"},
+		{Line: 3, Severity: diag.Error, Message: "e"},
+	}
+	tests := []struct {
+		max      int
+		expected bool
+	}{
+		{0, false},
+		{1, true},
+		{2, true},
+		{3, false},
+	}
+
+	for i, tt := range tests {
+		if got := list.Reached(tt.max); got != tt.expected {
+			t.Errorf("test[%d] - Reached(%d) wrong. got=%t, expected=%t", i, tt.max, got, tt.expected)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	lines := map[int]string{3: "\tlw a1, 0(a9)"}
+	source := func(file string, row int) (string, bool) {
+		src, ok := lines[row]
+		return src, ok && file == "a.s"
+	}
+
+	tests := []struct {
+		d        diag.Diagnostic
+		expected string
+	}{
+		// タブは幅を変えずに残す
+		{
+			diag.Diagnostic{File: "a.s", Line: 3, Column: 11, Severity: diag.Error, Message: "illegal operand."},
+			"a.s:3:11: Error: illegal operand.\n\tlw a1, 0(a9)\n\t         ^\n",
+		},
+		// 列が分からなければ^は付けない
+		{
+			diag.Diagnostic{File: "a.s", Line: 3, Severity: diag.Warning, Message: "w", Notes: []string{"n"}},
+			"a.s:3: Warning: w\n\tlw a1, 0(a9)\na.s:3: Note: n\n",
+		},
+		// ソースの行がなければメッセージだけ
+		{
+			diag.Diagnostic{File: "b.s", Line: 1, Column: 1, Severity: diag.Error, Message: "e"},
+			"b.s:1:1: Error: e\n",
+		},
+	}
+
+	for i, tt := range tests {
+		var buf bytes.Buffer
+		diag.Render(&buf, tt.d, source)
+		if buf.String() != tt.expected {
+			t.Errorf("test[%d] - render wrong.\ngot=%q\nexpected=%q", i, buf.String(), tt.expected)
+		}
+	}
+}
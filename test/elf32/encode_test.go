@@ -0,0 +1,1388 @@
+// elf32/encode_test.go
+
+package elf32test
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/diag"
+	"github.com/ayase-mstk/go32as/src/elf32"
+	"github.com/ayase-mstk/go32as/src/isa"
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+type encodeTestStruct struct {
+	src      string
+	expected uint32
+}
+
+// -march=marchでソースをアセンブルして、出力されたオブジェクトファイルを返す
+func assemble(t *testing.T, march, src string) *elf.File {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	path := filepath.Join(dir, "test.s")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatalf("test - failed to write source: %s", err.Error())
+	}
+	arch, err := isa.Parse(march)
+	if err != nil {
+		t.Fatalf("test - invalid -march:\n%q", err.Error())
+	}
+	stmts, err := parse.ParseFile(path, parse.NewOptions(arch))
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+	e, err := elf32.PrepareElf32Tables(stmts, arch, isa.DefaultABI(arch), 0)
+	if err != nil {
+		t.Fatalf("test - prepare failed:\n%q", err.Error())
+	}
+	if err := e.WriteToFile("output.o"); err != nil {
+		t.Fatalf("test - write failed:\n%q", err.Error())
+	}
+
+	f, err := elf.Open(filepath.Join(dir, "output.o"))
+	if err != nil {
+		t.Fatalf("test - output is not a valid ELF file: %s", err.Error())
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// ソースをアセンブルして、出力されたオブジェクトファイルの.textを返す
+func assembleText(t *testing.T, march, src string) []byte {
+	f := assemble(t, march, src)
+	text, err := f.Section(".text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .text: %s", err.Error())
+	}
+	return text
+}
+
+func expectSameEncoding(t *testing.T, march string, tests []encodeTestStruct) {
+	var lines []string
+	for _, tt := range tests {
+		lines = append(lines, tt.src)
+	}
+	text := assembleText(t, march, strings.Join(lines, "\n")+"\n")
+	if len(text) != len(tests)*4 {
+		t.Fatalf("test - .text size wrong. got=%d, expected=%d", len(text), len(tests)*4)
+	}
+
+	for i, tt := range tests {
+		actual := binary.LittleEndian.Uint32(text[i*4:])
+		if actual != tt.expected {
+			t.Errorf("test[%d] - %q encoding wrong. got=%#08x, expected=%#08x",
+				i, tt.src, actual, tt.expected)
+		}
+	}
+}
+
+func TestEncodeBaseInstructions(t *testing.T) {
+	tests := []encodeTestStruct{
+		// R format
+		{"add a0, a1, a2", 0x00c58533},
+		{"sub a0, a1, a2", 0x40c58533},
+		{"xor a0, a1, a2", 0x00c5c533},
+		{"or a0, a1, a2", 0x00c5e533},
+		{"and a0, a1, a2", 0x00c5f533},
+		{"sll a0, a1, a2", 0x00c59533},
+		{"srl a0, a1, a2", 0x00c5d533},
+		{"sra a0, a1, a2", 0x40c5d533},
+		{"slt a0, a1, a2", 0x00c5a533},
+		{"sltu a0, a1, a2", 0x00c5b533},
+
+		// I format
+		{"addi a0, a1, -5", 0xffb58513},
+		{"xori a0, a1, 255", 0x0ff5c513},
+		{"ori a0, a1, 0x7ff", 0x7ff5e513},
+		{"andi a0, a1, -2048", 0x8005f513},
+		{"slli a0, a1, 31", 0x01f59513},
+		{"srli a0, a1, 7", 0x0075d513},
+		{"srai a0, a1, 3", 0x4035d513},
+		{"slti a0, a1, -1", 0xfff5a513},
+		{"sltiu a0, a1, 1", 0x0015b513},
+		{"lb a0, -4(a1)", 0xffc58503},
+		{"lh a0, 8(a1)", 0x00859503},
+		{"lw ra, 12(sp)", 0x00c12083},
+		{"lbu a0, 0(a1)", 0x0005c503},
+		{"lhu a0, 2047(a1)", 0x7ff5d503},
+		{"jalr ra, a0, 16", 0x010500e7},
+		{"ecall", 0x00000073},
+		{"ebreak", 0x00100073},
+
+		// S format
+		{"sb a0, -1(a1)", 0xfea58fa3},
+		{"sh a2, 6(sp)", 0x00c11323},
+		{"sw ra, 12(sp)", 0x00112623},
+
+		// B format
+		{"beq a0, a1, 16", 0x00b50863},
+		{"bne a0, a1, -16", 0xfeb518e3},
+		{"blt a0, a1, 2048", 0x00b540e3},
+		{"bge a0, a1, -4096", 0x80b55063},
+		{"bltu a0, a1, 4094", 0x7eb56fe3},
+		{"bgeu a0, a1, 8", 0x00b57463},
+
+		// U format
+		{"lui a0, 0xfffff", 0xfffff537},
+		{"auipc a0, 1", 0x00001517},
+
+		// J format
+		{"jal ra, 1048574", 0x7ffff0ef},
+		{"jal x0, -1048576", 0x8000006f},
+	}
+
+	expectSameEncoding(t, "rv32i", tests)
+}
+
+func TestEncodeFence(t *testing.T) {
+	tests := []encodeTestStruct{
+		{"fence", 0x0ff0000f},
+		{"fence iorw, iorw", 0x0ff0000f},
+		{"fence rw, w", 0x0310000f},
+		{"fence iorw, o", 0x0f40000f},
+		{"fence i, r", 0x0820000f},
+		{"fence.tso", 0x8330000f},
+		{"pause", 0x0100000f},
+		{"fence.i", 0x0000100f},
+	}
+
+	expectSameEncoding(t, "rv32i_zifencei_zihintpause", tests)
+}
+
+func TestEncodeBitmanip(t *testing.T) {
+	tests := []encodeTestStruct{
+		{"sh1add a0, a1, a2", 0x20c5a533},
+		{"sh2add a0, a1, a2", 0x20c5c533},
+		{"sh3add a0, a1, a2", 0x20c5e533},
+		{"andn a0, a1, a2", 0x40c5f533},
+		{"orn a0, a1, a2", 0x40c5e533},
+		{"xnor a0, a1, a2", 0x40c5c533},
+		{"clz a0, a1", 0x60059513},
+		{"ctz a0, a1", 0x60159513},
+		{"cpop a0, a1", 0x60259513},
+		{"max a0, a1, a2", 0x0ac5e533},
+		{"maxu a0, a1, a2", 0x0ac5f533},
+		{"min a0, a1, a2", 0x0ac5c533},
+		{"minu a0, a1, a2", 0x0ac5d533},
+		{"sext.b a0, a1", 0x60459513},
+		{"sext.h a0, a1", 0x60559513},
+		{"zext.h a0, a1", 0x0805c533},
+		{"rol a0, a1, a2", 0x60c59533},
+		{"ror a0, a1, a2", 0x60c5d533},
+		{"rori a0, a1, 31", 0x61f5d513},
+		{"orc.b a0, a1", 0x2875d513},
+		{"rev8 a0, a1", 0x6985d513},
+		{"clmul a0, a1, a2", 0x0ac59533},
+		{"clmulh a0, a1, a2", 0x0ac5b533},
+		{"clmulr a0, a1, a2", 0x0ac5a533},
+		{"bclr a0, a1, a2", 0x48c59533},
+		{"bclri a0, a1, 5", 0x48559513},
+		{"bext a0, a1, a2", 0x48c5d533},
+		{"bexti a0, a1, 5", 0x4855d513},
+		{"binv a0, a1, a2", 0x68c59533},
+		{"binvi a0, a1, 5", 0x68559513},
+		{"bset a0, a1, a2", 0x28c59533},
+		{"bseti a0, a1, 5", 0x28559513},
+	}
+
+	expectSameEncoding(t, "rv32i_zba_zbb_zbc_zbs", tests)
+}
+
+func TestBitmanipArchAttribute(t *testing.T) {
+	f := assemble(t, "rv32i_zbb_zba", "    andn a0, a1, a2\n")
+	attr, err := f.Section(".riscv.attributes").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .riscv.attributes: %s", err.Error())
+	}
+	expectValidAttributes(t, attr)
+	if !strings.Contains(string(attr), "rv32i2p1_zba1p0_zbb1p0\x00") {
+		t.Fatalf("test - arch attribute wrong. got=%q", attr)
+	}
+}
+
+func TestEncodeCrypto(t *testing.T) {
+	tests := []encodeTestStruct{
+		{"pack a0, a1, a2", 0x08c5c533},
+		{"packh a0, a1, a2", 0x08c5f533},
+		{"brev8 a0, a1", 0x6875d513},
+		{"zip a0, a1", 0x08f59513},
+		{"unzip a0, a1", 0x08f5d513},
+		{"xperm4 a0, a1, a2", 0x28c5a533},
+		{"xperm8 a0, a1, a2", 0x28c5c533},
+		{"aes32dsi a0, a1, a2, 0", 0x2ac58533},
+		{"aes32dsmi a0, a1, a2, 1", 0x6ec58533},
+		{"aes32esi a0, a1, a2, 2", 0xa2c58533},
+		{"aes32esmi a0, a1, a2, 3", 0xe6c58533},
+		{"sha256sig0 a0, a1", 0x10259513},
+		{"sha256sig1 a0, a1", 0x10359513},
+		{"sha256sum0 a0, a1", 0x10059513},
+		{"sha256sum1 a0, a1", 0x10159513},
+		{"sha512sig0h a0, a1, a2", 0x5cc58533},
+		{"sha512sig0l a0, a1, a2", 0x54c58533},
+		{"sha512sig1h a0, a1, a2", 0x5ec58533},
+		{"sha512sig1l a0, a1, a2", 0x56c58533},
+		{"sha512sum0r a0, a1, a2", 0x50c58533},
+		{"sha512sum1r a0, a1, a2", 0x52c58533},
+		{"sm4ed a0, a1, a2, 2", 0xb0c58533},
+		{"sm4ks a0, a1, a2, 3", 0xf4c58533},
+		{"sm3p0 a0, a1", 0x10859513},
+		{"sm3p1 a0, a1", 0x10959513},
+
+		// Zbbと共通の命令
+		{"ror a0, a1, a2", 0x60c5d533},
+		{"rev8 a0, a1", 0x6985d513},
+		{"clmulh a0, a1, a2", 0x0ac5b533},
+	}
+
+	expectSameEncoding(t, "rv32i_zbkb_zbkc_zbkx_zknd_zkne_zknh_zksed_zksh", tests)
+}
+
+func TestEncodeVector(t *testing.T) {
+	tests := []encodeTestStruct{
+		{"vsetvli a0, a1, e32, m4, ta, ma", 0x0d25f557},
+		{"vsetivli a0, 31, e16, m2, ta, mu", 0xc49ff557},
+		{"vsetvl a0, a1, a2", 0x80c5f557},
+		{"vle32.v v4, (a0)", 0x02056207},
+		{"vle8.v v4, (a0), v0.t", 0x00050207},
+		{"vse16.v v4, (a0)", 0x02055227},
+		{"vlse32.v v4, (a0), a1", 0x0ab56207},
+		{"vluxei16.v v4, (a0), v8, v0.t", 0x04855207},
+		{"vlseg3e32.v v4, (a0)", 0x42056207},
+		{"vl2re32.v v8, (a0)", 0x22856407},
+		{"vs1r.v v4, (a0)", 0x02850227},
+		{"vlm.v v4, (a0)", 0x02b50207},
+		{"vadd.vv v4, v2, v3", 0x02218257},
+		{"vadd.vx v8, v12, a1, v0.t", 0x00c5c457},
+		{"vadd.vi v4, v2, -16", 0x02283257},
+		{"vsll.vi v4, v2, 31", 0x962fb257},
+		{"vnsrl.wx v4, v2, a1", 0xb225c257},
+		{"vwaddu.wv v4, v2, v3", 0xd221a257},
+		{"vmseq.vi v4, v2, 5", 0x6222b257},
+		{"vsaddu.vv v4, v2, v3", 0x82218257},
+		{"vredsum.vs v4, v2, v3", 0x0221a257},
+		{"vmand.mm v4, v2, v3", 0x6621a257},
+		{"vadc.vvm v4, v2, v3, v0", 0x40218257},
+		{"vmerge.vim v4, v2, 5, v0", 0x5c22b257},
+		{"vmacc.vx v4, a1, v2, v0.t", 0xb425e257},
+		{"vmv.x.s a0, v2", 0x42202557},
+		{"vid.v v4", 0x5208a257},
+		{"vmv4r.v v4, v8", 0x9e81b257},
+		{"vmv.v.i v4, -3", 0x5e0eb257},
+
+		// 疑似命令
+		{"vnot.v v4, v2", 0x2e2fb257},
+	}
+
+	expectSameEncoding(t, "rv32iv", tests)
+}
+
+func TestELFFlags(t *testing.T) {
+	tests := []struct {
+		march    string
+		expected uint32
+	}{
+		{"rv32i", 0x0},
+		{"rv32ic", 0x1},
+		{"rv32imafc", 0x3},
+		{"rv32gc", 0x5},
+		{"rv32e", 0x8},
+		{"rv32i_ztso", 0x10},
+	}
+
+	for i, tt := range tests {
+		assemble(t, tt.march, "    addi a0, a0, 1\n")
+		obj, err := os.ReadFile("output.o")
+		if err != nil {
+			t.Fatalf("test[%d] - failed to read output: %s", i, err.Error())
+		}
+		// e_flagsはELFヘッダーの36byte目
+		if flags := binary.LittleEndian.Uint32(obj[36:]); flags != tt.expected {
+			t.Errorf("test[%d] - %s e_flags wrong. got=%#x, expected=%#x", i, tt.march, flags, tt.expected)
+		}
+	}
+}
+
+func TestNoRelax(t *testing.T) {
+	f := assemble(t, "rv32i", `    .option push
+    .option norelax
+    lui a0, %hi(foo)
+    .option pop
+    lui a0, %hi(foo)
+`)
+	relocs, err := f.Section(".rela.text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .rela.text: %s", err.Error())
+	}
+	// R_RISCV_HI20 x2, R_RISCV_RELAX x1
+	if len(relocs) != 3*12 {
+		t.Fatalf("test - relocation count wrong. got=%d, expected=3", len(relocs)/12)
+	}
+	// R_RISCV_RELAXは.option popの後の命令にだけ付く
+	if off := binary.LittleEndian.Uint32(relocs[24:]); off != 4 {
+		t.Fatalf("test - R_RISCV_RELAX offset wrong. got=%d, expected=4", off)
+	}
+}
+
+// .rela.textのエントリを (オフセット, 種類, シンボル名) で返す
+type relocEntry struct {
+	off uint32
+	typ elf.R_RISCV
+	sym string
+}
+
+func readRelocs(t *testing.T, f *elf.File) []relocEntry {
+	return readSectionRelocs(t, f, ".rela.text")
+}
+
+// 指定した再配置セクションのエントリを読む
+func readSectionRelocs(t *testing.T, f *elf.File, name string) []relocEntry {
+	sec := f.Section(name)
+	if sec == nil {
+		t.Fatalf("test - section %s is missing", name)
+	}
+	relocs, err := sec.Data()
+	if err != nil {
+		t.Fatalf("test - failed to read %s: %s", name, err.Error())
+	}
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatalf("test - failed to read symbols: %s", err.Error())
+	}
+	var entries []relocEntry
+	for i := 0; i+12 <= len(relocs); i += 12 {
+		info := binary.LittleEndian.Uint32(relocs[i+4:])
+		entry := relocEntry{off: binary.LittleEndian.Uint32(relocs[i:]), typ: elf.R_RISCV(info & 0xff)}
+		// f.Symbols()はindex0の空シンボルを含まない
+		if idx := info >> 8; idx > 0 {
+			entry.sym = syms[idx-1].Name
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func expectSameRelocs(t *testing.T, actual, expected []relocEntry) {
+	if len(actual) != len(expected) {
+		t.Fatalf("test - relocation count wrong. got=%v, expected=%v", actual, expected)
+	}
+	for i, tt := range expected {
+		if actual[i] != tt {
+			t.Errorf("test[%d] - relocation wrong. got=%v, expected=%v", i, actual[i], tt)
+		}
+	}
+}
+
+func TestRelaxOnlyRelaxableRelocs(t *testing.T) {
+	f := assemble(t, "rv32i", `f:
+    jal ra, f
+    beq a0, a1, f
+    lui a0, %hi(foo)
+    addi a0, a0, %lo(foo)
+    sw a0, %lo(foo)(a1)
+    auipc a0, %pcrel_hi(foo)
+`)
+	expectSameRelocs(t, readRelocs(t, f), []relocEntry{
+		{0, elf.R_RISCV_JAL, "f"},
+		{4, elf.R_RISCV_BRANCH, "f"},
+		{8, elf.R_RISCV_HI20, "foo"},
+		{8, elf.R_RISCV_RELAX, ""},
+		{12, elf.R_RISCV_LO12_I, "foo"},
+		{12, elf.R_RISCV_RELAX, ""},
+		{16, elf.R_RISCV_LO12_S, "foo"},
+		{16, elf.R_RISCV_RELAX, ""},
+		{20, elf.R_RISCV_PCREL_HI20, "foo"},
+		{20, elf.R_RISCV_RELAX, ""},
+	})
+}
+
+func TestRelaxAlign(t *testing.T) {
+	// 緩和を許す.textの.alignは最大のパディングを置き、R_RISCV_ALIGNの加数にその大きさを入れる
+	f := assemble(t, "rv32i", `    call g
+    .align 4
+h:
+    addi a0, a0, 1
+    .option norelax
+    .align 4
+    addi a0, a0, 1
+`)
+	expectSameRelocs(t, readRelocs(t, f), []relocEntry{
+		{0, elf.R_RISCV_CALL_PLT, "g"},
+		{0, elf.R_RISCV_RELAX, ""},
+		{8, elf.R_RISCV_ALIGN, ""},
+	})
+	relocs, err := f.Section(".rela.text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .rela.text: %s", err.Error())
+	}
+	if addend := binary.LittleEndian.Uint32(relocs[2*12+8:]); addend != 12 {
+		t.Errorf("test - R_RISCV_ALIGN addend wrong. got=%d, expected=12", addend)
+	}
+
+	text, err := f.Section(".text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .text: %s", err.Error())
+	}
+	// パディングはnopで、.option norelaxの.alignは普通に揃える
+	if len(text) != 36 {
+		t.Fatalf("test - .text size wrong. got=%d, expected=36", len(text))
+	}
+	for _, off := range []int{8, 12, 16, 24, 28} {
+		if insn := binary.LittleEndian.Uint32(text[off:]); insn != 0x00000013 {
+			t.Errorf("test - padding at %d wrong. got=%#08x, expected=nop", off, insn)
+		}
+	}
+	syms, _ := f.Symbols()
+	for _, sym := range syms {
+		if sym.Name == "h" && sym.Value != 0x14 {
+			t.Errorf("test - h wrong. got=%#x, expected=0x14", sym.Value)
+		}
+	}
+}
+
+func TestRelocationFunctions(t *testing.T) {
+	f := assemble(t, "rv32i", `.L0:
+    auipc a0, %got_pcrel_hi(g)
+    lw a0, %pcrel_lo(.L0)(a0)
+    lui a1, %tprel_hi(t)
+    add a1, a1, tp, %tprel_add(t)
+    sw a2, %tprel_lo(t)(a1)
+.L1:
+    auipc a3, %tls_ie_pcrel_hi(t)
+.L2:
+    auipc a0, %tls_gd_pcrel_hi(t)
+`)
+	expectSameRelocs(t, readRelocs(t, f), []relocEntry{
+		{0, elf.R_RISCV_GOT_HI20, "g"},
+		{0, elf.R_RISCV_RELAX, ""},
+		{4, elf.R_RISCV_PCREL_LO12_I, ".L0"},
+		{4, elf.R_RISCV_RELAX, ""},
+		{8, elf.R_RISCV_TPREL_HI20, "t"},
+		{8, elf.R_RISCV_RELAX, ""},
+		{12, elf.R_RISCV_TPREL_ADD, "t"},
+		{12, elf.R_RISCV_RELAX, ""},
+		{16, elf.R_RISCV_TPREL_LO12_S, "t"},
+		{16, elf.R_RISCV_RELAX, ""},
+		{20, elf.R_RISCV_TLS_GOT_HI20, "t"},
+		{24, elf.R_RISCV_TLS_GD_HI20, "t"},
+	})
+
+	text, err := f.Section(".text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .text: %s", err.Error())
+	}
+	// %tprel_addはオペランドのシンボルを命令に埋め込まない
+	if insn := binary.LittleEndian.Uint32(text[12:]); insn != 0x004585b3 {
+		t.Errorf("test - add with %%tprel_add encoding wrong. got=%#08x, expected=%#08x", insn, 0x004585b3)
+	}
+}
+
+func TestTLSSections(t *testing.T) {
+	f := assemble(t, "rv32i", `    .section .tdata,"awT",@progbits
+tv:
+    .word 5
+    .section .tbss,"awT",@nobits
+tz:
+    .zero 8
+    .text
+main:
+    lui a0, %tprel_hi(tv)
+    add a0, a0, tp, %tprel_add(tv)
+    lw a0, %tprel_lo(tv)(a0)
+    la.tls.ie a1, ie
+    la.tls.gd a0, gd
+    call __tls_get_addr@plt
+`)
+
+	sections := []struct {
+		name  string
+		typ   elf.SectionType
+		flags elf.SectionFlag
+		size  uint64
+	}{
+		{".tdata", elf.SHT_PROGBITS, elf.SHF_WRITE | elf.SHF_ALLOC | elf.SHF_TLS, 4},
+		{".tbss", elf.SHT_NOBITS, elf.SHF_WRITE | elf.SHF_ALLOC | elf.SHF_TLS, 8},
+	}
+	for i, tt := range sections {
+		sec := f.Section(tt.name)
+		if sec == nil {
+			t.Fatalf("test[%d] - section %s is missing", i, tt.name)
+		}
+		if sec.Type != tt.typ || sec.Flags != tt.flags || sec.Size != tt.size {
+			t.Errorf("test[%d] - %s wrong. got=%v %v %d, expected=%v %v %d",
+				i, tt.name, sec.Type, sec.Flags, sec.Size, tt.typ, tt.flags, tt.size)
+		}
+	}
+	if data, _ := f.Section(".tdata").Data(); len(data) != 4 || binary.LittleEndian.Uint32(data) != 5 {
+		t.Errorf("test - .tdata contents wrong. got=%v", data)
+	}
+
+	// TLSセクションのラベルとTLSの再配置で参照する未定義シンボルはSTT_TLS
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatalf("test - failed to read symbols: %s", err.Error())
+	}
+	types := map[string]elf.SymType{}
+	for _, sym := range syms {
+		types[sym.Name] = elf.ST_TYPE(sym.Info)
+	}
+	symTypes := map[string]elf.SymType{
+		"tv":             elf.STT_TLS,
+		"tz":             elf.STT_TLS,
+		"ie":             elf.STT_TLS,
+		"gd":             elf.STT_TLS,
+		"main":           elf.STT_NOTYPE,
+		"__tls_get_addr": elf.STT_NOTYPE,
+	}
+	for name, typ := range symTypes {
+		if types[name] != typ {
+			t.Errorf("test - symbol %s type wrong. got=%v, expected=%v", name, types[name], typ)
+		}
+	}
+
+	expectSameRelocs(t, readRelocs(t, f), []relocEntry{
+		{0, elf.R_RISCV_TPREL_HI20, "tv"},
+		{0, elf.R_RISCV_RELAX, ""},
+		{4, elf.R_RISCV_TPREL_ADD, "tv"},
+		{4, elf.R_RISCV_RELAX, ""},
+		{8, elf.R_RISCV_TPREL_LO12_I, "tv"},
+		{8, elf.R_RISCV_RELAX, ""},
+		// IE/GDモデルのauipcは緩和されないので、それを参照する%pcrel_loにもR_RISCV_RELAXを付けない
+		{12, elf.R_RISCV_TLS_GOT_HI20, "ie"},
+		{16, elf.R_RISCV_PCREL_LO12_I, ".Lpcrel_hi0"},
+		{20, elf.R_RISCV_TLS_GD_HI20, "gd"},
+		{24, elf.R_RISCV_PCREL_LO12_I, ".Lpcrel_hi1"},
+		{28, elf.R_RISCV_CALL_PLT, "__tls_get_addr"},
+		{28, elf.R_RISCV_RELAX, ""},
+	})
+}
+
+// 位置独立なコードで置き換えられうるシンボルの絶対アドレスを使うと警告する
+func TestPICAbsoluteWarning(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.s")
+	src := `    .option pic
+    lui a0, %hi(ext)
+    addi a0, a0, %lo(loc)
+    lui a1, %hi(g)
+    .option nopic
+    lui a2, %hi(ext)
+    .globl g
+loc:
+g:
+`
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatalf("test - failed to write source: %s", err.Error())
+	}
+	arch, _ := isa.Parse("rv32i")
+	stmts, err := parse.ParseFile(path, parse.NewOptions(arch))
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+	e, err := elf32.PrepareElf32Tables(stmts, arch, isa.DefaultABI(arch), 0)
+	if err != nil {
+		t.Fatalf("test - prepare failed:\n%q", err.Error())
+	}
+
+	expected := []string{
+		"2: Warning: absolute address of preemptible symbol `ext' used in position-independent code\n",
+		"4: Warning: absolute address of preemptible symbol `g' used in position-independent code\n",
+	}
+	warnings := e.Warnings()
+	if len(warnings) != len(expected) {
+		t.Fatalf("test - warnings wrong. got=%q, expected=%q", warnings, expected)
+	}
+	for i, w := range expected {
+		if warnings[i] != w {
+			t.Errorf("test[%d] - warning wrong. got=%q, expected=%q", i, warnings[i], w)
+		}
+	}
+}
+
+func TestBranchRelaxation(t *testing.T) {
+	// farまでは4KiBを超える。nearとstartは範囲内
+	src := "start:\n    beq a0, a1, far\n    blt a0, a1, near\nnear:\n" +
+		strings.Repeat("    addi a0, a0, 1\n", 1100) +
+		"far:\n    bgeu t0, t1, start\n"
+	f := assemble(t, "rv32i", src)
+	text, err := f.Section(".text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .text: %s", err.Error())
+	}
+
+	farAddr := uint32(12 + 1100*4)
+	if len(text) != int(farAddr)+8 {
+		t.Fatalf("test - .text size wrong. got=%d, expected=%d", len(text), farAddr+8)
+	}
+	expected := []struct {
+		off  uint32
+		insn uint32
+	}{
+		{0, 0x00b51463},           // bne a0, a1, 8
+		{farAddr, 0x0062e463},     // bltu t0, t1, 8
+		{farAddr + 4, 0xec1fe06f}, // jal zero, start (-4416)
+	}
+	for i, tt := range expected {
+		if insn := binary.LittleEndian.Uint32(text[tt.off:]); insn != tt.insn {
+			t.Errorf("test[%d] - encoding wrong. got=%#08x, expected=%#08x", i, insn, tt.insn)
+		}
+	}
+	expectSameRelocs(t, readRelocs(t, f), []relocEntry{
+		{4, elf.R_RISCV_JAL, "far"},
+		{8, elf.R_RISCV_BRANCH, "near"},
+		{farAddr + 4, elf.R_RISCV_JAL, "start"},
+	})
+}
+
+func TestBranchRelaxationNotes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.s")
+	src := "    beq a0, a1, far\n" + strings.Repeat("    addi a0, a0, 1\n", 1024) + "far:\n    bne a0, a1, far\n"
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatalf("test - failed to write source: %s", err.Error())
+	}
+	arch, _ := isa.Parse("rv32i")
+	stmts, err := parse.ParseFile(path, parse.NewOptions(arch))
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+	e, err := elf32.PrepareElf32Tables(stmts, arch, isa.DefaultABI(arch), 0)
+	if err != nil {
+		t.Fatalf("test - prepare failed:\n%q", err.Error())
+	}
+
+	// farは4100byte先なので最初の分岐だけ置き換わる
+	notes := e.ListingNotes()
+	if len(notes) != 1 {
+		t.Fatalf("test - listing notes wrong. got=%v", notes)
+	}
+	expected := "branch to `far' out of range, relaxed to inverted branch and jal"
+	if notes[0].Row != 1 || notes[0].Text != expected {
+		t.Errorf("test - listing note wrong. got=%d %q, expected=%d %q", notes[0].Row, notes[0].Text, 1, expected)
+	}
+}
+
+func TestEncodeCallTail(t *testing.T) {
+	// RVCが有効でもjalrは圧縮されない
+	src := `    call foo
+    tail foo
+`
+	for _, march := range []string{"rv32i", "rv32ic"} {
+		f := assemble(t, march, src)
+		text, err := f.Section(".text").Data()
+		if err != nil {
+			t.Fatalf("test - failed to read .text: %s", err.Error())
+		}
+		expected := []uint32{
+			0x00000097, // auipc ra, 0
+			0x000080e7, // jalr ra, 0(ra)
+			0x00000317, // auipc t1, 0
+			0x00030067, // jalr zero, 0(t1)
+		}
+		if len(text) != len(expected)*4 {
+			t.Fatalf("test - %s .text size wrong. got=%d, expected=%d", march, len(text), len(expected)*4)
+		}
+		for i, insn := range expected {
+			if actual := binary.LittleEndian.Uint32(text[i*4:]); actual != insn {
+				t.Errorf("test[%d] - %s encoding wrong. got=%#08x, expected=%#08x", i, march, actual, insn)
+			}
+		}
+		expectSameRelocs(t, readRelocs(t, f), []relocEntry{
+			{0, elf.R_RISCV_CALL_PLT, "foo"},
+			{0, elf.R_RISCV_RELAX, ""},
+			{8, elf.R_RISCV_CALL_PLT, "foo"},
+			{8, elf.R_RISCV_RELAX, ""},
+		})
+	}
+}
+
+func TestEncodePcrelPseudo(t *testing.T) {
+	f := assemble(t, "rv32i", `    lla a0, msg
+    lw a1, msg
+    sw a1, msg, t0
+msg:
+`)
+	text, err := f.Section(".text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .text: %s", err.Error())
+	}
+	// 即値はリンカが埋めるので0になる
+	expected := []uint32{
+		0x00000517, // auipc a0, 0
+		0x00050513, // addi a0, a0, 0
+		0x00000597, // auipc a1, 0
+		0x0005a583, // lw a1, 0(a1)
+		0x00000297, // auipc t0, 0
+		0x00b2a023, // sw a1, 0(t0)
+	}
+	if len(text) != len(expected)*4 {
+		t.Fatalf("test - .text size wrong. got=%d, expected=%d", len(text), len(expected)*4)
+	}
+	for i, insn := range expected {
+		if actual := binary.LittleEndian.Uint32(text[i*4:]); actual != insn {
+			t.Errorf("test[%d] - encoding wrong. got=%#08x, expected=%#08x", i, actual, insn)
+		}
+	}
+	// %pcrel_loの再配置はauipcの合成ラベルを指す
+	expectSameRelocs(t, readRelocs(t, f), []relocEntry{
+		{0, elf.R_RISCV_PCREL_HI20, "msg"},
+		{0, elf.R_RISCV_RELAX, ""},
+		{4, elf.R_RISCV_PCREL_LO12_I, ".Lpcrel_hi0"},
+		{4, elf.R_RISCV_RELAX, ""},
+		{8, elf.R_RISCV_PCREL_HI20, "msg"},
+		{8, elf.R_RISCV_RELAX, ""},
+		{12, elf.R_RISCV_PCREL_LO12_I, ".Lpcrel_hi1"},
+		{12, elf.R_RISCV_RELAX, ""},
+		{16, elf.R_RISCV_PCREL_HI20, "msg"},
+		{16, elf.R_RISCV_RELAX, ""},
+		{20, elf.R_RISCV_PCREL_LO12_S, ".Lpcrel_hi2"},
+		{20, elf.R_RISCV_RELAX, ""},
+	})
+
+	// 合成ラベルはauipcの位置に置かれる
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatalf("test - failed to read symbols: %s", err.Error())
+	}
+	for _, sym := range syms {
+		if strings.HasPrefix(sym.Name, ".Lpcrel_hi") && sym.Value != uint64(sym.Name[len(sym.Name)-1]-'0')*8 {
+			t.Errorf("test - %s value wrong. got=%d", sym.Name, sym.Value)
+		}
+	}
+}
+
+// .symtabはローカルシンボルを先に並べ、sh_infoは最初のグローバルシンボルのインデックスになる
+// 疑似命令の展開で後から追加した合成ラベルもグローバルシンボルより前に置く
+func TestSymtabLocalsFirst(t *testing.T) {
+	f := assemble(t, "rv32i", `    .globl main
+main:
+    call puts
+    la.tls.ie a1, ie
+    lla a0, msg
+msg:
+`)
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatalf("test - failed to read symbols: %s", err.Error())
+	}
+	// f.Symbols()はindex0の空シンボルを含まない
+	info := int(f.Section(".symtab").Info)
+	for i, sym := range syms {
+		local := elf.ST_BIND(sym.Info) == elf.STB_LOCAL
+		if local != (i+1 < info) {
+			t.Errorf("test - symbol %s at %d is on the wrong side of sh_info %d", sym.Name, i+1, info)
+		}
+	}
+	if expected := 4; info != expected {
+		t.Errorf("test - .symtab sh_info wrong. got=%d, expected=%d", info, expected)
+	}
+
+	// 再配置は並べ替えた後のインデックスでシンボルを指す
+	expectSameRelocs(t, readRelocs(t, f), []relocEntry{
+		{0, elf.R_RISCV_CALL_PLT, "puts"},
+		{0, elf.R_RISCV_RELAX, ""},
+		{8, elf.R_RISCV_TLS_GOT_HI20, "ie"},
+		{12, elf.R_RISCV_PCREL_LO12_I, ".Lpcrel_hi0"},
+		{16, elf.R_RISCV_PCREL_HI20, "msg"},
+		{16, elf.R_RISCV_RELAX, ""},
+		{20, elf.R_RISCV_PCREL_LO12_I, ".Lpcrel_hi1"},
+		{20, elf.R_RISCV_RELAX, ""},
+	})
+}
+
+// 同じセクションのラベルへの分岐、ジャンプには命令の位置からの距離を置く
+// 再配置も残すので、リンカが命令を縮めても距離は直される
+func TestEncodeBranchOffsets(t *testing.T) {
+	text := assembleText(t, "rv32i", `start:
+    addi a0, a0, 1
+    jal zero, far
+    beq a0, a1, start
+    .zero 256
+far:
+    bne a0, zero, start
+    jal ra, ext
+    jal ra, data
+    .data
+data:
+    .word 1
+`)
+	expected := map[int]uint32{
+		4:     0x1080006f, // jal zero, +264
+		8:     0xfeb50ce3, // beq a0, a1, -8
+		0x10c: 0xee051ae3, // bne a0, zero, -268
+		0x110: 0x000000ef, // 未定義のシンボルはリンカが埋める
+		0x114: 0x000000ef, // 別のセクションのシンボルまでの距離もリンカが埋める
+	}
+	for off, insn := range expected {
+		if actual := binary.LittleEndian.Uint32(text[off:]); actual != insn {
+			t.Errorf("test[%#x] - encoding wrong. got=%#08x, expected=%#08x", off, actual, insn)
+		}
+	}
+
+	text = assembleText(t, "rv32ic", `start:
+    c.addi a0, 1
+    c.j far
+    c.beqz a0, start
+far:
+    c.bnez a0, start
+`)
+	expected = map[int]uint32{
+		2: 0xa011, // c.j +4
+		4: 0xdd75, // c.beqz a0, -4
+		6: 0xfd6d, // c.bnez a0, -6
+	}
+	for off, insn := range expected {
+		if actual := binary.LittleEndian.Uint16(text[off:]); uint32(actual) != insn {
+			t.Errorf("test[%#x] - rvc encoding wrong. got=%#04x, expected=%#04x", off, actual, insn)
+		}
+	}
+}
+
+func TestLabelDiff(t *testing.T) {
+	src := `start:
+    call foo
+end:
+    .word end - start
+    .half end-start
+    .option norelax
+    .byte end - start
+`
+	f := assemble(t, "rv32i", src)
+	text, err := f.Section(".text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .text: %s", err.Error())
+	}
+	// 緩和が有効な間はリンカが計算するので0を置く
+	if data := text[8:]; binary.LittleEndian.Uint32(data) != 0 || binary.LittleEndian.Uint16(data[4:]) != 0 || data[6] != 8 {
+		t.Fatalf("test - data wrong. got=%v", data)
+	}
+	expectSameRelocs(t, readRelocs(t, f), []relocEntry{
+		{0, elf.R_RISCV_CALL_PLT, "foo"},
+		{0, elf.R_RISCV_RELAX, ""},
+		{8, elf.R_RISCV_ADD32, "end"},
+		{8, elf.R_RISCV_SUB32, "start"},
+		{12, elf.R_RISCV_ADD16, "end"},
+		{12, elf.R_RISCV_SUB16, "start"},
+	})
+}
+
+func TestLabelDiffFolded(t *testing.T) {
+	// 緩和のないセクションのラベルの差は畳み込む
+	f := assemble(t, "rv32i", `    .data
+x:  .word 1
+y:  .word y - x
+`)
+	data, err := f.Section(".data").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .data: %s", err.Error())
+	}
+	if diff := binary.LittleEndian.Uint32(data[4:]); diff != 4 {
+		t.Fatalf("test - label difference wrong. got=%d, expected=4", diff)
+	}
+}
+
+func TestLabelDiffError(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"x:\n    .word x - foo\n", "2: Error: can't resolve `x' {.text section} - `foo' {*UND* section}\n"},
+		{"x:\n    addi a0, a0, 1\n    .data\ny:  .word y - x\n", "4: Error: can't resolve `y' {.data section} - `x' {.text section}\n"},
+		{"x:\n    addi a0, a0, 1\ny:\n    .bss\n    .word y - x\n", "5: Error: can't resolve `y' - `x' in section `.bss' with relaxation enabled\n"},
+	}
+
+	for i, tt := range tests {
+		path := filepath.Join(t.TempDir(), "test.s")
+		if err := os.WriteFile(path, []byte(tt.src), 0644); err != nil {
+			t.Fatalf("test - failed to write source: %s", err.Error())
+		}
+		arch := isa.Default()
+		stmts, err := parse.ParseFile(path, parse.NewOptions(arch))
+		if err != nil {
+			t.Fatalf("test[%d] - parse failed:\n%q", i, err.Error())
+		}
+		_, err = elf32.PrepareElf32Tables(stmts, arch, isa.DefaultABI(arch), 0)
+		if err == nil {
+			t.Fatalf("test[%d] - expected error, but got nil", i)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("test[%d] - error message wrong. got=%q, expected=%q", i, err.Error(), tt.expected)
+		}
+	}
+}
+
+func TestEquFolded(t *testing.T) {
+	// .equの値は命令に畳み込み、PC相対の参照だけ再配置を残す
+	f := assemble(t, "rv32i", `    .globl G
+    .equ G, 0x7ffff800
+    .equ N, 100
+    addi a0, a0, N
+    lui a1, %hi(G)
+    addi a1, a1, %lo(G)
+    sw a0, %lo(G)(a1)
+    lui a2, N
+.L0:
+    auipc a3, %pcrel_hi(N)
+`)
+	expectSameRelocs(t, readRelocs(t, f), []relocEntry{
+		{20, elf.R_RISCV_PCREL_HI20, "N"},
+		{20, elf.R_RISCV_RELAX, ""},
+	})
+
+	text, err := f.Section(".text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .text: %s", err.Error())
+	}
+	expected := []uint32{
+		0x06450513, // addi a0, a0, 100
+		0x800005b7, // lui a1, 0x80000
+		0x80058593, // addi a1, a1, -2048
+		0x80a5a023, // sw a0, -2048(a1)
+		0x00064637, // lui a2, 100
+	}
+	for i, insn := range expected {
+		if got := binary.LittleEndian.Uint32(text[i*4:]); got != insn {
+			t.Errorf("test[%d] - encoding wrong. got=%#08x, expected=%#08x", i, got, insn)
+		}
+	}
+
+	syms, _ := f.Symbols()
+	for _, sym := range syms {
+		if sym.Name == "G" && sym.Section != elf.SHN_ABS {
+			t.Errorf("test - G section wrong. got=%v, expected=SHN_ABS", sym.Section)
+		}
+	}
+}
+
+func TestEquOutOfRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.s")
+	if err := os.WriteFile(path, []byte("    .equ N, 2048\n    addi a0, a0, N\n"), 0644); err != nil {
+		t.Fatalf("test - failed to write source: %s", err.Error())
+	}
+	arch := isa.Default()
+	stmts, err := parse.ParseFile(path, parse.NewOptions(arch))
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+	_, err = elf32.PrepareElf32Tables(stmts, arch, isa.DefaultABI(arch), 0)
+	if err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	}
+	expected := "2: Error: illegal operands: immediate 2048 out of range\n"
+	if err.Error() != expected {
+		t.Errorf("test - error message wrong. got=%q, expected=%q", err.Error(), expected)
+	}
+}
+
+func TestRelocDirective(t *testing.T) {
+	f := assemble(t, "rv32i", `start:
+    addi a0, a0, 1
+    .reloc ., R_RISCV_NONE, foo
+    addi a0, a0, 2
+    .reloc start+4, 56, tbl+8
+    .reloc 0, R_RISCV_32_PCREL, bar-4
+    .reloc 8, R_RISCV_RELAX
+`)
+	// エントリはオフセット順に並ぶ
+	expectSameRelocs(t, readRelocs(t, f), []relocEntry{
+		{0, elf.R_RISCV_32_PCREL, "bar"},
+		{4, elf.R_RISCV_NONE, "foo"},
+		{4, elf.R_RISCV_SET32, "tbl"},
+		{8, elf.R_RISCV_RELAX, ""},
+	})
+
+	rels, err := f.Section(".rela.text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .rela.text: %s", err.Error())
+	}
+	addends := []int32{-4, 0, 8, 0}
+	for i, addend := range addends {
+		if actual := int32(binary.LittleEndian.Uint32(rels[i*12+8:])); actual != addend {
+			t.Errorf("test[%d] - addend wrong. got=%d, expected=%d", i, actual, addend)
+		}
+	}
+}
+
+func TestRelocDirectiveError(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"    addi a0, a0, 1\n    .reloc 8, R_RISCV_NONE\n", "2: Error: .reloc offset 8 is outside section `.text'\n"},
+		{"    .reloc .-4, R_RISCV_NONE\n", "1: Error: .reloc offset -4 is outside section `.text'\n"},
+		{"    .reloc foo, R_RISCV_NONE\n", "1: Error: .reloc offset `foo' is not in section `.text'\n"},
+		{"    .reloc 0, R_RISCV_FOO\n", "1: Error: unknown relocation type `R_RISCV_FOO'\n"},
+		{"    .reloc 0, 256\n", "1: Error: unknown relocation type `256'\n"},
+	}
+
+	for i, tt := range tests {
+		path := filepath.Join(t.TempDir(), "test.s")
+		if err := os.WriteFile(path, []byte(tt.src), 0644); err != nil {
+			t.Fatalf("test - failed to write source: %s", err.Error())
+		}
+		arch := isa.Default()
+		stmts, err := parse.ParseFile(path, parse.NewOptions(arch))
+		if err != nil {
+			t.Fatalf("test[%d] - parse failed:\n%q", i, err.Error())
+		}
+		_, err = elf32.PrepareElf32Tables(stmts, arch, isa.DefaultABI(arch), 0)
+		if err == nil {
+			t.Fatalf("test[%d] - expected error, but got nil", i)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("test[%d] - error message wrong. got=%q, expected=%q", i, err.Error(), tt.expected)
+		}
+	}
+}
+
+func TestCollectErrors(t *testing.T) {
+	src := "x:\n    addi a0, a0, 1\n    .data\n  x:\n    .reloc 0, R_FOO\n    .bss\n    addi a0, a0, 1\n"
+	path := filepath.Join(t.TempDir(), "test.s")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatalf("test - failed to write source: %s", err.Error())
+	}
+	arch := isa.Default()
+	stmts, err := parse.ParseFile(path, parse.NewOptions(arch))
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+	_, err = elf32.PrepareElf32Tables(stmts, arch, isa.DefaultABI(arch), 0)
+	if err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	}
+
+	// 最初のエラーで止まらず、全てのエラーを報告する
+	expected := "4: Error: symbol `\"x\"' is already defined\n" +
+		"7: Error: unknown pseudo-op:addi\n" +
+		"5: Error: unknown relocation type `R_FOO'\n"
+	if err.Error() != expected {
+		t.Errorf("test - error message wrong. got=%q, expected=%q", err.Error(), expected)
+	}
+
+	var elfErr *elf32.Error
+	if !errors.As(err, &elfErr) {
+		t.Fatalf("test - error is not an *elf32.Error: %T", err)
+	}
+	var diags diag.List
+	if !errors.As(err, &diags) || len(diags) != 3 {
+		t.Fatalf("test - errors.As(diag.List) wrong. got=%v", diags)
+	}
+	// 重複したラベルは列と最初の定義の位置を持つ
+	dup := diags[0]
+	if dup.File != path || dup.Line != 4 || dup.Column != 3 {
+		t.Errorf("test - position wrong. got=%s:%d:%d", dup.File, dup.Line, dup.Column)
+	}
+	note := "`x' was first defined at " + path + ":1"
+	if len(dup.Notes) != 1 || dup.Notes[0] != note {
+		t.Errorf("test - notes wrong. got=%q, expected=%q", dup.Notes, note)
+	}
+	if diags[2].Column != 5 {
+		t.Errorf("test - column wrong. got=%d, expected=5", diags[2].Column)
+	}
+}
+
+func TestRelocationSections(t *testing.T) {
+	f := assemble(t, "rv32i", `x:
+    call foo
+y:
+    .data
+    .word 1
+    .word y - x
+    .reloc 0, R_RISCV_SET32, tbl
+    .2byte y - x
+`)
+
+	sections := []struct {
+		name   string
+		target string
+	}{
+		{".rela.text", ".text"},
+		{".rela.data", ".data"},
+	}
+	symtab := f.Section(".symtab")
+	for i, tt := range sections {
+		sec := f.Section(tt.name)
+		if sec == nil {
+			t.Fatalf("test[%d] - section %s is missing", i, tt.name)
+		}
+		// .rela.textにSHF_ALLOCやSHF_EXECINSTRは付けない
+		if sec.Type != elf.SHT_RELA || sec.Flags != elf.SHF_INFO_LINK || sec.Entsize != 12 {
+			t.Errorf("test[%d] - %s header wrong. got=%v %v %d", i, tt.name, sec.Type, sec.Flags, sec.Entsize)
+		}
+		if f.Sections[sec.Link] != symtab || f.Sections[sec.Info] != f.Section(tt.target) {
+			t.Errorf("test[%d] - %s link/info wrong. got=%d %d", i, tt.name, sec.Link, sec.Info)
+		}
+	}
+
+	expectSameRelocs(t, readSectionRelocs(t, f, ".rela.data"), []relocEntry{
+		{0, elf.R_RISCV_SET32, "tbl"},
+		{4, elf.R_RISCV_ADD32, "y"},
+		{4, elf.R_RISCV_SUB32, "x"},
+		{8, elf.R_RISCV_ADD16, "y"},
+		{8, elf.R_RISCV_SUB16, "x"},
+	})
+	data, err := f.Section(".data").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .data: %s", err.Error())
+	}
+	// 再配置で求める値はリンカが埋める
+	if expected := []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0}; string(data) != string(expected) {
+		t.Errorf("test - .data wrong. got=%v, expected=%v", data, expected)
+	}
+}
+
+func TestSectionLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.s")
+	// .strtab, .shstrtabの長さで後ろのセクションが奇数のオフセットになるようにする
+	src := `    .globl a
+a:  addi a0, a0, 1
+    .data
+    .byte 1
+    .section .tbss,"awT",@nobits
+t:  .zero 16
+    .section .rodata
+    .word a - a
+`
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatalf("test - failed to write source: %s", err.Error())
+	}
+	arch := isa.Default()
+	stmts, err := parse.ParseFile(path, parse.NewOptions(arch))
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+	e, err := elf32.PrepareElf32Tables(stmts, arch, isa.DefaultABI(arch), 0)
+	if err != nil {
+		t.Fatalf("test - prepare failed:\n%q", err.Error())
+	}
+	t.Chdir(filepath.Dir(path))
+	if err := e.WriteToFile("output.o"); err != nil {
+		t.Fatalf("test - write failed:\n%q", err.Error())
+	}
+	raw, err := os.ReadFile("output.o")
+	if err != nil {
+		t.Fatalf("test - failed to read output: %s", err.Error())
+	}
+	f, err := elf.Open("output.o")
+	if err != nil {
+		t.Fatalf("test - output is not a valid ELF file: %s", err.Error())
+	}
+	defer f.Close()
+
+	shoff := binary.LittleEndian.Uint32(raw[0x20:])
+	if shoff%4 != 0 || int(shoff)+len(f.Sections)*40 != len(raw) {
+		t.Errorf("test - section header table offset wrong. got=%#x, file size=%#x", shoff, len(raw))
+	}
+
+	// ヘッダーの並び順に、重ならずアラインメントを満たして置かれている
+	end := uint64(0x34)
+	for i, sec := range f.Sections[1:] {
+		if sec.Addralign > 1 && sec.Offset%sec.Addralign != 0 {
+			t.Errorf("test[%d] - %s offset %#x is not aligned to %d", i, sec.Name, sec.Offset, sec.Addralign)
+		}
+		if sec.Offset < end {
+			t.Errorf("test[%d] - %s offset %#x overlaps the previous section ending at %#x", i, sec.Name, sec.Offset, end)
+		}
+		end = sec.Offset
+		// SHT_NOBITSのセクションはファイル上に場所をとらない
+		if sec.Type != elf.SHT_NOBITS {
+			end += sec.Size
+		}
+	}
+	if tbss := f.Section(".tbss"); tbss.Size != 16 {
+		t.Errorf("test - .tbss size wrong. got=%d, expected=16", tbss.Size)
+	}
+}
+
+// .riscv.attributesの各サブセクションの長さが実際のバイト数と一致しているか見る
+func expectValidAttributes(t *testing.T, attr []byte) {
+	if attr[0] != 'A' {
+		t.Fatalf("test - format version wrong. got=%q", attr[0])
+	}
+	vendorLen := binary.LittleEndian.Uint32(attr[1:])
+	if int(vendorLen) != len(attr)-1 {
+		t.Fatalf("test - vendor subsection length wrong. got=%d, expected=%d", vendorLen, len(attr)-1)
+	}
+	// "riscv\0" の後に Tag_file(1byte) と長さが続く
+	sub := attr[1+4+len("riscv\x00"):]
+	if sub[0] != 1 {
+		t.Fatalf("test - Tag_file wrong. got=%d", sub[0])
+	}
+	if subLen := binary.LittleEndian.Uint32(sub[1:]); int(subLen) != len(sub) {
+		t.Fatalf("test - sub-subsection length wrong. got=%d, expected=%d", subLen, len(sub))
+	}
+}
+
+func TestAttributeDirective(t *testing.T) {
+	f := assemble(t, "rv32i", `    .attribute arch, "rv32imac"
+    .attribute stack_align, 4
+    .attribute 6, 1
+    .attribute priv_spec, 1
+    .attribute Tag_RISCV_atomic_abi, 300
+    addi a0, a0, 1
+`)
+	attr, err := f.Section(".riscv.attributes").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .riscv.attributes: %s", err.Error())
+	}
+	expectValidAttributes(t, attr)
+
+	// タグの順に並び、ULEB128は必要なバイト数だけ使う
+	expected := "\x04\x04" +
+		"\x05rv32i2p1_m2p0_a2p1_c2p0_zmmul1p0\x00" +
+		"\x06\x01" +
+		"\x08\x01" +
+		"\x0e\xac\x02" +
+		"\x10\x00"
+	body := string(attr[1+4+len("riscv\x00")+1+4:])
+	if body != expected {
+		t.Fatalf("test - attributes wrong.\ngot=%q\nexpected=%q", body, expected)
+	}
+}
+
+func TestRV32EAttributes(t *testing.T) {
+	f := assemble(t, "rv32e", "    add a5, a0, a1\n")
+	attr, err := f.Section(".riscv.attributes").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .riscv.attributes: %s", err.Error())
+	}
+	expectValidAttributes(t, attr)
+	// ilp32eのスタックアラインメントは4byte
+	if !strings.Contains(string(attr), "\x04\x04\x05rv32e2p0\x00") {
+		t.Fatalf("test - attributes wrong. got=%q", attr)
+	}
+}
+
+func TestEncodeInsn(t *testing.T) {
+	// 同じ命令を命令名で書いた場合と同じエンコードになる
+	tests := []encodeTestStruct{
+		{".insn r OP, 0, 0, a0, a1, a2", 0x00c58533},        // add a0, a1, a2
+		{".insn r 0x33, 0, 0x20, a0, a1, a2", 0x40c58533},   // sub a0, a1, a2
+		{".insn r CUSTOM_0, 1, 2, a0, a1, a2", 0x04c5950b},  // custom-0
+		{".insn r4 MADD, 0, 1, a0, a1, a2, a3", 0x6ac58543}, // fmadd.d a0, a1, a2, a3, rne
+		{".insn i OP_IMM, 0, a0, a1, 13", 0x00d58513},       // addi a0, a1, 13
+		{".insn i LOAD, 2, a0, 4(a1)", 0x0045a503},          // lw a0, 4(a1)
+		{".insn i CUSTOM_1, 3, a0, a1, -1", 0xfff5b52b},     // custom-1
+		{".insn s STORE, 2, a0, 8(a1)", 0x00a5a423},         // sw a0, 8(a1)
+		{".insn b BRANCH, 0, a0, a1, 16", 0x00b50863},       // beq a0, a1, 16
+		{".insn u LUI, a0, 0x12345", 0x12345537},            // lui a0, 0x12345
+		{".insn j JAL, ra, 2048", 0x001000ef},               // jal ra, 2048
+		{".insn 0x00000013", 0x00000013},                    // nop
+		{".insn 4, 0x12345677", 0x12345677},                 // 値の直接指定
+	}
+
+	expectSameEncoding(t, "rv32i", tests)
+}
+
+func TestEncodeCompressedInsn(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected uint16
+	}{
+		{".insn cr C2, 9, a0, a1", 0x952e},     // c.add a0, a1
+		{".insn ci C1, 0, a0, -3", 0x1575},     // c.addi a0, -3
+		{".insn ciw C0, 0, a0, 200", 0x1908},   // uimm[7:0]はbits[12:5]
+		{".insn css C2, 6, a0, 60", 0xde2a},    // uimm[5:0]はbits[12:7]
+		{".insn cl C0, 2, a0, 13(a1)", 0x4da8}, // uimm[4:2]はbits[12:10]、uimm[1:0]はbits[6:5]
+		{".insn cs C0, 6, a0, 21(a1)", 0xd5a8},
+		{".insn ca C1, 0x23, 3, a0, a1", 0x8d6d}, // c.and a0, a1
+		{".insn cb C1, 6, a0, 16", 0xc901},       // c.beqz a0, 16
+		{".insn cj C1, 5, 32", 0xa005},           // c.j 32
+		{".insn 2, 0x4505", 0x4505},              // c.li a0, 1
+	}
+
+	var lines []string
+	for _, tt := range tests {
+		lines = append(lines, tt.src)
+	}
+	text := assembleText(t, "rv32ic", strings.Join(lines, "\n")+"\n")
+	if len(text) != len(tests)*2 {
+		t.Fatalf("test - .text size wrong. got=%d, expected=%d", len(text), len(tests)*2)
+	}
+	for i, tt := range tests {
+		if actual := binary.LittleEndian.Uint16(text[i*2:]); actual != tt.expected {
+			t.Errorf("test[%d] - %q encoding wrong. got=%#04x, expected=%#04x", i, tt.src, actual, tt.expected)
+		}
+	}
+}
+
+// CUSTOM_0を使うベンダー拡張
+var xcustom = parse.Extension{
+	Name: "xcustom",
+	Instructions: map[string]parse.InstructionSpec{
+		"cust.add":  {Format: parse.RType, Syntax: "rd, rs1, rs2", Fields: parse.Fields{Opcode: 0b0001011}},
+		"cust.addi": {Format: parse.IType, Syntax: "rd, rs1, imm", Fields: parse.Fields{Opcode: 0b0001011, Funct3: 0b001}, Reloc: "%lo"},
+	},
+}
+
+func TestEncodeRegisteredExtension(t *testing.T) {
+	if err := parse.RegisterExtension(xcustom); err != nil {
+		t.Fatalf("test - register failed:\n%q", err.Error())
+	}
+	f := assemble(t, "rv32i_xcustom", `    cust.add a0, a1, a2
+    cust.addi a0, a0, foo
+`)
+	text, err := f.Section(".text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .text: %s", err.Error())
+	}
+	for i, expected := range []uint32{0x00c5850b, 0x0005150b} {
+		if actual := binary.LittleEndian.Uint32(text[i*4:]); actual != expected {
+			t.Errorf("test[%d] - encoding wrong. got=%#08x, expected=%#08x", i, actual, expected)
+		}
+	}
+
+	// 命令の定義で指定した再配置が使われる
+	relocs, err := f.Section(".rela.text").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .rela.text: %s", err.Error())
+	}
+	if typ := elf.R_RISCV(binary.LittleEndian.Uint32(relocs[4:]) & 0xff); typ != elf.R_RISCV_LO12_I {
+		t.Fatalf("test - relocation type wrong. got=%s, expected=%s", typ, elf.R_RISCV_LO12_I)
+	}
+
+	attr, err := f.Section(".riscv.attributes").Data()
+	if err != nil {
+		t.Fatalf("test - failed to read .riscv.attributes: %s", err.Error())
+	}
+	expectValidAttributes(t, attr)
+	if !strings.Contains(string(attr), "rv32i2p1_xcustom1p0\x00") {
+		t.Fatalf("test - arch attribute wrong. got=%q", attr)
+	}
+}
+
+// 命令の定義からエンコードした命令は、同じ定義から逆アセンブルすると元に戻る
+func TestEncodeDisassembleRoundTrip(t *testing.T) {
+	src := []string{
+		"sub a0, a1, a2",
+		"slli t0, t1, 31",
+		"srai a0, a1, 5",
+		"lbu s1, -2048(sp)",
+		"sh a5, 2047(gp)",
+		"bgeu a0, a1, -8",
+		"auipc t0, 0xfffff",
+		"jalr zero, ra, 0",
+		"fence iorw, ow",
+		"fence.i",
+		"ecall",
+		"csrwi mscratch, 31",
+		"mret",
+		"bseti a0, a0, 31",
+		"rev8 a0, a1",
+		"sm4ks a0, a1, a2, 2",
+	}
+	text := assembleText(t, "rv32i_zicsr_zifencei_zbb_zbs_zksed", strings.Join(src, "\n")+"\n")
+	for i, line := range src {
+		actual, ok := parse.Disassemble(binary.LittleEndian.Uint32(text[i*4:]))
+		if !ok || actual != line {
+			t.Errorf("test[%d] - disassembled wrong. got=%q, expected=%q", i, actual, line)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// isa/isa_test.go
+
+package isatest
+
+import (
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/isa"
+)
+
+func TestParseArch(t *testing.T) {
+	tests := []struct {
+		march    string
+		expected string
+	}{
+		{"rv32i", "rv32i2p1"},
+		{"rv32ic", "rv32i2p1_c2p0"},
+		{"rv32i_zbs_zba", "rv32i2p1_zba1p0_zbs1p0"},
+		{"rv32ic_zbb_zbc", "rv32i2p1_c2p0_zbb1p0_zbc1p0"},
+		{"rv32i_zknh_zbkb_zbs", "rv32i2p1_zbkb1p0_zbs1p0_zknh1p0"},
+		{"rv32iv", "rv32i2p1_f2p2_d2p2_v1p0_zicsr2p0_zve32f1p0_zve32x1p0_zve64d1p0_zve64f1p0_zve64x1p0_zvl128b1p0_zvl32b1p0_zvl64b1p0"},
+		{"rv32i_zve32x", "rv32i2p1_zicsr2p0_zve32x1p0_zvl32b1p0"},
+		{"rv32imac_zicsr_zifencei", "rv32i2p1_m2p0_a2p1_c2p0_zicsr2p0_zifencei2p0_zmmul1p0"},
+		{"rv32gc", "rv32i2p1_m2p0_a2p1_f2p2_d2p2_c2p0_zicsr2p0_zifencei2p0_zmmul1p0"},
+		{"rv32i2p0m2_zicsr2p0", "rv32i2p0_m2p0_zicsr2p0_zmmul1p0"},
+		{"rv32ec", "rv32e2p0_c2p0"},
+		{"rv32i_zks", "rv32i2p1_zbkb1p0_zbkc1p0_zbkx1p0_zks1p0_zksed1p0_zksh1p0"},
+	}
+
+	for i, tt := range tests {
+		arch, err := isa.Parse(tt.march)
+		if err != nil {
+			t.Fatalf("test[%d] - parse failed:\n%q", i, err.Error())
+		}
+		if arch.String() != tt.expected {
+			t.Fatalf("test[%d] - arch string wrong. got=%q, expected=%q", i, arch.String(), tt.expected)
+		}
+	}
+}
+
+func TestParseArchError(t *testing.T) {
+	for _, march := range []string{"rv64i", "rv32c", "rv32i_zbx", "rv32ica", "rv32imm", "rv32ie", "rv32i2x1"} {
+		if _, err := isa.Parse(march); err == nil {
+			t.Fatalf("test - parse have to be fail: %s", march)
+		}
+	}
+}
+
+func TestParseABI(t *testing.T) {
+	tests := []struct {
+		march    string
+		mabi     string
+		expected string
+	}{
+		{"rv32i", "", "ilp32"},
+		{"rv32imafc", "", "ilp32f"},
+		{"rv32gc", "", "ilp32d"},
+		{"rv32gc", "ilp32", "ilp32"},
+		{"rv32e", "", "ilp32e"},
+	}
+
+	for i, tt := range tests {
+		arch, err := isa.Parse(tt.march)
+		if err != nil {
+			t.Fatalf("test[%d] - parse failed:\n%q", i, err.Error())
+		}
+		abi := isa.DefaultABI(arch)
+		if tt.mabi != "" {
+			if abi, err = isa.ParseABI(tt.mabi, arch); err != nil {
+				t.Fatalf("test[%d] - parse abi failed:\n%q", i, err.Error())
+			}
+		}
+		if abi.Name() != tt.expected {
+			t.Fatalf("test[%d] - abi wrong. got=%q, expected=%q", i, abi.Name(), tt.expected)
+		}
+	}
+}
+
+func TestParseABIError(t *testing.T) {
+	tests := []struct {
+		march    string
+		mabi     string
+		expected string
+	}{
+		{"rv32i", "lp64", "-mabi=lp64: unknown ABI"},
+		{"rv32imaf", "ilp32d", "-mabi=ilp32d: ABI requires the `d' extension"},
+		{"rv32e", "ilp32", "-mabi=ilp32: rv32e requires the ilp32e ABI"},
+	}
+
+	for i, tt := range tests {
+		arch, err := isa.Parse(tt.march)
+		if err != nil {
+			t.Fatalf("test[%d] - parse failed:\n%q", i, err.Error())
+		}
+		_, err = isa.ParseABI(tt.mabi, arch)
+		if err == nil || err.Error() != tt.expected {
+			t.Fatalf("test[%d] - error wrong. got=%v, expected=%q", i, err, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// parse/bitmanip_parser_test.go
+
+package parsetest
+
+import (
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+func TestParseBitmanipOperation(t *testing.T) {
+	stmts, err := parseTestFileWithArch(t, "rv32i_zbb", "    sext.b a0, a1\n")
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	tests := []parseOperationTestStruct{
+		{
+			expectedOpcType: parse.UnaryType,
+			expectedVal:     "sext.b",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "a0",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "a1",
+			expectedRow:     1,
+		},
+	}
+
+	expectSameOperation(t, stmts[0], tests)
+}
+
+/*
+=====================================
+=========== Error Test ==============
+=====================================
+*/
+
+func TestParseBitmanipError1(t *testing.T) {
+	// -marchで有効にしていない拡張の命令は使えない
+	_, err := parseTestFileWithArch(t, "rv32i_zba", "    andn a0, a1, a2\n")
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectFileErrorMessage(t, err.Error(), "unrecognized opcode `andn', extension `zbb' or `zbkb' required")
+}
+
+func TestParseBitmanipError2(t *testing.T) {
+	_, err := parseTestFileWithArch(t, "rv32i_zbs", "    bseti a0, a1, 32\n")
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectFileErrorMessage(t, err.Error(), "improper shift amount (32)")
+}
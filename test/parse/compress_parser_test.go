@@ -0,0 +1,169 @@
+// parse/compress_parser_test.go
+
+package parsetest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/isa"
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+func TestParseCompressedOperation1(t *testing.T) {
+	input := []rune("    c.lw a0, 4(a1)")
+	stmt, err := parse.ParseLine(input, 1)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	tests := []parseOperationTestStruct{
+		{
+			expectedOpcType: parse.CLType,
+			expectedVal:     "c.lw",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.CREG,
+			expectedVal:     "a0",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.IMM,
+			expectedVal:     "4",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.CREG,
+			expectedVal:     "a1",
+			expectedRow:     1,
+		},
+	}
+
+	expectSameOperation(t, stmt, tests)
+	expectSameSize(t, stmt.Op().Size(), 2)
+}
+
+func TestParseCompressedOperation2(t *testing.T) {
+	input := []rune("    c.addi16sp sp, -32")
+	stmt, err := parse.ParseLine(input, 1)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	tests := []parseOperationTestStruct{
+		{
+			expectedOpcType: parse.CIType,
+			expectedVal:     "c.addi16sp",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "sp",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.IMM,
+			expectedVal:     "-32",
+			expectedRow:     1,
+		},
+	}
+
+	expectSameOperation(t, stmt, tests)
+}
+
+// -march=marchでソースをファイルとして解析する
+func parseTestFileWithArch(t *testing.T, march, src string) ([]parse.Stmt, error) {
+	path := filepath.Join(t.TempDir(), "test.s")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatalf("test - failed to write source: %s", err.Error())
+	}
+	arch, err := isa.Parse(march)
+	if err != nil {
+		t.Fatalf("test - invalid -march:\n%q", err.Error())
+	}
+	return parse.ParseFile(path, parse.NewOptions(arch))
+}
+
+// ParseFileのエラーは"ファイル名:行: Error: メッセージ"の形式になる
+func expectFileErrorMessage(t *testing.T, actual, expect string) {
+	if !strings.HasSuffix(actual, ": Error: "+expect) {
+		t.Fatalf("test - error msg is different from expected.\nactual: %q\nexpected: %q", actual, expect)
+	}
+}
+
+func parseTestFile(t *testing.T, src string) []parse.Stmt {
+	stmts, err := parseTestFileWithArch(t, "rv32i", src)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+	return stmts
+}
+
+func TestParseCompressAutomatically(t *testing.T) {
+	stmts := parseTestFile(t, `    .option rvc
+    addi sp, sp, -16
+    sw ra, 12(sp)
+    addi a0, x0, 1
+    add a0, a0, a1
+    lw a0, 4(a1)
+    jalr x0, ra, 0
+    addi a0, a1, 2000
+    .option norvc
+    addi sp, sp, 16
+`)
+
+	expected := []string{"", "c.addi16sp", "c.swsp", "c.li", "c.add", "c.lw", "c.jr", "addi", "", "addi"}
+	expectSameSize(t, len(stmts), len(expected))
+	for i, want := range expected {
+		if want == "" {
+			continue
+		}
+		if stmts[i].Op().Opecode() != want {
+			t.Fatalf("test[%d] - opecode wrong. got=%q, expected=%q", i, stmts[i].Op().Opecode(), want)
+		}
+	}
+	if !stmts[1].Opts().RVC() || stmts[9].Opts().RVC() {
+		t.Fatalf("test - .option rvc/norvc is not recorded to statements")
+	}
+}
+
+/*
+=====================================
+=========== Error Test ==============
+=====================================
+*/
+
+func TestParseCompressedOperationError1(t *testing.T) {
+	// c.lwはx8-x15しか指定できない
+	input := []rune("c.lw ra, 4(a1)")
+	_, err := parse.ParseLine(input, 1)
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectErrorMessage(t, err.Error(), OperandErr)
+}
+
+func TestParseCompressedOperationError2(t *testing.T) {
+	// c.addi16spの即値は16の倍数
+	input := []rune("c.addi16sp sp, 24")
+	_, err := parse.ParseLine(input, 1)
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectErrorMessage(t, err.Error(), OperandErr)
+}
+
+func TestParseCompressedOperationError3(t *testing.T) {
+	input := []rune("c.addi a0, 32")
+	_, err := parse.ParseLine(input, 1)
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectErrorMessage(t, err.Error(), OperandErr)
+}
@@ -0,0 +1,98 @@
+// parse/crypto_parser_test.go
+
+package parsetest
+
+import (
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+func TestParseCryptoOperation(t *testing.T) {
+	stmts, err := parseTestFileWithArch(t, "rv32i_zkne", "    aes32esmi a0, a1, a2, 3\n")
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	tests := []parseOperationTestStruct{
+		{
+			expectedOpcType: parse.BsType,
+			expectedVal:     "aes32esmi",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "a0",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "a1",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "a2",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.IMM,
+			expectedVal:     "3",
+			expectedRow:     1,
+		},
+	}
+
+	expectSameOperation(t, stmts[0], tests)
+}
+
+func TestParseCryptoSharedOperation(t *testing.T) {
+	// rorはZbbとZbkbのどちらが有効でも使える
+	for _, march := range []string{"rv32i_zbb", "rv32i_zbkb"} {
+		if _, err := parseTestFileWithArch(t, march, "    ror a0, a1, a2\n"); err != nil {
+			t.Fatalf("test - parse failed: %s\n%q", march, err.Error())
+		}
+	}
+}
+
+/*
+=====================================
+=========== Error Test ==============
+=====================================
+*/
+
+func TestParseCryptoError1(t *testing.T) {
+	_, err := parseTestFileWithArch(t, "rv32i_zksed", "    sm4ed a0, a1, a2, 4\n")
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectFileErrorMessage(t, err.Error(), "improper bs immediate (4)")
+}
+
+func TestParseCryptoError2(t *testing.T) {
+	_, err := parseTestFileWithArch(t, "rv32i_zkne", "    sha256sig0 a0, a1\n")
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectFileErrorMessage(t, err.Error(), "unrecognized opcode `sha256sig0', extension `zknh' required")
+}
+
+func TestParseCryptoError3(t *testing.T) {
+	_, err := parseTestFileWithArch(t, "rv32i", "    clmul a0, a1, a2\n")
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectFileErrorMessage(t, err.Error(), "unrecognized opcode `clmul', extension `zbc' or `zbkc' required")
+}
+
+// 拡張が有効でなければ、オペランドの誤りより先に拡張のエラーを出す
+func TestParseCryptoError4(t *testing.T) {
+	_, err := parseTestFileWithArch(t, "rv32i", "    aes32esi a0, a0, a1, 4\n")
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectFileErrorMessage(t, err.Error(), "unrecognized opcode `aes32esi', extension `zkne' required")
+}
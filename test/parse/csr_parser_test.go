@@ -0,0 +1,141 @@
+// parse/csr_parser_test.go
+
+package parsetest
+
+import (
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+func TestParseCSROperation1(t *testing.T) {
+	input := []rune("    csrrw a0, mstatus, a1")
+	stmt, err := parse.ParseLine(input, 1)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	tests := []parseOperationTestStruct{
+		{
+			expectedOpcType: parse.CSRType,
+			expectedVal:     "csrrw",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "a0",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.CSR,
+			expectedVal:     "mstatus",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "a1",
+			expectedRow:     1,
+		},
+	}
+
+	expectSameOperation(t, stmt, tests)
+}
+
+func TestParseCSRPseudo(t *testing.T) {
+	// csrr rd, csr は csrrs rd, csr, x0 に置き換わる
+	input := []rune("    csrr t0, 0x342")
+	stmt, err := parse.ParseLine(input, 1)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	tests := []parseOperationTestStruct{
+		{
+			expectedOpcType: parse.CSRType,
+			expectedVal:     "csrrs",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "t0",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.IMM,
+			expectedVal:     "0x342",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "x0",
+			expectedRow:     1,
+		},
+	}
+
+	expectSameOperation(t, stmt, tests)
+	if parse.CSRNumber(stmt.Op().Operands()[1]) != 0x342 {
+		t.Fatalf("test - CSR number wrong. got=%#x", parse.CSRNumber(stmt.Op().Operands()[1]))
+	}
+}
+
+func TestParseSfenceVma(t *testing.T) {
+	for _, line := range []string{"sfence.vma", "sfence.vma a0", "sfence.vma a0, a1"} {
+		stmt, err := parse.ParseLine([]rune(line), 1)
+		if err != nil {
+			t.Fatalf("test - parse failed: %s\n%q", line, err.Error())
+		}
+		if stmt.Op().OpcType() != parse.SysType {
+			t.Fatalf("test - OpecodeType wrong: %s", line)
+		}
+	}
+}
+
+/*
+=====================================
+=========== Error Test ==============
+=====================================
+*/
+
+func TestParseCSRError1(t *testing.T) {
+	input := []rune("csrr a0, foo")
+	_, err := parse.ParseLine(input, 1)
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectErrorMessage(t, err.Error(), "unknown CSR `foo'")
+}
+
+func TestParseCSRError2(t *testing.T) {
+	input := []rune("csrw 4096, a0")
+	_, err := parse.ParseLine(input, 1)
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectErrorMessage(t, err.Error(), "CSR address out of range: 4096")
+}
+
+func TestParseCSRError3(t *testing.T) {
+	input := []rune("csrrwi a0, mstatus, 32")
+	_, err := parse.ParseLine(input, 1)
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectErrorMessage(t, err.Error(), OperandErr)
+}
+
+func TestParseCSRError4(t *testing.T) {
+	// Zicsrが有効でなければCSR命令は使えない
+	_, err := parseTestFileWithArch(t, "rv32i", "    csrr a0, mstatus\n")
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectFileErrorMessage(t, err.Error(), "unrecognized opcode `csrr', extension `zicsr' required")
+
+	if _, err := parseTestFileWithArch(t, "rv32i_zicsr", "    csrr a0, mstatus\n    mret\n"); err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+}
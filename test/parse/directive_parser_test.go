@@ -3,6 +3,7 @@ package parsetest
 import (
 	"fmt"
 	"github.com/ayase-mstk/go32as/src/parse"
+	"strings"
 	"testing"
 )
 
@@ -512,6 +513,74 @@ func TestParseDirectiveWord(t *testing.T) {
 	expectSameDirective(t, stmt, tests)
 }
 
+func TestParseDirectiveLabelDiff(t *testing.T) {
+	tests := []string{"  .word end - start", "  .word end-start", "  .half end -start", "  .byte end- start"}
+
+	for _, input := range tests {
+		stmt, err := parse.ParseLine([]rune(input), 1)
+		if err != nil {
+			t.Fatalf("test - parse failed:\n%q", err.Error())
+		}
+		if args := stmt.Dir().Args(); len(args) != 1 || args[0] != "end-start" {
+			t.Fatalf("test - %q args wrong. got=%q, expected=[\"end-start\"]", input, args)
+		}
+	}
+}
+
+func TestParseDirectiveSectionFlags(t *testing.T) {
+	stmt, err := parse.ParseLine([]rune(`  .section .tbss,"awT",@nobits`), 1)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+	if args := stmt.Dir().Args(); len(args) != 3 || args[0] != ".tbss" || args[1] != `"awT"` || args[2] != "@nobits" {
+		t.Errorf("test - args wrong. got=%q", args)
+	}
+}
+
+func TestParseDirectiveReloc(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"  .reloc ., R_RISCV_NONE", []string{".", "R_RISCV_NONE"}},
+		{"  .reloc .+4, 56, tbl+8", []string{".+4", "56", "tbl+8"}},
+		{"  .reloc start, R_RISCV_SET32, foo-4 # comment", []string{"start", "R_RISCV_SET32", "foo-4"}},
+	}
+
+	for i, tt := range tests {
+		stmt, err := parse.ParseLine([]rune(tt.input), 1)
+		if err != nil {
+			t.Fatalf("test[%d] - parse failed:\n%q", i, err.Error())
+		}
+		if args := stmt.Dir().Args(); strings.Join(args, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("test[%d] - args wrong. got=%q, expected=%q", i, args, tt.expected)
+		}
+	}
+}
+
+func TestSymbolAddend(t *testing.T) {
+	tests := []struct {
+		input  string
+		sym    string
+		addend int64
+		ok     bool
+	}{
+		{"foo", "foo", 0, true},
+		{"foo+8", "foo", 8, true},
+		{".-4", ".", -4, true},
+		{"0x10", "", 16, true},
+		{"foo+bar", "", 0, false},
+		{"a+1+2", "", 0, false},
+	}
+
+	for i, tt := range tests {
+		sym, addend, ok := parse.SymbolAddend(tt.input)
+		if sym != tt.sym || addend != tt.addend || ok != tt.ok {
+			t.Errorf("test[%d] - %q wrong. got=%q %d %v, expected=%q %d %v", i, tt.input, sym, addend, ok, tt.sym, tt.addend, tt.ok)
+		}
+	}
+}
+
 func TestParseDirectiveLong(t *testing.T) {
 	input := []rune("  .long 0x12345678")
 	stmt, err := parse.ParseLine(input, 1)
@@ -555,7 +624,8 @@ func TestParseDirectiveZero(t *testing.T) {
 }
 
 func TestParseDirectiveAttribute(t *testing.T) {
-	input := []rune("  .attribute foo, 0x10")
+	// 名前で指定したタグは数値に揃えられる
+	input := []rune("  .attribute stack_align, 0x10")
 	stmt, err := parse.ParseLine(input, 1)
 	if err != nil {
 		t.Fatalf("test - parse failed:\n%q", err.Error())
@@ -567,7 +637,7 @@ func TestParseDirectiveAttribute(t *testing.T) {
 			expectedLabel: "",
 		},
 		{
-			expectedVal:   "foo",
+			expectedVal:   "4",
 			expectedLabel: "",
 		},
 		{
@@ -579,6 +649,32 @@ func TestParseDirectiveAttribute(t *testing.T) {
 	expectSameDirective(t, stmt, tests)
 }
 
+func TestParseDirectiveAttributeArch(t *testing.T) {
+	// Tag_RISCV_archの値は正規の形式に置き換えられる
+	input := []rune("  .attribute Tag_RISCV_arch, \"rv32imac\"")
+	stmt, err := parse.ParseLine(input, 1)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	tests := []parseDirectiveTestStruct{
+		{
+			expectedVal:   ".attribute",
+			expectedLabel: "",
+		},
+		{
+			expectedVal:   "5",
+			expectedLabel: "",
+		},
+		{
+			expectedVal:   "\"rv32i2p1_m2p0_a2p1_c2p0_zmmul1p0\"",
+			expectedLabel: "",
+		},
+	}
+
+	expectSameDirective(t, stmt, tests)
+}
+
 /*
 ======================================
 =========== Error Test ===============
@@ -671,6 +767,22 @@ func TestParseDirectiveErrorSection(t *testing.T) {
 	expectErrorMessage(t, err.Error(), fmt.Sprintf(UnrecognizedError, '\''))
 }
 
+func TestParseDirectiveErrorReloc(t *testing.T) {
+	tests := []string{
+		"  .reloc",
+		"  .reloc 0",
+		"  .reloc 0, R_RISCV_NONE, foo, bar",
+		"  .reloc a+b, R_RISCV_NONE",
+		"  .reloc 0, R_RISCV_NONE, foo+bar",
+	}
+
+	for i, tt := range tests {
+		if _, err := parse.ParseLine([]rune(tt), 1); err == nil {
+			t.Errorf("test[%d] - expected error for %q, but got nil", i, tt)
+		}
+	}
+}
+
 func TestParseDirectiveErrorSize(t *testing.T) {
 	input := []rune("  .size 0x1000")
 	_, err := parse.ParseLine(input, 1)
@@ -866,3 +978,35 @@ func TestParseDirectiveErrorAttribute(t *testing.T) {
 
 	expectErrorMessage(t, err.Error(), MissingArgument)
 }
+
+func TestParseDirectiveErrorAttribute2(t *testing.T) {
+	input := []rune("  .attribute foo, 0x10")
+	_, err := parse.ParseLine(input, 1)
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectErrorMessage(t, err.Error(), "attribute name not recognized: foo")
+}
+
+func TestParseDirectiveErrorAttribute3(t *testing.T) {
+	// Tag_RISCV_archは文字列をとる
+	input := []rune("  .attribute arch, 5")
+	_, err := parse.ParseLine(input, 1)
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectErrorMessage(t, err.Error(), "bad string constant")
+}
+
+func TestParseDirectiveErrorAttribute4(t *testing.T) {
+	// Tag_RISCV_stack_alignは数値をとる
+	input := []rune("  .attribute 4, \"16\"")
+	_, err := parse.ParseLine(input, 1)
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectErrorMessage(t, err.Error(), "expected numeric constant")
+}
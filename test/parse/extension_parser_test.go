@@ -0,0 +1,233 @@
+// parse/extension_parser_test.go
+
+package parsetest
+
+import (
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+// CUSTOM_0を使うベンダー拡張
+var xcustom = parse.Extension{
+	Name: "xcustom",
+	Instructions: map[string]parse.InstructionSpec{
+		"cust.add": {Format: parse.RType, Syntax: "rd, rs1, rs2", Fields: parse.Fields{Opcode: 0b0001011}},
+	},
+}
+
+func TestRegisterExtension(t *testing.T) {
+	if err := parse.RegisterExtension(xcustom); err != nil {
+		t.Fatalf("test - register failed:\n%q", err.Error())
+	}
+	// 同じ定義なら何度登録してもよい
+	if err := parse.RegisterExtension(xcustom); err != nil {
+		t.Fatalf("test - register again failed:\n%q", err.Error())
+	}
+
+	stmts, err := parseTestFileWithArch(t, "rv32i_xcustom", "    cust.add a0, a1, a2\n")
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+	expectSameSize(t, len(stmts), 1)
+	if stmts[0].Op().Opecode() != "cust.add" || stmts[0].Op().OpcType() != parse.RType {
+		t.Fatalf("test - operation wrong. got=%q", stmts[0].Op().Opecode())
+	}
+	if spec, exists := parse.LookupInstruction("cust.add"); !exists || spec.Fields.Opcode != 0b0001011 {
+		t.Fatalf("test - LookupInstruction wrong. got=%+v", spec)
+	}
+}
+
+func TestRegisterExtensionBuiltin(t *testing.T) {
+	// 組み込みの命令も同じAPIで登録されている
+	spec, exists := parse.LookupInstruction("srai")
+	if !exists {
+		t.Fatalf("test - srai is not registered")
+	}
+	if spec.Format != parse.IType || spec.Fields.Funct7 != 0b0100000 {
+		t.Fatalf("test - srai spec wrong. got=%+v", spec)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		insn     uint32
+		expected string
+	}{
+		{0x00c58533, "add a0, a1, a2"},
+		{0xfff58513, "addi a0, a1, -1"},
+		{0x4055d513, "srai a0, a1, 5"},
+		{0x0045a503, "lw a0, 4(a1)"},
+		{0xfea12e23, "sw a0, -4(sp)"},
+		{0xfe000ee3, "beq zero, zero, -4"},
+		{0x12345537, "lui a0, 0x12345"},
+		{0x008000ef, "jal ra, 8"},
+		{0x00100073, "ebreak"},
+		{0x0ff0000f, "fence"},
+		{0x0210000f, "fence r, w"},
+		{0x8330000f, "fence.tso"},
+		{0x0100000f, "pause"},
+		{0x30002573, "csrr a0, mstatus"}, // csrrsより固定されたビットが多い疑似命令を選ぶ
+		{0x34029073, "csrw mscratch, t0"},
+		{0x12000073, "sfence.vma"},
+		{0x12b50073, "sfence.vma a0, a1"},
+		{0x08054533, "zext.h a0, a0"}, // packと同じ符号だがrs2が固定されているzext.hを選ぶ
+		{0x60051513, "clz a0, a0"},
+		{0xe6c58533, "aes32esmi a0, a1, a2, 3"},
+
+		// RVC
+		{0x41c8, "c.lw a0, 4(a1)"},
+		{0x0001, "c.nop"},
+		{0x1141, "c.addi sp, -16"},
+		{0x7139, "c.addi16sp sp, -64"},
+		{0x757d, "c.lui a0, 0xfffff"},
+		{0xc006, "c.swsp ra, 0(sp)"},
+		{0x8082, "c.jr ra"},
+		{0x852e, "c.mv a0, a1"},
+		{0x9002, "c.ebreak"},
+
+		// ベクトル命令
+		{0x0d0572d7, "vsetvli t0, a0, e32,m1,ta,ma"},
+		{0x022180d7, "vadd.vv v1, v2, v3"},
+		{0x002180d7, "vadd.vv v1, v2, v3, v0.t"},
+		{0x0e2030d7, "vrsub.vi v1, v2, 0"},
+		{0x0e2040d7, "vneg.v v1, v2"}, // vrsub.vx vd, vs, x0
+		{0x6e2180d7, "vmslt.vv v1, v2, v3"},
+		{0x66212057, "vmmv.m v0, v2"}, // vmand.mm vd, vs, vs
+		{0x6e10a0d7, "vmclr.m v1"},    // vmxor.mm vd, vd, vd
+		{0x5c2180d7, "vmerge.vvm v1, v2, v3, v0"},
+		{0x02056087, "vle32.v v1, (a0)"},
+	}
+
+	for i, tt := range tests {
+		actual, ok := parse.Disassemble(tt.insn)
+		if !ok {
+			t.Fatalf("test[%d] - %#08x is not decoded", i, tt.insn)
+		}
+		if actual != tt.expected {
+			t.Errorf("test[%d] - %#08x decoded wrong. got=%q, expected=%q", i, tt.insn, actual, tt.expected)
+		}
+	}
+
+	if _, ok := parse.Disassemble(0x0000007b); ok {
+		t.Fatalf("test - unknown instruction is decoded")
+	}
+}
+
+/*
+=====================================
+=========== Error Test ==============
+=====================================
+*/
+
+func TestRegisterExtensionError1(t *testing.T) {
+	// -marchで有効にしていない拡張の命令は使えない
+	if err := parse.RegisterExtension(xcustom); err != nil {
+		t.Fatalf("test - register failed:\n%q", err.Error())
+	}
+	_, err := parseTestFileWithArch(t, "rv32i", "    cust.add a0, a1, a2\n")
+	if err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	}
+	expectFileErrorMessage(t, err.Error(), "unrecognized opcode `cust.add', extension `xcustom' required")
+}
+
+func TestRegisterExtensionError2(t *testing.T) {
+	tests := []struct {
+		ext      parse.Extension
+		expected string
+	}{
+		{parse.Extension{Name: "custom"}, "invalid ISA extension name `custom'"},
+		{parse.Extension{Name: "xbad2"}, "invalid ISA extension name `xbad2'"},
+		{parse.Extension{Name: "xbad", Implies: []string{"xunknown"}}, "unknown ISA extension `xunknown'"},
+		{
+			parse.Extension{Name: "zicsr", Instructions: map[string]parse.InstructionSpec{
+				"csrrw": {Format: parse.RType, Syntax: "rd, rs1, rs2", Fields: parse.Fields{Opcode: 0b0001011}},
+			}},
+			"instruction `csrrw' is already defined with a different encoding",
+		},
+		{
+			parse.Extension{Name: "zicsr", Instructions: map[string]parse.InstructionSpec{
+				"csrr": {Format: parse.CSRType, Syntax: "rd, csr", Fields: parse.Fields{Opcode: 0b1110011, Funct3: 0b010}},
+			}},
+			"instruction `csrr' is already defined with a different encoding",
+		},
+		{
+			parse.Extension{Name: "xbad", Instructions: map[string]parse.InstructionSpec{
+				"bad.c": {Format: parse.CIType, Syntax: "", Fields: parse.Fields{Opcode: 0b11}},
+			}},
+			"`bad.c' is not a 16-bit instruction (opcode 0x3)",
+		},
+		{
+			parse.Extension{Name: "xbad", Instructions: map[string]parse.InstructionSpec{
+				"bad.alias": {Syntax: "rd", Alias: "nosuch rd"},
+			}},
+			"unknown instruction `nosuch' in alias of `bad.alias'",
+		},
+		{
+			parse.Extension{Name: "xbad", Instructions: map[string]parse.InstructionSpec{
+				"bad.alias": {Syntax: "rd, rs1", Alias: "addi rd, rd, 0"},
+			}},
+			"operand `rs1' of `bad.alias' is not used in alias",
+		},
+		{
+			parse.Extension{Name: "xbad", Instructions: map[string]parse.InstructionSpec{
+				"bad.alias": {Syntax: "rd", Alias: "slli rd, rd, 32"},
+			}},
+			"illegal operand `32' in alias of `bad.alias'",
+		},
+		{
+			parse.Extension{Name: "xbad", Instructions: map[string]parse.InstructionSpec{
+				"bad.op": {Format: parse.RType, Syntax: "rd, rs1, rs4", Fields: parse.Fields{Opcode: 0b0001011}},
+			}},
+			"unknown operand `rs4' in syntax of `bad.op'",
+		},
+		{
+			// RTypeには即値の配置がない
+			parse.Extension{Name: "xbad", Instructions: map[string]parse.InstructionSpec{
+				"bad.op": {Format: parse.RType, Syntax: "rd, rs1, imm", Fields: parse.Fields{Opcode: 0b0001011}},
+			}},
+			"unknown operand `imm' in syntax of `bad.op'",
+		},
+		{
+			parse.Extension{Name: "xbad", Instructions: map[string]parse.InstructionSpec{
+				"bad.op": {Format: parse.RType, Syntax: "rd, rs2, shamt", Fields: parse.Fields{Opcode: 0b0001011}},
+			}},
+			"operand `shamt' overlaps another operand in syntax of `bad.op'",
+		},
+		{
+			parse.Extension{Name: "xbad", Instructions: map[string]parse.InstructionSpec{
+				"bad.op": {Format: parse.RType, Syntax: "rd, rs1, rs2", Fields: parse.Fields{Opcode: 0b0001000}},
+			}},
+			"`bad.op' is not a 32-bit instruction (opcode 0x8)",
+		},
+		{
+			parse.Extension{Name: "xbad", Instructions: map[string]parse.InstructionSpec{
+				"bad.op": {Format: parse.RType, Syntax: "rd, rs1, rs2", Fields: parse.Fields{Opcode: 0b0001011}, Reloc: "%lo"},
+			}},
+			"`bad.op' has no immediate operand for relocation function `%lo'",
+		},
+		{
+			parse.Extension{Name: "xbad", Instructions: map[string]parse.InstructionSpec{
+				"bad.op": {Format: parse.IType, Syntax: "rd, rs1, imm", Fields: parse.Fields{Opcode: 0b0001011}, Reloc: "%hi"},
+			}},
+			"relocation function `%hi' cannot be used with this instruction: `bad.op'",
+		},
+		{
+			parse.Extension{Name: "xbad", Instructions: map[string]parse.InstructionSpec{
+				"bad.op": {Format: parse.IType, Syntax: "rd, rs1, imm", Fields: parse.Fields{Opcode: 0b0001011}, Reloc: "%low"},
+			}},
+			"unknown relocation function `%low': `bad.op'",
+		},
+	}
+
+	for i, tt := range tests {
+		err := parse.RegisterExtension(tt.ext)
+		if err == nil {
+			t.Fatalf("test[%d] - expected error, but got nil", i)
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("test[%d] - error msg is different from expected.\nactual: %q\nexpected: %q", i, err.Error(), tt.expected)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// parse/insn_parser_test.go
+
+package parsetest
+
+import (
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+func TestParseInsn(t *testing.T) {
+	tests := []struct {
+		input    string
+		opcTyp   parse.OpecodeType
+		fields   parse.InsnFields
+		operands []string
+	}{
+		{".insn r CUSTOM_0, 1, 2, a0, a1, a2", parse.RType, parse.InsnFields{Opcode: 0x0b, Funct: 1, Funct2: 2}, []string{"a0", "a1", "a2"}},
+		{".insn r4 MADD, 0, 1, a0, a1, a2, a3", parse.R4Type, parse.InsnFields{Opcode: 0x43, Funct2: 1}, []string{"a0", "a1", "a2", "a3"}},
+		{".insn i OP_IMM, 0, a0, a1, 13", parse.IType, parse.InsnFields{Opcode: 0x13}, []string{"a0", "a1", "13"}},
+		// "imm(rs1)" の形式はrd, rs1, immの順に揃える
+		{".insn i LOAD, 2, a0, 4(a1)", parse.IType, parse.InsnFields{Opcode: 0x03, Funct: 2}, []string{"a0", "a1", "4"}},
+		{".insn s STORE, 2, a0, 8(a1)", parse.SType, parse.InsnFields{Opcode: 0x23, Funct: 2}, []string{"a0", "8", "a1"}},
+		{".insn sb BRANCH, 0, a0, a1, loop", parse.BType, parse.InsnFields{Opcode: 0x63}, []string{"a0", "a1", "loop"}},
+		{".insn u 0x37, a0, 0x12345", parse.UType, parse.InsnFields{Opcode: 0x37}, []string{"a0", "0x12345"}},
+		{".insn j JAL, ra, func", parse.JType, parse.InsnFields{Opcode: 0x6f}, []string{"ra", "func"}},
+		{".insn 0x00000013", parse.RawType, parse.InsnFields{Len: 4, Value: 0x13}, nil},
+		{".insn 2, 0x0001", parse.RawType, parse.InsnFields{Len: 2, Value: 0x1}, nil},
+	}
+
+	for i, tt := range tests {
+		stmt, err := parse.ParseLine([]rune(tt.input), 1)
+		if err != nil {
+			t.Fatalf("test[%d] - parse failed:\n%q", i, err.Error())
+		}
+		op := stmt.Op()
+		if op == nil || op.Insn() == nil {
+			t.Fatalf("test[%d] - %q is not parsed as .insn", i, tt.input)
+		}
+		if op.OpcType() != tt.opcTyp {
+			t.Fatalf("test[%d] - opecode type wrong. got=%d, expected=%d", i, op.OpcType(), tt.opcTyp)
+		}
+		if *op.Insn() != tt.fields {
+			t.Fatalf("test[%d] - fields wrong. got=%+v, expected=%+v", i, *op.Insn(), tt.fields)
+		}
+		expectSameSize(t, len(op.Operands()), len(tt.operands))
+		for j, want := range tt.operands {
+			if op.Operands()[j] != want {
+				t.Fatalf("test[%d] - operand[%d] wrong. got=%q, expected=%q", i, j, op.Operands()[j], want)
+			}
+		}
+	}
+}
+
+func TestParseInsnCompressed(t *testing.T) {
+	stmts, err := parseTestFileWithArch(t, "rv32ic", `    .insn cr C2, 9, a0, a1
+    .insn ca C1, 0x23, 3, a0, a1
+    .insn 0x4505
+`)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+	for i, stmt := range stmts {
+		if stmt.Op().Size() != 2 {
+			t.Fatalf("test[%d] - size wrong. got=%d, expected=2", i, stmt.Op().Size())
+		}
+	}
+}
+
+/*
+=====================================
+=========== Error Test ==============
+=====================================
+*/
+
+func TestParseInsnError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{".insn q 1", "unknown .insn format `q'"},
+		{".insn r 0x80, 0, 0, a0, a0, a0", "bad value for opcode field, value must be 0...127"},
+		{".insn r OP, 8, 0, a0, a0, a0", "bad value for funct3 field, value must be 0...7"},
+		{".insn r FOO, 0, 0, a0, a0, a0", "bad value for opcode field: FOO"},
+		{".insn i OP_IMM, 0, a0, a1, 5000", "immediate value 5000 out of range (-2048...2047)"},
+		{".insn r OP, 0, 0, a0, a0", "illegal operand."},
+		{".insn 4, 0x0001", "value conflicts with instruction length"},
+		{".insn", "missing argument."},
+	}
+
+	for _, tt := range tests {
+		_, err := parse.ParseLine([]rune(tt.input), 1)
+		if err == nil {
+			t.Fatalf("test - %q expected error, but got nil", tt.input)
+		}
+		expectErrorMessage(t, err.Error(), tt.expected)
+	}
+}
+
+func TestParseInsnError2(t *testing.T) {
+	// RVCの形式はC拡張が必要
+	_, err := parseTestFileWithArch(t, "rv32i", "    .insn ci C1, 0, a0, 1\n")
+	if err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	}
+	expectFileErrorMessage(t, err.Error(), "unrecognized opcode `.insn', extension `c' required")
+}
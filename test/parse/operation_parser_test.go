@@ -3,7 +3,9 @@
 package parsetest
 
 import (
+	"fmt"
 	"github.com/ayase-mstk/go32as/src/parse"
+	"strings"
 	"testing"
 )
 
@@ -28,7 +30,7 @@ func expectSameOperation(t *testing.T, got parse.Stmt, want []parseOperationTest
 
 		if i == 0 {
 			if got.Op().OpcType() != tt.expectedOpcType {
-				t.Fatalf("test[%d] - OpecodeType wrong. got=%q, expected=%q",
+				t.Fatalf("test[%d] - OpecodeType wrong. got=%d, expected=%d",
 					i, got.Op().OpcType(), tt.expectedOpcType)
 			}
 			if got.Op().Opecode() != tt.expectedVal {
@@ -37,7 +39,7 @@ func expectSameOperation(t *testing.T, got parse.Stmt, want []parseOperationTest
 			}
 		} else {
 			if got.Op().OprType()[i-1]&tt.expectedOprType == 0 {
-				t.Fatalf("test[%d] - OperandType wrong. got=%q, expected=%q",
+				t.Fatalf("test[%d] - OperandType wrong. got=%d, expected=%d",
 					i, got.Op().OprType()[i-1], tt.expectedOprType)
 			}
 			if got.Op().Operands()[i-1] != tt.expectedVal {
@@ -227,6 +229,81 @@ func TestParseOperationRelocation(t *testing.T) {
 	expectSameOperation(t, stmt, tests)
 }
 
+func TestParseOperationRelocationFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		relFunc  string
+		operands string
+	}{
+		{"lui a0, %hi(foo)", "%hi", "a0 foo"},
+		{"addi a0, a0, %lo(foo)", "%lo", "a0 a0 foo"},
+		{"sw a0, %lo(foo)(a1)", "%lo", "a0 foo a1"},
+		{"auipc a0, %pcrel_hi(foo)", "%pcrel_hi", "a0 foo"},
+		{"auipc a0, %got_pcrel_hi(foo)", "%got_pcrel_hi", "a0 foo"},
+		{"lui a0, %tprel_hi(foo)", "%tprel_hi", "a0 foo"},
+		{"lw a0, %tprel_lo(foo)(a0)", "%tprel_lo", "a0 foo a0"},
+		{"add a0, a0, tp, %tprel_add(foo)", "%tprel_add", "a0 a0 tp foo"},
+		{"auipc a0, %tls_ie_pcrel_hi(foo)", "%tls_ie_pcrel_hi", "a0 foo"},
+		{"auipc a0, %tls_gd_pcrel_hi(foo)", "%tls_gd_pcrel_hi", "a0 foo"},
+	}
+
+	for i, tt := range tests {
+		stmt, err := parse.ParseLine([]rune("    "+tt.input), 1)
+		if err != nil {
+			t.Fatalf("test[%d] - parse failed:\n%q", i, err.Error())
+		}
+		if stmt.Op().RelFunc() != tt.relFunc || strings.Join(stmt.Op().Operands(), " ") != tt.operands {
+			t.Errorf("test[%d] - %q wrong. got=%q %v", i, tt.input, stmt.Op().RelFunc(), stmt.Op().Operands())
+		}
+	}
+}
+
+func TestParseOperationFence(t *testing.T) {
+	input := []rune("    fence rw, w")
+	stmt, err := parse.ParseLine(input, 1)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	tests := []parseOperationTestStruct{
+		{
+			expectedOpcType: parse.FenceType,
+			expectedVal:     "fence",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.FENCESET,
+			expectedVal:     "rw",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.FENCESET,
+			expectedVal:     "w",
+			expectedRow:     1,
+		},
+	}
+
+	expectSameOperation(t, stmt, tests)
+}
+
+func TestParseOperationFenceBare(t *testing.T) {
+	input := []rune("    fence")
+	stmt, err := parse.ParseLine(input, 1)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	tests := []parseOperationTestStruct{
+		{
+			expectedOpcType: parse.FenceType,
+			expectedVal:     "fence",
+			expectedRow:     1,
+		},
+	}
+
+	expectSameOperation(t, stmt, tests)
+}
+
 /*
 =====================================
 =========== Error Test ==============
@@ -296,3 +373,86 @@ func TestParseOperationError6(t *testing.T) {
 
 	expectErrorMessage(t, err.Error(), OperandErr)
 }
+
+func TestParseOperationFenceError1(t *testing.T) {
+	// i, o, r, wの順でなければならない
+	input := []rune("fence wr, r")
+	_, err := parse.ParseLine(input, 1)
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectErrorMessage(t, err.Error(), OperandErr)
+}
+
+func TestParseOperationFenceError2(t *testing.T) {
+	input := []rune("fence rx, w")
+	_, err := parse.ParseLine(input, 1)
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectErrorMessage(t, err.Error(), OperandErr)
+}
+
+func TestParseOperationRelocationError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"addi a0, a0, %hi(foo)", "relocation function `%hi' cannot be used with this instruction"},
+		{"lui a0, %lo(foo)", "relocation function `%lo' cannot be used with this instruction"},
+		{"sw a0, %pcrel_hi(foo)(a1)", "relocation function `%pcrel_hi' cannot be used with this instruction"},
+		{"addi a0, a0, %tprel_add(foo)", "relocation function `%tprel_add' cannot be used with this instruction"},
+		{"lui a0, %foo(bar)", "unknown relocation function `%foo'"},
+		{"add a0, a0, a1, %tprel_add(foo)", "the third operand of `%tprel_add' must be tp"},
+		{"add a0, a0, tp, %lo(foo)", "junk at end of line, first unrecognized character is `%'"},
+	}
+
+	for i, tt := range tests {
+		_, err := parse.ParseLine([]rune("    "+tt.input), 1)
+		if err == nil {
+			t.Fatalf("test[%d] - %q have to be fail.", i, tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("test[%d] - error msg wrong. got=%q, expected=%q", i, err.Error(), tt.expected)
+		}
+	}
+}
+
+func TestParseOperationImmediateRangeError(t *testing.T) {
+	// 即値は形式の配置に収まらなければならず、B形式とJ形式は2の倍数
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"addi a0, a0, 99999", 99999},
+		{"addi a0, a0, -2049", -2049},
+		{"lw a0, 5000(a1)", 5000},
+		{"sw a0, -2049(a1)", -2049},
+		{"beq a0, a1, 5000", 5000},
+		{"bne a0, a1, 3", 3},
+		{"lui a0, 0x100000", 0x100000},
+		{"auipc a0, -1", -1},
+		{"jal ra, 1048576", 1048576},
+		{"jal ra, 7", 7},
+	}
+
+	for i, tt := range tests {
+		_, err := parse.ParseLine([]rune("    "+tt.input), 1)
+		if err == nil {
+			t.Fatalf("test[%d] - %q have to be fail.", i, tt.input)
+		}
+		expected := fmt.Sprintf("illegal operands: immediate %d out of range", tt.expected)
+		if err.Error() != expected {
+			t.Errorf("test[%d] - error msg wrong. got=%q, expected=%q", i, err.Error(), expected)
+		}
+	}
+
+	// 範囲の端の値は使える
+	for _, input := range []string{"addi a0, a0, -2048", "sw a0, 2047(a1)", "beq a0, a1, 4094", "lui a0, 0xfffff", "jal ra, -1048576"} {
+		if _, err := parse.ParseLine([]rune("    "+input), 1); err != nil {
+			t.Errorf("test - %q failed: %s", input, err.Error())
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// parse/option_parser_test.go
+
+package parsetest
+
+import (
+	"testing"
+)
+
+func TestParseOptionPushPop(t *testing.T) {
+	stmts := parseTestFile(t, `    .option rvc
+    .option push
+    .option norvc
+    .option norelax
+    .option pic
+    .option push
+    .option relax
+    .option pop
+    addi a0, a0, 1
+    .option pop
+    addi a0, a0, 1
+`)
+
+	expectSameSize(t, len(stmts), 11)
+	inner := stmts[8].Opts()
+	if inner.RVC() || inner.Relax() || !inner.PIC() {
+		t.Fatalf("test - options before .option pop wrong. rvc=%t relax=%t pic=%t", inner.RVC(), inner.Relax(), inner.PIC())
+	}
+	if stmts[8].Op().Opecode() != "addi" {
+		t.Fatalf("test - compressed under .option norvc. got=%q", stmts[8].Op().Opecode())
+	}
+	outer := stmts[10].Opts()
+	if !outer.RVC() || !outer.Relax() || outer.PIC() {
+		t.Fatalf("test - options after .option pop wrong. rvc=%t relax=%t pic=%t", outer.RVC(), outer.Relax(), outer.PIC())
+	}
+	if stmts[10].Op().Opecode() != "c.addi" {
+		t.Fatalf("test - not compressed after .option pop. got=%q", stmts[10].Op().Opecode())
+	}
+}
+
+func TestParseOptionArch(t *testing.T) {
+	stmts := parseTestFile(t, `    .option arch, +zba, +c
+    sh1add a0, a0, a1
+    addi a0, a0, 1
+    .option arch, -c
+    addi a0, a0, 1
+    .option arch, rv32ic_zbb
+    andn a0, a0, a1
+    addi a0, a0, 1
+`)
+
+	expected := []string{"", "sh1add", "c.addi", "", "addi", "", "andn", "c.addi"}
+	expectSameSize(t, len(stmts), len(expected))
+	for i, want := range expected {
+		if want == "" {
+			continue
+		}
+		if stmts[i].Op().Opecode() != want {
+			t.Fatalf("test[%d] - opecode wrong. got=%q, expected=%q", i, stmts[i].Op().Opecode(), want)
+		}
+	}
+	if !stmts[1].Opts().Arch().Has("zba") || stmts[6].Opts().Arch().Has("zba") {
+		t.Fatalf("test - .option arch is not recorded to statements")
+	}
+}
+
+/*
+=====================================
+=========== Error Test ==============
+=====================================
+*/
+
+func TestParseOptionError1(t *testing.T) {
+	// push していないのに pop はできない
+	_, err := parseTestFileWithArch(t, "rv32i", "    .option pop\n")
+	if err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	}
+	expectFileErrorMessage(t, err.Error(), ".option pop with no .option push")
+}
+
+func TestParseOptionError2(t *testing.T) {
+	// .option arch で外した拡張の命令は使えない
+	_, err := parseTestFileWithArch(t, "rv32i_zba", `    .option push
+    .option arch, -zba
+    sh1add a0, a0, a1
+`)
+	if err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	}
+	expectFileErrorMessage(t, err.Error(), "unrecognized opcode `sh1add', extension `zba' required")
+}
+
+func TestParseOptionError3(t *testing.T) {
+	_, err := parseTestFileWithArch(t, "rv32i", "    .option arch, +foo\n")
+	if err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	}
+	expectFileErrorMessage(t, err.Error(), "unknown ISA extension `foo' in .option arch")
+}
+
+func TestParseOptionError4(t *testing.T) {
+	_, err := parseTestFileWithArch(t, "rv32i", "    .option rvc, norvc\n")
+	if err == nil {
+		t.Fatalf("test - expected error, but got nil")
+	}
+	expectFileErrorMessage(t, err.Error(), "junk at end of line, first unrecognized character is `,'")
+}
@@ -3,9 +3,14 @@
 package parsetest
 
 import (
+	"errors"
 	"fmt"
-	"github.com/ayase-mstk/go32as/src/parse"
+	"strings"
 	"testing"
+
+	"github.com/ayase-mstk/go32as/src/diag"
+	"github.com/ayase-mstk/go32as/src/isa"
+	"github.com/ayase-mstk/go32as/src/parse"
 )
 
 type parseTestStruct struct {
@@ -19,7 +24,7 @@ func expectSame(t *testing.T, got []parse.Stmt, want []parseTestStruct) {
 		actual := got[i]
 
 		if actual.Type() != tt.expectedType {
-			t.Fatalf("test[%d] - StmtType wrong. got=%q, expected=%q",
+			t.Fatalf("test[%d] - StmtType wrong. got=%d, expected=%d",
 				i, actual.Type(), tt.expectedType)
 		}
 
@@ -300,3 +305,52 @@ func TestParserError5(t *testing.T) {
 
 	expectErrorMessage(t, err.Error(), fmt.Sprintf(UnrecognizedError, '.'))
 }
+
+func TestParseCollectsErrors(t *testing.T) {
+	src := "    addi a0, a0\n    .text\n\tlw a1, 0(a9)\n    .word 1 2\n    addi a0, a0, 1\n"
+	_, err := parse.Parse(strings.NewReader(src), "a.s", parse.NewOptions(isa.Default()))
+	if err == nil {
+		t.Fatalf("test - parser didnot fail: expect fail")
+	}
+
+	var diags diag.List
+	if !errors.As(err, &diags) {
+		t.Fatalf("test - error is not a diag.List: %T", err)
+	}
+	expected := []diag.Diagnostic{
+		{File: "a.s", Line: 1, Column: 14, Severity: diag.Error, Message: OperandErr},
+		{File: "a.s", Line: 3, Column: 11, Severity: diag.Error, Message: OperandErr},
+		{File: "a.s", Line: 4, Column: 13, Severity: diag.Error, Message: fmt.Sprintf(UnrecognizedError, '2')},
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("test - number of errors wrong. got=%d, expected=%d:\n%s", len(diags), len(expected), err.Error())
+	}
+	for i, want := range expected {
+		got := diags[i]
+		if got.File != want.File || got.Line != want.Line || got.Column != want.Column || got.Severity != want.Severity || got.Message != want.Message {
+			t.Errorf("test[%d] - diagnostic wrong. got=%+v, expected=%+v", i, got, want)
+		}
+	}
+	if err.Error() != "a.s:1: Error: "+OperandErr+"\na.s:3: Error: "+OperandErr+"\na.s:4: Error: "+fmt.Sprintf(UnrecognizedError, '2') {
+		t.Errorf("test - error message wrong. got=%q", err.Error())
+	}
+}
+
+func TestParseStopsAtMaxErrors(t *testing.T) {
+	// 上限の数だけエラーを見つけたら残りの行は読まず、それまでに読めた文は返す
+	src := "    addi a0, a0, 1\n    addi a0, a0\n\tlw a1, 0(a9)\n    .word 1 2\n"
+	opts := parse.NewOptions(isa.Default())
+	opts.SetMaxErrors(2)
+	stmts, err := parse.Parse(strings.NewReader(src), "a.s", opts)
+
+	var diags diag.List
+	if !errors.As(err, &diags) {
+		t.Fatalf("test - error is not a diag.List: %T", err)
+	}
+	if len(diags) != 2 || diags[1].Line != 3 {
+		t.Errorf("test - errors wrong. got=%v", diags)
+	}
+	if len(stmts) != 1 || stmts[0].Row() != 1 {
+		t.Errorf("test - statements wrong. got=%d statements", len(stmts))
+	}
+}
@@ -0,0 +1,253 @@
+// parse/pseudo_parser_test.go
+
+package parsetest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+func TestParseCallTail(t *testing.T) {
+	// RV32Eでも使え、RVCが有効でも圧縮されない
+	stmts, err := parseTestFileWithArch(t, "rv32ec", `f:  call foo
+    tail f
+`)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	expected := []struct {
+		label    string
+		opecode  string
+		operands string
+		relFunc  string
+	}{
+		{"f", "auipc", "ra foo", parse.CallRelFunc},
+		{"", "jalr", "ra ra 0", ""},
+		{"", "auipc", "t1 f", parse.CallRelFunc},
+		{"", "jalr", "zero t1 0", ""},
+	}
+	expectSameSize(t, len(stmts), len(expected))
+	for i, tt := range expected {
+		op := stmts[i].Op()
+		if stmts[i].LSymbol() != tt.label {
+			t.Errorf("test[%d] - label wrong. got=%q, expected=%q", i, stmts[i].LSymbol(), tt.label)
+		}
+		if op.Opecode() != tt.opecode || strings.Join(op.Operands(), " ") != tt.operands || op.RelFunc() != tt.relFunc {
+			t.Errorf("test[%d] - expansion wrong. got=%s %v %q, expected=%s %s %q",
+				i, op.Opecode(), op.Operands(), op.RelFunc(), tt.opecode, tt.operands, tt.relFunc)
+		}
+		if stmts[i].Row() != i/2+1 {
+			t.Errorf("test[%d] - row wrong. got=%d, expected=%d", i, stmts[i].Row(), i/2+1)
+		}
+	}
+}
+
+func TestParseAddressPseudo(t *testing.T) {
+	stmts := parseTestFile(t, `start:
+    la a0, msg
+x:  lw a1, msg
+    sw a1, msg, t0
+.L1:
+    auipc a2, %pcrel_hi(msg)
+    addi a2, a2, %pcrel_lo(.L1)
+`)
+
+	expected := []struct {
+		label    string
+		opecode  string
+		operands string
+		relFunc  string
+	}{
+		{"start", "", "", ""},
+		{".Lpcrel_hi0", "auipc", "a0 msg", "%pcrel_hi"},
+		{"", "addi", "a0 a0 .Lpcrel_hi0", "%pcrel_lo"},
+		{"x", "", "", ""},
+		{".Lpcrel_hi1", "auipc", "a1 msg", "%pcrel_hi"},
+		{"", "lw", "a1 .Lpcrel_hi1 a1", "%pcrel_lo"},
+		{".Lpcrel_hi2", "auipc", "t0 msg", "%pcrel_hi"},
+		{"", "sw", "a1 .Lpcrel_hi2 t0", "%pcrel_lo"},
+		{".L1", "", "", ""},
+		{"", "auipc", "a2 msg", "%pcrel_hi"},
+		{"", "addi", "a2 a2 .L1", "%pcrel_lo"},
+	}
+	expectSameSize(t, len(stmts), len(expected))
+	for i, tt := range expected {
+		if stmts[i].LSymbol() != tt.label {
+			t.Errorf("test[%d] - label wrong. got=%q, expected=%q", i, stmts[i].LSymbol(), tt.label)
+		}
+		op := stmts[i].Op()
+		if op == nil {
+			if tt.opecode != "" {
+				t.Errorf("test[%d] - operation is missing. expected=%s", i, tt.opecode)
+			}
+			continue
+		}
+		if op.Opecode() != tt.opecode || strings.Join(op.Operands(), " ") != tt.operands || op.RelFunc() != tt.relFunc {
+			t.Errorf("test[%d] - expansion wrong. got=%s %v %q, expected=%s %s %q",
+				i, op.Opecode(), op.Operands(), op.RelFunc(), tt.opecode, tt.operands, tt.relFunc)
+		}
+	}
+}
+
+func TestParseTLSPseudo(t *testing.T) {
+	stmts := parseTestFile(t, `    la.tls.ie a1, ie
+    la.tls.gd a0, gd
+    call __tls_get_addr@plt
+`)
+
+	expected := []struct {
+		label    string
+		opecode  string
+		operands string
+		relFunc  string
+	}{
+		{".Lpcrel_hi0", "auipc", "a1 ie", "%tls_ie_pcrel_hi"},
+		{"", "lw", "a1 .Lpcrel_hi0 a1", "%pcrel_lo"},
+		{".Lpcrel_hi1", "auipc", "a0 gd", "%tls_gd_pcrel_hi"},
+		{"", "addi", "a0 a0 .Lpcrel_hi1", "%pcrel_lo"},
+		{"", "auipc", "ra __tls_get_addr", parse.CallRelFunc},
+		{"", "jalr", "ra ra 0", ""},
+	}
+	expectSameSize(t, len(stmts), len(expected))
+	for i, tt := range expected {
+		op := stmts[i].Op()
+		if stmts[i].LSymbol() != tt.label {
+			t.Errorf("test[%d] - label wrong. got=%q, expected=%q", i, stmts[i].LSymbol(), tt.label)
+		}
+		if op.Opecode() != tt.opecode || strings.Join(op.Operands(), " ") != tt.operands || op.RelFunc() != tt.relFunc {
+			t.Errorf("test[%d] - expansion wrong. got=%s %v %q, expected=%s %s %q",
+				i, op.Opecode(), op.Operands(), op.RelFunc(), tt.opecode, tt.operands, tt.relFunc)
+		}
+	}
+}
+
+func TestParsePICAddressPseudo(t *testing.T) {
+	// ファイル内で閉じたシンボルだけPC相対で求め、それ以外はGOTから読む
+	stmts := parseTestFile(t, `    .option pic
+    .globl g
+    la a0, ext
+    la a1, loc
+    la a2, g
+    lla a3, ext
+    .option nopic
+    la a4, ext
+loc:
+g:
+`)
+
+	expected := []struct {
+		opecode  string
+		operands string
+		relFunc  string
+	}{
+		{"auipc", "a0 ext", "%got_pcrel_hi"},
+		{"lw", "a0 .Lpcrel_hi0 a0", "%pcrel_lo"},
+		{"auipc", "a1 loc", "%pcrel_hi"},
+		{"addi", "a1 a1 .Lpcrel_hi1", "%pcrel_lo"},
+		{"auipc", "a2 g", "%got_pcrel_hi"},
+		{"lw", "a2 .Lpcrel_hi2 a2", "%pcrel_lo"},
+		{"auipc", "a3 ext", "%pcrel_hi"},
+		{"addi", "a3 a3 .Lpcrel_hi3", "%pcrel_lo"},
+		{"auipc", "a4 ext", "%pcrel_hi"},
+		{"addi", "a4 a4 .Lpcrel_hi4", "%pcrel_lo"},
+	}
+	var ops []*parse.Operation
+	for _, stmt := range stmts {
+		if stmt.Op() != nil {
+			ops = append(ops, stmt.Op())
+		}
+	}
+	expectSameSize(t, len(ops), len(expected))
+	for i, tt := range expected {
+		op := ops[i]
+		if op.Opecode() != tt.opecode || strings.Join(op.Operands(), " ") != tt.operands || op.RelFunc() != tt.relFunc {
+			t.Errorf("test[%d] - expansion wrong. got=%s %v %q, expected=%s %s %q",
+				i, op.Opecode(), op.Operands(), op.RelFunc(), tt.opecode, tt.operands, tt.relFunc)
+		}
+	}
+}
+
+func TestRelaxBranch(t *testing.T) {
+	stmts := parseTestFile(t, `l:  bltu a0, a1, far
+    beq a0, a1, 16
+    jal zero, far
+`)
+	expectSameSize(t, len(stmts), 3)
+
+	// 即値やjalは置き換えの対象にならない
+	for i, stmt := range stmts[1:] {
+		if _, ok := stmt.BranchTarget(); ok {
+			t.Errorf("test[%d] - %s must not be a branch to label", i, stmt.Op().Opecode())
+		}
+	}
+	target, ok := stmts[0].BranchTarget()
+	if !ok || target != "far" {
+		t.Fatalf("test - branch target wrong. got=%q %v, expected=%q", target, ok, "far")
+	}
+
+	relaxed := stmts[0].RelaxBranch()
+	expected := []struct {
+		label    string
+		opecode  string
+		operands string
+	}{
+		{"l", "bgeu", "a0 a1 8"},
+		{"", "jal", "zero far"},
+	}
+	expectSameSize(t, len(relaxed), len(expected))
+	for i, tt := range expected {
+		op := relaxed[i].Op()
+		if relaxed[i].LSymbol() != tt.label || op.Opecode() != tt.opecode || strings.Join(op.Operands(), " ") != tt.operands {
+			t.Errorf("test[%d] - relaxed branch wrong. got=%q %s %v, expected=%q %s %s",
+				i, relaxed[i].LSymbol(), op.Opecode(), op.Operands(), tt.label, tt.opecode, tt.operands)
+		}
+	}
+}
+
+/*
+=====================================
+=========== Error Test ==============
+=====================================
+*/
+
+func TestParseCallError(t *testing.T) {
+	tests := []string{
+		"  call a0",
+		"  call 16",
+		"  tail",
+		"  call foo, bar",
+		"  la a0",
+		"  lla 4, foo",
+		"  lw a0, 16",
+		"  sw a0, foo",
+	}
+
+	for i, tt := range tests {
+		if _, err := parse.ParseLine([]rune(tt), 1); err == nil {
+			t.Errorf("test[%d] - expected error for %q, but got nil", i, tt)
+		}
+	}
+}
+
+func TestParsePcrelLoError(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		// %pcrel_loには最終的なシンボルではなくauipcのラベルを書く
+		{"    auipc a0, %pcrel_hi(foo)\n    addi a0, a0, %pcrel_lo(foo)\n", "could not find corresponding %pcrel_hi for `foo'"},
+		{".L1:\n    lui a0, %hi(foo)\n    addi a0, a0, %pcrel_lo(.L1)\n", "could not find corresponding %pcrel_hi for `.L1'"},
+		{".L1:\n    auipc a0, 0\n    lw a0, %pcrel_lo(.L1)(a0)\n", "could not find corresponding %pcrel_hi for `.L1'"},
+	}
+
+	for i, tt := range tests {
+		_, err := parseTestFileWithArch(t, "rv32i", tt.src)
+		if err == nil {
+			t.Fatalf("test[%d] - expected error, but got nil", i)
+		}
+		expectFileErrorMessage(t, err.Error(), tt.expected)
+	}
+}
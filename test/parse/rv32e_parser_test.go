@@ -0,0 +1,48 @@
+// parse/rv32e_parser_test.go
+
+package parsetest
+
+import (
+	"testing"
+)
+
+func TestParseRV32E(t *testing.T) {
+	stmts, err := parseTestFileWithArch(t, "rv32ec", `    add a5, a0, a1
+    lw s1, 4(sp)
+    c.mv x15, x8
+`)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+	expectSameSize(t, len(stmts), 3)
+}
+
+/*
+=====================================
+=========== Error Test ==============
+=====================================
+*/
+
+func TestParseRV32EError(t *testing.T) {
+	// x16-x31はどのオペランドの位置でも使えない
+	tests := []struct {
+		src      string
+		register string
+	}{
+		{"    add a6, a0, a1\n", "a6"},
+		{"    add a0, x16, a1\n", "x16"},
+		{"    add a0, a0, t6\n", "t6"},
+		{"    lw a0, 0(s2)\n", "s2"},
+		{"    sw s11, 0(sp)\n", "s11"},
+		{"    jalr x0, x31, 0\n", "x31"},
+		{"    c.mv a0, a7\n", "a7"},
+	}
+
+	for i, tt := range tests {
+		_, err := parseTestFileWithArch(t, "rv32ec", tt.src)
+		if err == nil {
+			t.Fatalf("test[%d] - expected error, but got nil", i)
+		}
+		expectFileErrorMessage(t, err.Error(), "register `"+tt.register+"' is not available in RV32E")
+	}
+}
@@ -0,0 +1,218 @@
+// parse/vector_parser_test.go
+
+package parsetest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ayase-mstk/go32as/src/parse"
+)
+
+func TestParseVectorOperation1(t *testing.T) {
+	stmts, err := parseTestFileWithArch(t, "rv32iv", "    vsetvli t0, a0, e32, m4, ta, ma\n")
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	// vtypeは1つのオペランドにまとめられる
+	tests := []parseOperationTestStruct{
+		{
+			expectedOpcType: parse.VCfgType,
+			expectedVal:     "vsetvli",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "t0",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "a0",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.VTYPE,
+			expectedVal:     "e32,m4,ta,ma",
+			expectedRow:     1,
+		},
+	}
+
+	expectSameOperation(t, stmts[0], tests)
+	if parse.VtypeValue(stmts[0].Op().Operands()[2]) != 0xd2 {
+		t.Fatalf("test - vtype wrong. got=%#x", parse.VtypeValue(stmts[0].Op().Operands()[2]))
+	}
+}
+
+func TestParseVectorOperation2(t *testing.T) {
+	stmts, err := parseTestFileWithArch(t, "rv32iv", "    vlse32.v v4, (a0), a1, v0.t\n")
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	tests := []parseOperationTestStruct{
+		{
+			expectedOpcType: parse.VMemType,
+			expectedVal:     "vlse32.v",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.VREG,
+			expectedVal:     "v4",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "a0",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.REG,
+			expectedVal:     "a1",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.VMASK,
+			expectedVal:     "v0.t",
+			expectedRow:     1,
+		},
+	}
+
+	expectSameOperation(t, stmts[0], tests)
+}
+
+func TestParseVectorPseudo(t *testing.T) {
+	// vmsgt.vv vd, va, vb は vmslt.vv vd, vb, va に置き換わる
+	stmts, err := parseTestFileWithArch(t, "rv32iv", "    vmsgt.vv v1, v2, v3, v0.t\n")
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	tests := []parseOperationTestStruct{
+		{
+			expectedOpcType: parse.VArithType,
+			expectedVal:     "vmslt.vv",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.VREG,
+			expectedVal:     "v1",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.VREG,
+			expectedVal:     "v3",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.VREG,
+			expectedVal:     "v2",
+			expectedRow:     1,
+		},
+		{
+			expectedOprType: parse.VMASK,
+			expectedVal:     "v0.t",
+			expectedRow:     1,
+		},
+	}
+
+	expectSameOperation(t, stmts[0], tests)
+}
+
+func TestParseVectorComparePseudo(t *testing.T) {
+	// 即値を1つずらした比較や、反対の比較の結果を反転する命令列に展開する
+	stmts, err := parseTestFileWithArch(t, "rv32iv", `    vmslt.vi v1, v2, 16
+    vmsgeu.vi v1, v2, 0, v0.t
+    vmsge.vx v1, v2, a0
+    vmsgeu.vx v1, v2, a0, v0.t
+`)
+	if err != nil {
+		t.Fatalf("test - parse failed:\n%q", err.Error())
+	}
+
+	expected := []string{
+		"vmsle.vi v1, v2, 15",
+		"vmseq.vv v1, v2, v2, v0.t",
+		"vmslt.vx v1, v2, a0",
+		"vmnand.mm v1, v1, v1",
+		"vmsltu.vx v1, v2, a0, v0.t",
+		"vmxor.mm v1, v1, v0",
+	}
+	if len(stmts) != len(expected) {
+		t.Fatalf("test - number of statements wrong. got=%d, expected=%d", len(stmts), len(expected))
+	}
+	for i, want := range expected {
+		got := stmts[i].Op().Opecode() + " " + strings.Join(stmts[i].Op().Operands(), ", ")
+		if got != want {
+			t.Errorf("test[%d] - expansion wrong. got=%q, expected=%q", i, got, want)
+		}
+	}
+}
+
+/*
+=====================================
+=========== Error Test ==============
+=====================================
+*/
+
+func TestParseVectorError1(t *testing.T) {
+	_, err := parseTestFileWithArch(t, "rv32i", "    vadd.vv v1, v2, v3\n")
+	if err == nil {
+		t.Fatalf("test - parse have to be fail.")
+	}
+
+	expectFileErrorMessage(t, err.Error(), "unrecognized opcode `vadd.vv', extension `v' or `zve32x' required")
+}
+
+func TestParseVectorError2(t *testing.T) {
+	// SEWはLMULより前に書かなければならない
+	tests := []string{
+		"    vsetvli a0, a1, m4, e32\n",
+		"    vadd.vi v1, v2, 16\n",
+		"    vsrl.vi v1, v2, 32\n",
+		"    vmerge.vvm v1, v2, v3, v4\n",
+		"    vsetivli a0, 32, e8\n",
+	}
+	for _, src := range tests {
+		_, err := parseTestFileWithArch(t, "rv32iv", src)
+		if err == nil {
+			t.Fatalf("test - parse have to be fail: %q", src)
+		}
+
+		expectFileErrorMessage(t, err.Error(), OperandErr)
+	}
+}
+
+func TestParseVectorError3(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		// v0.tをとる命令は結果でマスクを上書きできない
+		{"    vadd.vv v0, v1, v2, v0.t\n", "illegal operands: the destination of a masked instruction cannot be v0"},
+		{"    vle8.v v0, (a0), v0.t\n", "illegal operands: the destination of a masked instruction cannot be v0"},
+		{"    vmsge.vx v0, v1, a0, v0.t\n", "illegal operands: the destination of a masked instruction cannot be v0"},
+		// レジスタの組は組の大きさの倍数の番号から始まる
+		{"    vmv2r.v v1, v2\n", "illegal operands: `v1' is not aligned to a group of 2 vector registers"},
+		{"    vmv4r.v v4, v6\n", "illegal operands: `v6' is not aligned to a group of 4 vector registers"},
+		{"    vl2r.v v3, (a0)\n", "illegal operands: `v3' is not aligned to a group of 2 vector registers"},
+		{"    vs8r.v v4, (a0)\n", "illegal operands: `v4' is not aligned to a group of 8 vector registers"},
+		{"    vmslt.vi v1, v2, 17\n", OperandErr},
+	}
+	for _, tt := range tests {
+		_, err := parseTestFileWithArch(t, "rv32iv", tt.src)
+		if err == nil {
+			t.Fatalf("test - parse have to be fail: %q", tt.src)
+		}
+
+		expectFileErrorMessage(t, err.Error(), tt.expected)
+	}
+
+	// 比較とリダクションは結果をv0に書ける
+	for _, src := range []string{"    vmseq.vv v0, v1, v2, v0.t\n", "    vredsum.vs v0, v1, v2, v0.t\n", "    vmsge.vi v0, v1, 3, v0.t\n"} {
+		if _, err := parseTestFileWithArch(t, "rv32iv", src); err != nil {
+			t.Errorf("test - parse failed: %q\n%s", src, err.Error())
+		}
+	}
+}